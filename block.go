@@ -1,5 +1,7 @@
 package main
 
+import "go/ast"
+import "go/token"
 import "llvm"
 
 type Block struct {
@@ -8,4 +10,151 @@ type Block struct {
 	Builder  llvm.Builder
 	ResultTy Type
 	Trans    *Translator
+	Fn       llvm.Value      // the function being translated
+	Entry    llvm.BasicBlock // the function's entry block, which holds its allocas
+	// set once the current basic block ends in a terminator (ret, br, ...).
+	Terminated bool
+	// the innermost loop (or switch) being translated, if any.
+	Loop *Loop
+	// the function's symbol, which its function literals are named after.
+	FnName string
+	// variables with these names live on the heap (see escapingNames).
+	Escaping map[string]bool
+}
+
+/*
+ * createChild returns a block with a nested scope, for translating a nested
+ * statement list. It shares the parent's builder; when the child is done, the
+ * parent picks up where it left off with continueFrom.
+ */
+func (block *Block) createChild() *Block {
+	child := *block
+	child.Scope = block.Scope.createChild()
+	return &child
+}
+
+func (block *Block) continueFrom(child *Block) {
+	block.Block = child.Block
+	block.Terminated = child.Terminated
+}
+
+func (block *Block) appendBasicBlock(name string) llvm.BasicBlock {
+	return llvm.AppendBasicBlock(block.Fn, name)
+}
+
+func (block *Block) positionAtEnd(bb llvm.BasicBlock) {
+	block.Builder.PositionBuilderAtEnd(bb)
+	block.Block = bb
+	block.Terminated = false
+}
+
+func (block *Block) buildBr(dest llvm.BasicBlock) {
+	block.Builder.BuildBr(dest)
+	block.Terminated = true
+}
+
+func (block *Block) buildCondBr(cond llvm.Value, then llvm.BasicBlock, els llvm.BasicBlock) {
+	block.Builder.BuildCondBr(cond, then, els)
+	block.Terminated = true
+}
+
+/*
+ * Allocas always go at the top of the entry block, regardless of where the
+ * builder currently is, so that LLVM can promote them to registers.
+ */
+func (block *Block) buildAlloca(ty llvm.Type, name string) llvm.Value {
+	builder := llvm.CreateBuilder()
+	defer builder.Dispose()
+	positionAtStart(builder, block.Entry)
+	return builder.BuildAlloca(ty, name)
+}
+
+// positions `builder` ahead of anything already in `bb`.
+func positionAtStart(builder llvm.Builder, bb llvm.BasicBlock) {
+	first := llvm.GetFirstInstruction(bb)
+	if first.IsNil() {
+		builder.PositionBuilderAtEnd(bb)
+	} else {
+		builder.PositionBuilderBefore(first)
+	}
+}
+
+// creates a new, uninitialized variable of type `ty`.
+func (block *Block) createVariable(name string, ty Type) *Variable {
+	ptr := block.buildAlloca(MemLLVM(ty), name)
+	return &Variable{ty, ptr, block.Builder}
+}
+
+/*
+ * createHeapVariable creates a new, uninitialized variable of type `ty` on the
+ * heap, where it outlives the function. Each time the code runs, it allocates
+ * a separate variable.
+ */
+func (block *Block) createHeapVariable(ty Type) *Variable {
+	memTy := MemLLVM(ty)
+	size := llvm.ConstInt(global_type_factory.IntType(BLTN_TY_INT).LLVM(), block.Trans.Target.AllocSize(memTy), false)
+	mem := block.buildRuntimeCall("gogo_alloc", size)
+	ptr := block.Builder.BuildBitCast(mem, llvm.PointerType(memTy, 0), "")
+	return &Variable{ty, ptr, block.Builder}
+}
+
+/*
+ * buildRuntimeCheck branches to a call to the runtime panic function `fn` if
+ * `failed` is true, and otherwise carries on in a fresh basic block.
+ */
+func (block *Block) buildRuntimeCheck(failed llvm.Value, fn *FuncValue, args ...llvm.Value) {
+	failBB := block.appendBasicBlock("check.fail")
+	okBB := block.appendBasicBlock("check.ok")
+	block.buildCondBr(failed, failBB, okBB)
+
+	block.positionAtEnd(failBB)
+	block.Builder.BuildCall(fn.LLVMVal, args, "")
+	block.Builder.BuildUnreachable()
+
+	block.positionAtEnd(okBB)
+}
+
+/*
+ * escapingNames returns the names of the variables in `body` that might
+ * outlive the function: those that function literals use, since they might
+ * capture them, and those whose address is taken. Shadowing is ignored, so
+ * some of them needn't escape at all.
+ */
+func escapingNames(body *ast.BlockStmt) map[string]bool {
+	names := make(map[string]bool)
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch nodeTy := node.(type) {
+		case *ast.FuncLit:
+			ast.Inspect(nodeTy.Body, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Ident); ok {
+					names[ident.Name] = true
+				}
+				return true
+			})
+			return false
+		case *ast.UnaryExpr:
+			if nodeTy.Op == token.AND {
+				if ident := addressedVar(nodeTy.X); ident != nil {
+					names[ident.Name] = true
+				}
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// the variable that `&expr` takes the address of (part of), if any.
+func addressedVar(expr ast.Expr) *ast.Ident {
+	switch exprTy := expr.(type) {
+	case *ast.Ident:
+		return exprTy
+	case *ast.ParenExpr:
+		return addressedVar(exprTy.X)
+	case *ast.SelectorExpr:
+		return addressedVar(exprTy.X)
+	case *ast.IndexExpr:
+		return addressedVar(exprTy.X)
+	}
+	return nil
 }
@@ -0,0 +1,316 @@
+package main
+
+import "go/ast"
+import "go/token"
+import "llvm"
+import "math/big"
+
+// returns the builtin named by `expr`, or nil if it isn't one (or is shadowed).
+func (block *Block) builtinOf(expr ast.Expr) *BuiltinFunc {
+	switch fnExpr := expr.(type) {
+	case *ast.Ident:
+		bound := block.Scope.lookupVar(fnExpr.Name)
+		if bound == nil {
+			return nil
+		}
+		builtin, _ := bound.Val.(*BuiltinFunc)
+		return builtin
+	case *ast.ParenExpr:
+		return block.builtinOf(fnExpr.X)
+	case *ast.SelectorExpr:
+		if pkg := packageOf(block.Scope, fnExpr.X); pkg != nil {
+			return pkg.Funcs[fnExpr.Sel.Name]
+		}
+	}
+	return nil
+}
+
+func (block *Block) translateBuiltinCall(builtin *BuiltinFunc, call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	switch builtin.Name {
+	case "complex":
+		return block.translateComplexBuiltin(call)
+	case "real", "imag":
+		return block.translatePartBuiltin(call, builtin.Name == "real")
+	case "len":
+		return block.translateLenBuiltin(call)
+	case "cap":
+		return block.translateCapBuiltin(call)
+	case "make":
+		return block.translateMakeBuiltin(call)
+	case "append":
+		return block.translateAppendBuiltin(call)
+	case "copy":
+		return block.translateCopyBuiltin(call)
+	case "delete":
+		return block.translateDeleteBuiltin(call)
+	case "new":
+		return block.translateNewBuiltin(call)
+	case "print", "println":
+		return nil, block.translatePrintBuiltin(call, builtin.Name == "println")
+	case "unsafe.Sizeof", "unsafe.Alignof":
+		return block.translateSizeofBuiltin(call, builtin.Name == "unsafe.Alignof")
+	case "unsafe.Offsetof":
+		return block.translateOffsetofBuiltin(call)
+	case "unsafe.Add":
+		return block.translateUnsafeAddBuiltin(call)
+	case "unsafe.Slice", "unsafe.String":
+		return block.translateUnsafeSliceBuiltin(call, builtin.Name == "unsafe.String")
+	}
+	panic("Bad internal state! (Unknown builtin function!)")
+}
+
+func checkArgCount(call *ast.CallExpr, name string, count int) *GoDiag {
+	if len(call.Args) != count {
+		return DiagFromAST(call, "Built-in function %s expects %d arguments, found %d.", name, count, len(call.Args))
+	}
+	return nil
+}
+
+// translates `complex(re, im)`. Both parts must be floats of the same type.
+func (block *Block) translateComplexBuiltin(call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	if diag := checkArgCount(call, "complex", 2); diag != nil {
+		return nil, diag
+	}
+	re, diag := block.translateOperand(call.Args[0])
+	if diag != nil {
+		return nil, diag
+	}
+	im, diag := block.translateOperand(call.Args[1])
+	if diag != nil {
+		return nil, diag
+	}
+
+	if isUntyped(re) && isUntyped(im) {
+		reRat, reOk := realConst(re)
+		imRat, imOk := realConst(im)
+		if !reOk {
+			return nil, DiagFromAST(call.Args[0], "Expected a real number, but found %s.", re.String())
+		}
+		if !imOk {
+			return nil, DiagFromAST(call.Args[1], "Expected a real number, but found %s.", im.String())
+		}
+		return &ConstComplex{reRat, imRat}, nil
+	}
+
+	// an untyped part takes the type of the other one, as with binary operators.
+	pair := &ast.BinaryExpr{X: call.Args[0], Op: token.ADD, Y: call.Args[1]}
+	reTyped, imTyped, diag := block.unifyOperands(pair, re, im)
+	if diag != nil {
+		return nil, diag
+	}
+	partTy, ok := reTyped.Type().Base().(*FloatType)
+	if !ok {
+		return nil, DiagFromAST(call, "Arguments to complex must be floating-point numbers, but found type %s.", reTyped.Type().String())
+	}
+	ty := global_type_factory.ComplexType(BLTN_TY_COMPLEX128)
+	if partTy.Type == BLTN_TY_FLOAT32 {
+		ty = global_type_factory.ComplexType(BLTN_TY_COMPLEX64)
+	}
+
+	reConst, reIsConst := reTyped.(*TypedConstFloat)
+	imConst, imIsConst := imTyped.(*TypedConstFloat)
+	if reIsConst && imIsConst {
+		return &TypedConstComplex{ConstComplex{reConst.Inner.Rat, imConst.Inner.Rat}, ty}, nil
+	}
+	return &Register{ty, block.buildComplex(ty, reTyped.LLVM(), imTyped.LLVM())}, nil
+}
+
+// returns the value of an untyped constant that represents a real number.
+func realConst(val UntypedValue) (*big.Rat, bool) {
+	re, im, ok := constComplexParts(val)
+	if !ok || im.Sign() != 0 {
+		return nil, false
+	}
+	return re, true
+}
+
+// translates `real(c)` (if `wantReal`) or `imag(c)`.
+func (block *Block) translatePartBuiltin(call *ast.CallExpr, wantReal bool) (UntypedValue, *GoDiag) {
+	name := "imag"
+	if wantReal {
+		name = "real"
+	}
+	if diag := checkArgCount(call, name, 1); diag != nil {
+		return nil, diag
+	}
+	arg, diag := block.translateOperand(call.Args[0])
+	if diag != nil {
+		return nil, diag
+	}
+
+	if isUntyped(arg) {
+		re, im, ok := constComplexParts(arg)
+		if !ok {
+			return nil, DiagFromAST(call.Args[0], "Expected a complex number, but found %s.", arg.String())
+		}
+		if wantReal {
+			return &ConstFloat{re}, nil
+		}
+		return &ConstFloat{im}, nil
+	}
+
+	typed, udiag := arg.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(call.Args[0], *udiag)
+	}
+	complexTy, ok := typed.Type().Base().(*ComplexType)
+	if !ok {
+		return nil, DiagFromAST(call.Args[0], "Expected a complex number, but found type %s.", typed.Type().String())
+	}
+	partTy := complexTy.PartType()
+	if cnst, ok := typed.(*TypedConstComplex); ok {
+		if wantReal {
+			return &TypedConstFloat{ConstFloat{cnst.Inner.Re}, partTy}, nil
+		}
+		return &TypedConstFloat{ConstFloat{cnst.Inner.Im}, partTy}, nil
+	}
+	re, im := block.splitComplex(typed.LLVM())
+	if wantReal {
+		return &Register{partTy, re}, nil
+	}
+	return &Register{partTy, im}, nil
+}
+
+// translates `len(x)`, which is a constant if `x` is a constant string.
+func (block *Block) translateLenBuiltin(call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	if diag := checkArgCount(call, "len", 1); diag != nil {
+		return nil, diag
+	}
+	arg, diag := block.translateOperand(call.Args[0])
+	if diag != nil {
+		return nil, diag
+	}
+	typed, udiag := arg.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(call.Args[0], *udiag)
+	}
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	switch base := typed.Type().Base().(type) {
+	case *StringType:
+		if str, ok := typed.(*TypedConstString); ok {
+			return &TypedConstInt{ConstInt{big.NewInt(int64(len(str.Inner.Str))), true, false}, intTy}, nil
+		}
+		_, length := block.splitString(typed.LLVM())
+		return &Register{intTy, length}, nil
+	case *SliceType:
+		_, length, _ := block.splitSlice(typed.LLVM())
+		return &Register{intTy, length}, nil
+	case *ArrayType:
+		return &TypedConstInt{ConstInt{big.NewInt(base.Len), true, false}, intTy}, nil
+	case *MapType:
+		return &Register{intTy, block.buildRuntimeCall("gogo_map_len", typed.LLVM())}, nil
+	}
+	return nil, DiagFromAST(call.Args[0], "Invalid argument for len: a value of type %s.", typed.Type().String())
+}
+
+// translates `cap(x)`, which is a constant for arrays.
+func (block *Block) translateCapBuiltin(call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	if diag := checkArgCount(call, "cap", 1); diag != nil {
+		return nil, diag
+	}
+	arg, diag := block.translateOperand(call.Args[0])
+	if diag != nil {
+		return nil, diag
+	}
+	typed, udiag := arg.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(call.Args[0], *udiag)
+	}
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	switch base := typed.Type().Base().(type) {
+	case *SliceType:
+		_, _, capacity := block.splitSlice(typed.LLVM())
+		return &Register{intTy, capacity}, nil
+	case *ArrayType:
+		return &TypedConstInt{ConstInt{big.NewInt(base.Len), true, false}, intTy}, nil
+	}
+	return nil, DiagFromAST(call.Args[0], "Invalid argument for cap: a value of type %s.", typed.Type().String())
+}
+
+// translates `make(T, args...)`, where the first argument is a type.
+func (block *Block) translateMakeBuiltin(call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	if len(call.Args) == 0 {
+		return nil, DiagFromAST(call, "Built-in function make expects a type.")
+	}
+	ty, diag := block.translateType(call.Args[0])
+	if diag != nil {
+		return nil, diag
+	}
+	switch base := ty.Base().(type) {
+	case *SliceType:
+		return block.translateMakeSlice(call, ty, base)
+	case *MapType:
+		return block.translateMakeMap(call, ty, base)
+	}
+	return nil, DiagFromAST(call.Args[0], "Cannot make a value of type %s.", ty.String())
+}
+
+/*
+ * translatePrintBuiltin translates `print(...)` and `println(...)`, which write
+ * their arguments to standard output using the runtime's print_* functions.
+ * println separates its arguments with spaces and ends with a newline.
+ */
+func (block *Block) translatePrintBuiltin(call *ast.CallExpr, newline bool) *GoDiag {
+	for i, argExpr := range call.Args {
+		if newline && i > 0 {
+			block.buildRuntimeCall("print_space")
+		}
+		arg, diag := block.translateOperand(argExpr)
+		if diag != nil {
+			return diag
+		}
+		typed, udiag := arg.RValue(nil)
+		if udiag != nil {
+			return BindDiagToAST(argExpr, *udiag)
+		}
+		if diag := block.buildPrint(argExpr, typed); diag != nil {
+			return diag
+		}
+	}
+	if newline {
+		block.buildRuntimeCall("print_newline")
+	}
+	return nil
+}
+
+// prints a single value, widening it to what the runtime's print_* functions take.
+func (block *Block) buildPrint(expr ast.Expr, val TypedValue) *GoDiag {
+	switch ty := val.Type().Base().(type) {
+	case *IntType:
+		if ty.Signed() {
+			int64Ty := global_type_factory.IntType(BLTN_TY_INT64).(*IntType)
+			block.buildRuntimeCall("print_int", block.buildIntResize(val.LLVM(), ty, int64Ty))
+		} else {
+			uint64Ty := global_type_factory.IntType(BLTN_TY_UINT64).(*IntType)
+			block.buildRuntimeCall("print_uint", block.buildIntResize(val.LLVM(), ty, uint64Ty))
+		}
+	case *FloatType:
+		block.buildRuntimeCall("print_float", block.buildFloatWiden(val.LLVM(), ty))
+	case *ComplexType:
+		re, im := block.splitComplex(val.LLVM())
+		partTy := ty.PartType()
+		block.buildRuntimeCall("print_complex", block.buildFloatWiden(re, partTy), block.buildFloatWiden(im, partTy))
+	case *StringType:
+		ptr, length := block.splitString(val.LLVM())
+		block.buildRuntimeCall("print_string", ptr, length)
+	case *BoolType:
+		uint8Ty := global_type_factory.IntType(BLTN_TY_UINT8)
+		block.buildRuntimeCall("print_bool", block.Builder.BuildZExt(val.LLVM(), uint8Ty.LLVM(), ""))
+	default:
+		return DiagFromAST(expr, "Cannot print a value of type %s.", val.Type().String())
+	}
+	return nil
+}
+
+// extends a float to a float64, if it isn't one already.
+func (block *Block) buildFloatWiden(val llvm.Value, ty *FloatType) llvm.Value {
+	if ty.BitWidth() < 64 {
+		return block.Builder.BuildFPExt(val, global_type_factory.FloatType(BLTN_TY_FLOAT64).LLVM(), "")
+	}
+	return val
+}
+
+func (block *Block) buildRuntimeCall(name string, args ...llvm.Value) llvm.Value {
+	fn := block.Trans.runtimeFunction(name)
+	return block.Builder.BuildCall(fn.LLVM(), args, "")
+}
@@ -0,0 +1,182 @@
+package main
+
+import "go/ast"
+import "llvm"
+import "strconv"
+
+/*
+ * A function value is a closure: a pointer to its code, and a pointer to its
+ * context, which holds a pointer to each variable it captured. The code takes
+ * the context as a hidden first parameter. Captured variables live on the
+ * heap (see escapingNames), so they outlive the functions that declared them.
+ */
+
+/*
+ * The state of a function literal being translated. A variable of an
+ * enclosing function is captured the first time the literal uses it.
+ */
+type Closure struct {
+	// the literal's outermost scope; variables bound outside of it are captured.
+	Scope *Scope
+	Body  *Block
+	Ctx   llvm.Value
+	// the captured variables, as the enclosing function sees them, in the
+	// order their pointers are stored in the context.
+	Captures []*Variable
+	captured map[*Variable]*Variable
+}
+
+// the signature of the code of a closure of type `fnTy`.
+func closureSignature(fnTy *FuncType) *FuncType {
+	return &FuncType{append([]Type{&PointerType{global_type_factory.IntType(BLTN_TY_UINT8)}}, fnTy.Params...), fnTy.Result}
+}
+
+// the signature of values of type `ty`, or nil if they aren't functions.
+func funcTypeOf(ty Type) *FuncType {
+	if named, ok := ty.(*NamedType); ok {
+		ty = named.Underlying
+	}
+	fnTy, _ := ty.(*FuncType)
+	return fnTy
+}
+
+// the translator for the whole file; function literals get translators of their own.
+func (trans *Translator) root() *Translator {
+	for trans.Parent != nil {
+		trans = trans.Parent
+	}
+	return trans
+}
+
+/*
+ * lookupVar looks up the value bound to `ident`. A variable of an enclosing
+ * function is captured.
+ */
+func (block *Block) lookupVar(ident string) *BoundVar {
+	bound, scope := block.Scope.lookupVarScope(ident)
+	if bound == nil {
+		return nil
+	}
+	if variable, ok := bound.Val.(*Variable); ok {
+		if captured := block.Trans.capture(variable, scope); captured != variable {
+			return &BoundVar{bound.Ident, bound.Const, captured}
+		}
+	}
+	return bound
+}
+
+/*
+ * capture returns the variable `v`, which is bound in `scope`, as the function
+ * being translated sees it. If it belongs to an enclosing function, its
+ * pointer is loaded from the context; the enclosing function may in turn have
+ * to capture it from its own context.
+ */
+func (trans *Translator) capture(v *Variable, scope *Scope) *Variable {
+	closure := trans.Closure
+	if closure == nil || scope.within(closure.Scope) {
+		return v
+	}
+	if captured, ok := closure.captured[v]; ok {
+		return captured
+	}
+	outer := trans.Parent.capture(v, scope)
+	idx := len(closure.Captures)
+	closure.Captures = append(closure.Captures, outer)
+
+	// the pointer is loaded on entry, so that it's available everywhere.
+	builder := llvm.CreateBuilder()
+	defer builder.Dispose()
+	positionAtStart(builder, closure.Body.Entry)
+	slots := builder.BuildBitCast(closure.Ctx, llvm.PointerType(bytePtrType(), 0), "")
+	slot := builder.BuildGEP(slots, []llvm.Value{llvm.ConstInt(llvm.IntType(32), uint64(idx), false)}, "")
+	ptr := builder.BuildBitCast(builder.BuildLoad(slot, ""), llvm.PointerType(MemLLVM(v.Ty), 0), "")
+	captured := &Variable{v.Ty, ptr, closure.Body.Builder}
+	closure.captured[v] = captured
+	return captured
+}
+
+/*
+ * translateFuncLit translates the function literal `lit` into a function of
+ * its own, using a translator whose Parent is this block's. The closure's
+ * context is built once the body has been translated, when it's known which
+ * variables were captured.
+ */
+func (block *Block) translateFuncLit(lit *ast.FuncLit) (UntypedValue, *GoDiag) {
+	fnTy, diag := block.Trans.translateFuncType(block.Scope, lit.Type)
+	if diag != nil {
+		return nil, diag
+	}
+	trans := block.Trans
+	trans.Literals[block.FnName]++
+	name := block.FnName + ".func" + strconv.Itoa(trans.Literals[block.FnName])
+	sig := closureSignature(fnTy)
+	llvmFn := trans.mod.AddFunction(name, sig.LLVMSignature())
+	llvm.SetLinkage(llvmFn, llvm.InternalLinkage)
+
+	inner := *trans
+	inner.Parent = trans
+	inner.Scope = block.Scope
+	body := inner.CreateBlockForFunction(&FuncValue{name, sig, llvmFn})
+	body.Escaping = escapingNames(lit.Body)
+	inner.Closure = &Closure{body.Scope, body, llvm.GetParam(llvmFn, 0), nil, make(map[*Variable]*Variable)}
+	if diag := body.declareParams(lit.Type.Params, sig, 1); diag != nil {
+		return nil, diag
+	}
+	if diag := body.translateFuncBody(lit.Body); diag != nil {
+		return nil, diag
+	}
+
+	ctx := llvm.ConstPointerNull(bytePtrType())
+	if captures := inner.Closure.Captures; len(captures) > 0 {
+		intTy := global_type_factory.IntType(BLTN_TY_INT).LLVM()
+		size := trans.Target.AllocSize(bytePtrType()) * uint64(len(captures))
+		ctx = block.buildRuntimeCall("gogo_alloc", llvm.ConstInt(intTy, size, false))
+		slots := block.Builder.BuildBitCast(ctx, llvm.PointerType(bytePtrType(), 0), "")
+		for i, captured := range captures {
+			slot := block.Builder.BuildGEP(slots, []llvm.Value{llvm.ConstInt(llvm.IntType(32), uint64(i), false)}, "")
+			block.Builder.BuildStore(block.buildBytePtr(captured.Ptr), slot)
+		}
+	}
+	closure := llvm.Undef(fnTy.LLVM())
+	closure = block.Builder.BuildInsertValue(closure, trans.constBytePtr(llvmFn), 0, "")
+	closure = block.Builder.BuildInsertValue(closure, ctx, 1, "")
+	return &Register{fnTy, closure}, nil
+}
+
+/*
+ * funcClosure returns the closure for the declared function `fn`. It has no
+ * context, and its code is a wrapper that ignores the context and calls `fn`.
+ */
+func (trans *Translator) funcClosure(fn *FuncValue) llvm.Value {
+	wrapper, ok := trans.FuncWrappers[fn]
+	if !ok {
+		wrapper = trans.mod.AddFunction(fn.Name+"$closure", closureSignature(fn.Ty).LLVMSignature())
+		llvm.SetLinkage(wrapper, llvm.InternalLinkage)
+		trans.FuncWrappers[fn] = wrapper
+
+		builder := llvm.CreateBuilder()
+		defer builder.Dispose()
+		builder.PositionBuilderAtEnd(llvm.AppendBasicBlock(wrapper, "entry"))
+		args := make([]llvm.Value, len(fn.Ty.Params))
+		for i := range args {
+			args[i] = llvm.GetParam(wrapper, uint(i+1))
+		}
+		result := builder.BuildCall(fn.LLVM(), args, "")
+		if fn.Ty.Result == nil {
+			builder.BuildRetVoid()
+		} else {
+			builder.BuildRet(result)
+		}
+	}
+	return llvm.ConstStruct([]llvm.Value{trans.constBytePtr(wrapper), llvm.ConstPointerNull(bytePtrType())}, false)
+}
+
+// calls the closure `fn`, whose type is `fnTy`, passing its context first.
+func (block *Block) buildClosureCall(call *ast.CallExpr, fn TypedValue, fnTy *FuncType) (UntypedValue, *GoDiag) {
+	code := block.Builder.BuildExtractValue(fn.LLVM(), 0, "")
+	ctx := block.Builder.BuildExtractValue(fn.LLVM(), 1, "")
+	block.buildNilCheck(code)
+	sig := closureSignature(fnTy)
+	code = block.Builder.BuildBitCast(code, llvm.PointerType(sig.LLVMSignature(), 0), "")
+	return block.buildCall(call, &FuncValue{"", sig, code}, ctx)
+}
@@ -32,6 +32,10 @@ func (err *CmdErr) Msg() string {
 	return "Command exited with non-zero status."
 }
 
+func (err *CmdErr) Hint() string {
+	return ""
+}
+
 func (stage *CmdStage) Run() Diag {
 	cmd := exec.Command(stage.Cmd, stage.Args...)
 	out, err := cmd.CombinedOutput()
@@ -41,15 +45,23 @@ func (stage *CmdStage) Run() Diag {
 	return nil
 }
 
-func CreateLLCStage(input string, output string) *CmdStage {
+func CreateLLCStage(input string, output string, target Target) *CmdStage {
 	cmd := "llc"
-	args := []string{"-filetype=obj", "-o=" + output, input}
+	args := []string{"-mtriple=" + target.Triple, "-relocation-model=" + target.RelocModel(), "-filetype=obj", "-o=" + output, input}
 	return CreateCmdStage(cmd, args)
 }
 
-func CreateLinkStage(inputs []string, output string) *CmdStage {
+func CreateLinkStage(inputs []string, output string, target Target) *CmdStage {
+	if target.IsWasm() {
+		// the runtime provides _start, and wasm-ld exports it and the memory.
+		cmd := "wasm-ld"
+		args := append([]string{"--entry=_start"}, inputs...)
+		args = append(args, "-o", output)
+		return CreateCmdStage(cmd, args)
+	}
 	cmd := "clang"
-	args := append(inputs, "-o", output)
+	args := append([]string{"--target=" + target.Triple}, inputs...)
+	args = append(args, "-o", output)
 	return CreateCmdStage(cmd, args)
 }
 
@@ -0,0 +1,74 @@
+package main
+
+import "os"
+
+const (
+	COLOR_AUTO uint = iota
+	COLOR_ALWAYS
+	COLOR_NEVER
+)
+
+// ANSI escape sequences used when printing diagnostics.
+const (
+	ANSI_RESET = "\x1b[0m"
+	ANSI_BOLD  = "\x1b[1m"
+	ANSI_DIM   = "\x1b[2m"
+	ANSI_RED   = "\x1b[31m"
+	ANSI_GREEN = "\x1b[32m"
+	ANSI_CYAN  = "\x1b[36m"
+)
+
+// whether diagnostics are currently printed with color; see SetColorMode.
+var diagColor = false
+
+func ParseColorMode(mode string) (uint, bool) {
+	switch mode {
+	case "auto":
+		return COLOR_AUTO, true
+	case "always":
+		return COLOR_ALWAYS, true
+	case "never":
+		return COLOR_NEVER, true
+	}
+	return COLOR_AUTO, false
+}
+
+/*
+ * SetColorMode decides whether diagnostics are colored.
+ *
+ * `always` and `never` are honored as given. `auto` colors output only when
+ * stderr, where diagnostics are printed, is a terminal, TERM isn't "dumb",
+ * and NO_COLOR is unset or empty (see https://no-color.org).
+ */
+func SetColorMode(mode uint) {
+	switch mode {
+	case COLOR_ALWAYS:
+		diagColor = true
+	case COLOR_NEVER:
+		diagColor = false
+	case COLOR_AUTO:
+		diagColor = os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && isTerminal(os.Stderr)
+	default:
+		panic("Bad internal state! (Unknown color mode!)")
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// wraps `str` in the given escape sequences, if colored output is enabled.
+func colorize(str string, codes ...string) string {
+	if !diagColor || len(str) == 0 {
+		return str
+	}
+	prefix := ""
+	for _, code := range codes {
+		prefix += code
+	}
+	return prefix + str + ANSI_RESET
+}
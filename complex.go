@@ -0,0 +1,172 @@
+package main
+
+import "go/ast"
+import "go/token"
+import "llvm"
+import "math/big"
+
+// builds the complex value { re, im } of type `ty`.
+func (block *Block) buildComplex(ty Type, re llvm.Value, im llvm.Value) llvm.Value {
+	agg := llvm.Undef(ty.LLVM())
+	agg = block.Builder.BuildInsertValue(agg, re, 0, "")
+	return block.Builder.BuildInsertValue(agg, im, 1, "")
+}
+
+// splits a complex value into its real and imaginary parts.
+func (block *Block) splitComplex(val llvm.Value) (llvm.Value, llvm.Value) {
+	re := block.Builder.BuildExtractValue(val, 0, "")
+	im := block.Builder.BuildExtractValue(val, 1, "")
+	return re, im
+}
+
+/*
+ * Complex arithmetic on runtime values. As in gc, complex64 products and
+ * quotients are computed in float64 precision and then rounded back, so both
+ * complex types give the same results for values they can both represent.
+ */
+func (block *Block) buildComplexArith(expr *ast.BinaryExpr, ty Type, x TypedValue, y TypedValue) (TypedValue, *GoDiag) {
+	builder := block.Builder
+	complexTy, _ := ty.Base().(*ComplexType)
+	partTy := complexTy.PartType()
+	a, b := block.splitComplex(x.LLVM())
+	c, d := block.splitComplex(y.LLVM())
+
+	switch expr.Op {
+	case token.ADD:
+		re := builder.BuildFAdd(a, c, "")
+		im := builder.BuildFAdd(b, d, "")
+		return &Register{ty, block.buildComplex(ty, re, im)}, nil
+	case token.SUB:
+		re := builder.BuildFSub(a, c, "")
+		im := builder.BuildFSub(b, d, "")
+		return &Register{ty, block.buildComplex(ty, re, im)}, nil
+	case token.MUL, token.QUO:
+		float64Ty := global_type_factory.FloatType(BLTN_TY_FLOAT64)
+		widen := partTy.BitWidth() < 64
+		if widen {
+			a = builder.BuildFPExt(a, float64Ty.LLVM(), "")
+			b = builder.BuildFPExt(b, float64Ty.LLVM(), "")
+			c = builder.BuildFPExt(c, float64Ty.LLVM(), "")
+			d = builder.BuildFPExt(d, float64Ty.LLVM(), "")
+		}
+		var re, im llvm.Value
+		if expr.Op == token.MUL {
+			// (a+bi)(c+di) = (ac-bd) + (ad+bc)i
+			re = builder.BuildFSub(builder.BuildFMul(a, c, ""), builder.BuildFMul(b, d, ""), "")
+			im = builder.BuildFAdd(builder.BuildFMul(a, d, ""), builder.BuildFMul(b, c, ""), "")
+		} else {
+			re, im = block.buildComplexDivide(a, b, c, d)
+		}
+		if widen {
+			re = builder.BuildFPTrunc(re, partTy.LLVM(), "")
+			im = builder.BuildFPTrunc(im, partTy.LLVM(), "")
+		}
+		return &Register{ty, block.buildComplex(ty, re, im)}, nil
+	}
+	return nil, DiagFromAST(expr, "Operator %s is not defined on type %s.", expr.Op, ty.String())
+}
+
+/*
+ * Complex division is left to the runtime, which follows Go's algorithm
+ * exactly, infinities and NaNs included. The quotient comes back through a
+ * pair of out-parameters.
+ */
+func (block *Block) buildComplexDivide(a llvm.Value, b llvm.Value, c llvm.Value, d llvm.Value) (llvm.Value, llvm.Value) {
+	float64Ty := global_type_factory.FloatType(BLTN_TY_FLOAT64).LLVM()
+	rePtr := block.buildAlloca(float64Ty, "quo.re")
+	imPtr := block.buildAlloca(float64Ty, "quo.im")
+	fn := block.Trans.runtimeFunction("gogo_complex128_div")
+	block.Builder.BuildCall(fn.LLVM(), []llvm.Value{a, b, c, d, rePtr, imPtr}, "")
+	return block.Builder.BuildLoad(rePtr, ""), block.Builder.BuildLoad(imPtr, "")
+}
+
+// builds `x == y` or `x != y` on complex values, comparing both parts.
+func (block *Block) buildComplexEq(op token.Token, x TypedValue, y TypedValue) llvm.Value {
+	builder := block.Builder
+	a, b := block.splitComplex(x.LLVM())
+	c, d := block.splitComplex(y.LLVM())
+	pred := floatPredicate(op)
+	re := builder.BuildFCmp(pred, a, c, "")
+	im := builder.BuildFCmp(pred, b, d, "")
+	if op == token.EQL {
+		return builder.BuildAnd(re, im, "")
+	}
+	return builder.BuildOr(re, im, "")
+}
+
+// negates both parts of a complex value.
+func (block *Block) buildComplexNeg(val TypedValue) TypedValue {
+	re, im := block.splitComplex(val.LLVM())
+	re = block.Builder.BuildFNeg(re, "")
+	im = block.Builder.BuildFNeg(im, "")
+	return &Register{val.Type(), block.buildComplex(val.Type(), re, im)}
+}
+
+func isComplexConst(val UntypedValue) bool {
+	_, ok := val.(*ConstComplex)
+	return ok
+}
+
+// returns the exact value of a numeric untyped constant, as a complex number.
+func constComplexParts(val UntypedValue) (*big.Rat, *big.Rat, bool) {
+	if cnst, ok := val.(*ConstComplex); ok {
+		return cnst.Re, cnst.Im, true
+	}
+	re, ok := constRat(val)
+	if !ok {
+		return nil, nil, false
+	}
+	return re, new(big.Rat), true
+}
+
+// evaluates arithmetic on untyped constants where at least one is complex.
+func foldComplexArith(expr *ast.BinaryExpr, x UntypedValue, y UntypedValue) (UntypedValue, *GoDiag) {
+	a, b, xOk := constComplexParts(x)
+	c, d, yOk := constComplexParts(y)
+	if !xOk || !yOk {
+		return nil, DiagFromAST(expr, "Operator %s is not defined on constants %s and %s.", expr.Op, x.String(), y.String())
+	}
+	re := new(big.Rat)
+	im := new(big.Rat)
+	switch expr.Op {
+	case token.ADD:
+		re.Add(a, c)
+		im.Add(b, d)
+	case token.SUB:
+		re.Sub(a, c)
+		im.Sub(b, d)
+	case token.MUL:
+		re.Sub(new(big.Rat).Mul(a, c), new(big.Rat).Mul(b, d))
+		im.Add(new(big.Rat).Mul(a, d), new(big.Rat).Mul(b, c))
+	case token.QUO:
+		// (a+bi)/(c+di) = ((ac+bd) + (bc-ad)i) / (c²+d²)
+		denom := new(big.Rat).Add(new(big.Rat).Mul(c, c), new(big.Rat).Mul(d, d))
+		if denom.Sign() == 0 {
+			return nil, DiagFromAST(expr.Y, "Division by zero.")
+		}
+		re.Add(new(big.Rat).Mul(a, c), new(big.Rat).Mul(b, d))
+		re.Quo(re, denom)
+		im.Sub(new(big.Rat).Mul(b, c), new(big.Rat).Mul(a, d))
+		im.Quo(im, denom)
+	default:
+		return nil, DiagFromAST(expr, "Operator %s is not defined on untyped complex constants.", expr.Op)
+	}
+	return &ConstComplex{re, im}, nil
+}
+
+// compares untyped constants where at least one is complex; only == and != apply.
+func compareComplexConsts(expr *ast.BinaryExpr, x UntypedValue, y UntypedValue) (UntypedValue, *GoDiag) {
+	a, b, xOk := constComplexParts(x)
+	c, d, yOk := constComplexParts(y)
+	if !xOk || !yOk {
+		return nil, DiagFromAST(expr, "Mismatched constants %s and %s.", x.String(), y.String())
+	}
+	equal := a.Cmp(c) == 0 && b.Cmp(d) == 0
+	switch expr.Op {
+	case token.EQL:
+		return &ConstBool{equal}, nil
+	case token.NEQ:
+		return &ConstBool{!equal}, nil
+	}
+	return nil, DiagFromAST(expr, "Operator %s is not defined on untyped complex constants.", expr.Op)
+}
@@ -0,0 +1,116 @@
+package main
+
+import "go/ast"
+import "llvm"
+
+/*
+ * translateCompositeLit translates a composite literal like `[3]int{1, 2, 3}`.
+ * `ty` is the type the literal must have when its own type was elided, as for
+ * the inner literals of `[2][2]int{{1, 2}, {3, 4}}`; otherwise it is nil.
+ */
+func (block *Block) translateCompositeLit(lit *ast.CompositeLit, ty Type) (UntypedValue, *GoDiag) {
+	if ty == nil {
+		if lit.Type == nil {
+			return nil, DiagFromAST(lit, "Missing type in composite literal.")
+		}
+		// [...]T takes its length from the literal, so it isn't a type by itself.
+		if arr, ok := lit.Type.(*ast.ArrayType); ok && arr.Len != nil {
+			if _, ok := arr.Len.(*ast.Ellipsis); ok {
+				elemTy, diag := block.translateType(arr.Elt)
+				if diag != nil {
+					return nil, diag
+				}
+				return block.translateArrayLit(lit, nil, elemTy, -1)
+			}
+		}
+		var diag *GoDiag
+		ty, diag = block.translateType(lit.Type)
+		if diag != nil {
+			return nil, diag
+		}
+	}
+
+	switch base := ty.Base().(type) {
+	case *ArrayType:
+		return block.translateArrayLit(lit, ty, base.Elem, base.Len)
+	case *SliceType:
+		return block.translateSliceLit(lit, ty, base)
+	case *StructType:
+		return block.translateStructLit(lit, ty, base)
+	case *MapType:
+		return block.translateMapLit(lit, ty, base)
+	}
+	return nil, DiagFromAST(lit, "Invalid composite literal type %s.", ty.String())
+}
+
+// translates one element of a composite literal, which should have type `ty`.
+func (block *Block) translateElement(expr ast.Expr, ty Type) (TypedValue, *GoDiag) {
+	if lit, ok := expr.(*ast.CompositeLit); ok && lit.Type == nil {
+		val, diag := block.translateCompositeLit(lit, ty)
+		if diag != nil {
+			return nil, diag
+		}
+		typed, udiag := val.RValue(nil)
+		if udiag != nil {
+			return nil, BindDiagToAST(expr, *udiag)
+		}
+		return typed, nil
+	}
+	return block.translateExprRHSTyped(expr, ty)
+}
+
+/*
+ * translateArrayLit builds an array literal. Elements are either positional or
+ * keyed by a constant index, and positions carry on from the last key, as in
+ * `[5]int{1, 3: 4, 5}`. Elements that aren't given are zero. A `length` of -1
+ * means `[...]T`, whose length is one more than the highest index used.
+ */
+func (block *Block) translateArrayLit(lit *ast.CompositeLit, ty Type, elemTy Type, length int64) (UntypedValue, *GoDiag) {
+	indices := make([]int64, len(lit.Elts))
+	values := make([]ast.Expr, len(lit.Elts))
+	seen := make(map[int64]bool)
+	var next, maxLen int64 = 0, 0
+	for i, elt := range lit.Elts {
+		valueExpr := elt
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			key, diag := block.translateIndex(kv.Key)
+			if diag != nil {
+				return nil, diag
+			}
+			idx, ok := constIndex(key)
+			if !ok {
+				return nil, DiagFromAST(kv.Key, "Index in array literal must be a constant.")
+			}
+			next = idx.Int64()
+			valueExpr = kv.Value
+		}
+		if length >= 0 && next >= length {
+			return nil, DiagFromAST(elt, "Index %d out of range for array of length %d.", next, length)
+		}
+		if seen[next] {
+			return nil, DiagFromAST(elt, "Duplicate index %d in array literal.", next)
+		}
+		seen[next] = true
+		indices[i] = next
+		values[i] = valueExpr
+		next++
+		if next > maxLen {
+			maxLen = next
+		}
+	}
+	if ty == nil {
+		ty = &ArrayType{elemTy, maxLen}
+	}
+
+	// constant elements fold into a constant aggregate as they're inserted.
+	agg := llvm.ConstNull(ty.LLVM())
+	for i, valueExpr := range values {
+		val, diag := block.translateElement(valueExpr, elemTy)
+		if diag != nil {
+			return nil, diag
+		}
+		elem := buildToMem(block.Builder, elemTy, val.LLVM())
+		agg = block.Builder.BuildInsertValue(agg, elem, uint(indices[i]), "")
+	}
+	return &Register{ty, agg}, nil
+}
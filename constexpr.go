@@ -0,0 +1,291 @@
+package main
+
+import "go/ast"
+import "go/token"
+import "math/big"
+
+// reports whether `val` is an untyped constant.
+func isConstValue(val UntypedValue) bool {
+	switch val.(type) {
+	case *ConstInt, *ConstFloat, *ConstComplex, *ConstBool, *ConstString:
+		return true
+	}
+	return false
+}
+
+/*
+ * isConstExpr reports whether `expr` is made up only of literals, untyped
+ * constants, and operators on them. Such an expression folds to a constant
+ * without emitting any code, so it can be evaluated outside of a function,
+ * e.g. in an array length.
+ */
+func isConstExpr(scope *Scope, expr ast.Expr) bool {
+	switch constExpr := expr.(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.ParenExpr:
+		return isConstExpr(scope, constExpr.X)
+	case *ast.Ident:
+		bound := scope.lookupVar(constExpr.Name)
+		return bound != nil && isConst(bound.Val)
+	case *ast.UnaryExpr:
+		switch constExpr.Op {
+		case token.ADD, token.SUB, token.NOT, token.XOR:
+			return isConstExpr(scope, constExpr.X)
+		}
+	case *ast.BinaryExpr:
+		return isConstExpr(scope, constExpr.X) && isConstExpr(scope, constExpr.Y)
+	case *ast.CallExpr:
+		// a conversion like `int64(1)` or `Weekday(iota)`.
+		return len(constExpr.Args) == 1 && isConstTypeExpr(scope, constExpr.Fun) && isConstExpr(scope, constExpr.Args[0])
+	}
+	return false
+}
+
+// reports whether `expr` names a boolean, numeric or string type.
+func isConstTypeExpr(scope *Scope, expr ast.Expr) bool {
+	switch tyExpr := expr.(type) {
+	case *ast.ParenExpr:
+		return isConstTypeExpr(scope, tyExpr.X)
+	case *ast.Ident:
+		if scope.lookupVar(tyExpr.Name) != nil {
+			return false
+		}
+		ty := scope.lookupType(tyExpr.Name)
+		if named, ok := ty.(*NamedType); ok && named.Underlying == nil {
+			// still being declared.
+			return false
+		}
+		return ty != nil && isConstType(ty)
+	}
+	return false
+}
+
+// reports whether constants may have type `ty`.
+func isConstType(ty Type) bool {
+	switch ty.Base().(type) {
+	case *IntType, *FloatType, *ComplexType, *BoolType, *StringType:
+		return true
+	}
+	return false
+}
+
+/*
+ * constParts splits the constant `val` into its untyped value and its type,
+ * which is nil if it's untyped. The last result is false if `val` isn't a
+ * constant.
+ */
+func constParts(val UntypedValue) (UntypedValue, Type, bool) {
+	switch cnst := val.(type) {
+	case *TypedConstInt:
+		inner := cnst.Inner
+		return &inner, cnst.Ty, true
+	case *TypedConstFloat:
+		inner := cnst.Inner
+		return &inner, cnst.Ty, true
+	case *TypedConstComplex:
+		inner := cnst.Inner
+		return &inner, cnst.Ty, true
+	case *TypedConstBool:
+		inner := cnst.Inner
+		return &inner, cnst.Ty, true
+	case *TypedConstString:
+		inner := cnst.Inner
+		return &inner, cnst.Ty, true
+	}
+	return val, nil, isConstValue(val)
+}
+
+// reports whether `val` is a constant, typed or not.
+func isConst(val UntypedValue) bool {
+	_, _, ok := constParts(val)
+	return ok
+}
+
+/*
+ * unifyConsts gives the constants `x` and `y`, at least one of which is
+ * typed, the same type, and returns their untyped values along with it. The
+ * untyped one must be representable in the type, so e.g. 0.5 can't be added
+ * to an int constant.
+ */
+func unifyConsts(expr *ast.BinaryExpr, x UntypedValue, y UntypedValue) (UntypedValue, UntypedValue, Type, *GoDiag) {
+	_, xTy, _ := constParts(x)
+	_, yTy, _ := constParts(y)
+	ty := xTy
+	if ty == nil {
+		ty = yTy
+	}
+	if yTy != nil && !yTy.Eq(ty) {
+		return nil, nil, nil, DiagFromAST(expr, "Mismatched types %s and %s.", ty.String(), yTy.String())
+	}
+	xTyped, udiag := x.RValue(ty)
+	if udiag != nil {
+		return nil, nil, nil, BindDiagToAST(expr.X, *udiag)
+	}
+	yTyped, udiag := y.RValue(ty)
+	if udiag != nil {
+		return nil, nil, nil, BindDiagToAST(expr.Y, *udiag)
+	}
+	xInner, _, _ := constParts(xTyped)
+	yInner, _, _ := constParts(yTyped)
+	return xInner, yInner, ty, nil
+}
+
+// evaluates the constant expression `expr` in `scope`.
+func (trans *Translator) evalConstExpr(scope *Scope, expr ast.Expr) (UntypedValue, *GoDiag) {
+	if !isConstExpr(scope, expr) {
+		return nil, DiagFromAST(expr, "Expected a constant expression.")
+	}
+	// there's nothing to build, so the block doesn't need a builder.
+	block := &Block{Scope: scope, Trans: trans}
+	return block.translateOperand(expr)
+}
+
+// evaluates the length of an array type, which must be a non-negative constant.
+func (trans *Translator) translateArrayLen(scope *Scope, expr ast.Expr) (int64, *GoDiag) {
+	val, diag := trans.evalConstExpr(scope, expr)
+	if diag != nil {
+		return 0, DiagFromAST(expr, "Array length must be a constant expression.")
+	}
+	// any integer constant will do, whatever its type.
+	val, _, _ = constParts(val)
+	typed, udiag := val.RValue(global_type_factory.IntType(BLTN_TY_INT))
+	if udiag != nil {
+		return 0, BindDiagToAST(expr, *udiag)
+	}
+	length, _ := typed.(*TypedConstInt)
+	if length.Inner.Int.Sign() < 0 {
+		return 0, DiagFromAST(expr, "Array length %s must not be negative.", length.Inner.Int.String())
+	}
+	if !length.Inner.Int.IsInt64() {
+		return 0, DiagFromAST(expr, "Array length %s is too large.", length.Inner.Int.String())
+	}
+	return length.Inner.Int.Int64(), nil
+}
+
+// returns `n` as a constant int.
+func constIntValue(n int64) *TypedConstInt {
+	return &TypedConstInt{ConstInt{big.NewInt(n), true, false}, global_type_factory.IntType(BLTN_TY_INT)}
+}
+
+// one spec of a `const` declaration, with any values it repeats filled in.
+type constSpec struct {
+	Names  []*ast.Ident
+	Type   ast.Expr
+	Values []ast.Expr
+	Iota   int64
+}
+
+/*
+ * constSpecs returns the specs of a `const` declaration. A spec without values
+ * repeats the type and values of the one before it; `iota` is its index.
+ */
+func constSpecs(gen *ast.GenDecl) ([]*constSpec, *GoDiag) {
+	specs := make([]*constSpec, len(gen.Specs))
+	var tyExpr ast.Expr
+	var values []ast.Expr
+	for i, spec := range gen.Specs {
+		valueSpec, ok := spec.(*ast.ValueSpec)
+		assert(ok, "Expected *ast.ValueSpec, but got different type!")
+		if len(valueSpec.Values) > 0 {
+			tyExpr, values = valueSpec.Type, valueSpec.Values
+		} else if valueSpec.Type != nil || values == nil {
+			return nil, DiagFromAST(valueSpec, "Constant declaration needs a value.")
+		}
+		if len(valueSpec.Names) != len(values) {
+			return nil, DiagFromAST(valueSpec, "Constant declaration has %d names but %d values.", len(valueSpec.Names), len(values))
+		}
+		specs[i] = &constSpec{valueSpec.Names, tyExpr, values, int64(i)}
+	}
+	return specs, nil
+}
+
+// binds the constants of `spec` in `scope`.
+func (trans *Translator) declareConst(scope *Scope, spec *constSpec) *GoDiag {
+	var ty Type
+	if spec.Type != nil {
+		var diag *GoDiag
+		ty, diag = trans.translateType(scope, spec.Type)
+		if diag != nil {
+			return diag
+		}
+		if !isConstType(ty) {
+			return DiagFromAST(spec.Type, "Constants can't have type %s.", ty.String())
+		}
+	}
+
+	// iota is only bound while the values are evaluated.
+	iotaScope := CreateScope()
+	iotaScope.Parent = scope
+	iotaScope.addValue("iota", &ConstInt{big.NewInt(spec.Iota), true, false})
+	vals := make([]UntypedValue, len(spec.Names))
+	for i, expr := range spec.Values {
+		val, diag := trans.evalConstExpr(iotaScope, expr)
+		if diag != nil {
+			return diag
+		}
+		if ty != nil {
+			typed, udiag := val.RValue(ty)
+			if udiag != nil {
+				return BindDiagToAST(expr, *udiag)
+			}
+			val = typed
+		}
+		vals[i] = val
+	}
+
+	// check the names first, so that the spec is either declared or not.
+	for _, name := range spec.Names {
+		if _, exists := (*scope.Values)[name.Name]; exists {
+			return DiagFromAST(name, "\"%s\" is already declared.", name.Name)
+		}
+	}
+	for i, name := range spec.Names {
+		if name.Name == "_" {
+			continue
+		}
+		if !scope.addConst(name.Name, vals[i]) {
+			return DiagFromAST(name, "\"%s\" is already declared.", name.Name)
+		}
+	}
+	return nil
+}
+
+/*
+ * declarePackageConsts binds the package-level constants of `specs`, which
+ * may refer to each other in any order, as long as they don't do so in a
+ * cycle. Constants that can't be declared yet, e.g. because their type hasn't
+ * been declared, are returned with the reason the first of them failed.
+ */
+func (trans *Translator) declarePackageConsts(specs []*constSpec) ([]*constSpec, *GoDiag) {
+	for {
+		var remaining []*constSpec
+		var first *GoDiag
+		for _, spec := range specs {
+			if diag := trans.declareConst(trans.Scope, spec); diag != nil {
+				remaining = append(remaining, spec)
+				if first == nil {
+					first = diag
+				}
+			}
+		}
+		if len(remaining) == 0 || len(remaining) == len(specs) {
+			return remaining, first
+		}
+		specs = remaining
+	}
+}
+
+// translates a `const` declaration inside a function.
+func (block *Block) translateConstDecl(gen *ast.GenDecl) *GoDiag {
+	specs, diag := constSpecs(gen)
+	if diag != nil {
+		return diag
+	}
+	for _, spec := range specs {
+		if diag := block.Trans.declareConst(block.Scope, spec); diag != nil {
+			return diag
+		}
+	}
+	return nil
+}
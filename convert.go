@@ -0,0 +1,205 @@
+package main
+
+import "go/ast"
+import "llvm"
+
+/*
+ * typeOfExpr returns the type named by `expr` if it is a type expression
+ * (e.g. the `float64` in `float64(x)`), or nil if it's a value.
+ */
+func (block *Block) typeOfExpr(expr ast.Expr) (Type, *GoDiag) {
+	switch typeExpr := expr.(type) {
+	case *ast.Ident:
+		if block.Scope.lookupVar(typeExpr.Name) != nil {
+			return nil, nil
+		}
+		ty := block.Scope.lookupType(typeExpr.Name)
+		if _, ok := ty.(*GenericType); ok {
+			return nil, DiagFromAST(typeExpr, "Generic type %s must be instantiated.", typeExpr.Name)
+		}
+		return ty, nil
+	case *ast.ParenExpr:
+		return block.typeOfExpr(typeExpr.X)
+	case *ast.StarExpr:
+		at, diag := block.typeOfExpr(typeExpr.X)
+		if at == nil || diag != nil {
+			return nil, diag
+		}
+		return &PointerType{at}, nil
+	case *ast.ArrayType, *ast.StructType, *ast.InterfaceType, *ast.MapType, *ast.FuncType:
+		// can only be a type.
+		return block.translateType(typeExpr)
+	case *ast.SelectorExpr:
+		if pkg := packageOf(block.Scope, typeExpr.X); pkg != nil {
+			return pkg.Types[typeExpr.Sel.Name], nil
+		}
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		// `List[int]` is a type, but `xs[i]` isn't.
+		base, _ := splitIndices(typeExpr)
+		if ident, ok := base.(*ast.Ident); ok && block.Scope.lookupVar(ident.Name) == nil {
+			if _, ok := block.Scope.lookupType(ident.Name).(*GenericType); ok {
+				return block.translateType(typeExpr)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// translates the conversion `ty(x)`.
+func (block *Block) translateConversion(call *ast.CallExpr, ty Type) (TypedValue, *GoDiag) {
+	if len(call.Args) != 1 {
+		return nil, DiagFromAST(call, "Conversion to %s takes exactly one argument.", ty.String())
+	}
+	arg := call.Args[0]
+	val, diag := block.translateOperand(arg)
+	if diag != nil {
+		return nil, diag
+	}
+
+	// anything converts to an interface it implements, as in an assignment.
+	if _, ok := ty.Base().(*InterfaceType); ok {
+		return block.assignTo(arg, val, ty)
+	}
+
+	// converting a typed constant gives a constant too.
+	if inner, cnstTy, ok := constParts(val); ok && cnstTy != nil && isConstType(ty) {
+		val = inner
+	}
+
+	// string(r) is the UTF-8 encoding of the rune r.
+	if cnst, ok := val.(*ConstInt); ok && isStringType(ty) {
+		str := &ConstString{runeString(cnst.Int), block.Trans.LLns}
+		typed, udiag := str.RValue(ty)
+		if udiag != nil {
+			return nil, BindDiagToAST(arg, *udiag)
+		}
+		return typed, nil
+	}
+
+	// constants are converted exactly, at compile time. Converting a string
+	// constant to a slice still needs a fresh copy at runtime, though.
+	_, isStr := val.(*ConstString)
+	if isUntyped(val) && !(isStr && isSliceType(ty)) {
+		typed, udiag := val.RValue(ty)
+		if udiag != nil {
+			return nil, BindDiagToAST(arg, *udiag)
+		}
+		return typed, nil
+	}
+
+	typed, diag := block.assignTo(arg, val, nil)
+	if diag != nil {
+		return nil, diag
+	}
+	converted, udiag := block.buildConversion(typed, ty)
+	if udiag != nil {
+		return nil, BindDiagToAST(call, *udiag)
+	}
+	return converted, nil
+}
+
+// converts the runtime value `val` to type `ty`.
+func (block *Block) buildConversion(val TypedValue, ty Type) (TypedValue, *UDiag) {
+	from := val.Type()
+	builder := block.Builder
+	if converted := block.buildUnsafeConversion(val, ty); converted != nil {
+		return converted, nil
+	}
+	switch src := from.Base().(type) {
+	case *IntType:
+		switch dst := ty.Base().(type) {
+		case *IntType:
+			return &Register{ty, block.buildIntResize(val.LLVM(), src, dst)}, nil
+		case *StringType:
+			return block.buildRuneToString(val, src, ty), nil
+		case *FloatType:
+			if src.Signed() {
+				return &Register{ty, builder.BuildSIToFP(val.LLVM(), dst.LLVM(), "")}, nil
+			}
+			return &Register{ty, builder.BuildUIToFP(val.LLVM(), dst.LLVM(), "")}, nil
+		}
+	case *FloatType:
+		switch dst := ty.Base().(type) {
+		case *IntType:
+			if dst.Signed() {
+				return &Register{ty, builder.BuildFPToSI(val.LLVM(), dst.LLVM(), "")}, nil
+			}
+			return &Register{ty, builder.BuildFPToUI(val.LLVM(), dst.LLVM(), "")}, nil
+		case *FloatType:
+			if src.BitWidth() < dst.BitWidth() {
+				return &Register{ty, builder.BuildFPExt(val.LLVM(), dst.LLVM(), "")}, nil
+			}
+			if src.BitWidth() > dst.BitWidth() {
+				return &Register{ty, builder.BuildFPTrunc(val.LLVM(), dst.LLVM(), "")}, nil
+			}
+			return &Register{ty, val.LLVM()}, nil
+		}
+	case *StringType:
+		if dst, ok := ty.Base().(*SliceType); ok {
+			return block.buildStringToSlice(val, dst, ty)
+		}
+	case *SliceType:
+		if _, ok := ty.Base().(*StringType); ok {
+			return block.buildSliceToString(val, src, ty)
+		}
+		if converted := block.buildSliceToArray(val, ty); converted != nil {
+			return converted, nil
+		}
+	case *ComplexType:
+		if dst, ok := ty.Base().(*ComplexType); ok {
+			srcPart := src.PartType()
+			dstPart := dst.PartType()
+			re, im := block.splitComplex(val.LLVM())
+			if srcPart.BitWidth() < dstPart.BitWidth() {
+				re = builder.BuildFPExt(re, dstPart.LLVM(), "")
+				im = builder.BuildFPExt(im, dstPart.LLVM(), "")
+			} else if srcPart.BitWidth() > dstPart.BitWidth() {
+				re = builder.BuildFPTrunc(re, dstPart.LLVM(), "")
+				im = builder.BuildFPTrunc(im, dstPart.LLVM(), "")
+			}
+			return &Register{ty, block.buildComplex(ty, re, im)}, nil
+		}
+	}
+	if underlying(from).Eq(underlying(ty)) {
+		return block.buildRetype(val, ty), nil
+	}
+	// *T converts to *U when T and U have identical underlying types, even
+	// when the pointer types themselves are named.
+	fromPtr, fromOk := underlying(from).(*PointerType)
+	toPtr, toOk := underlying(ty).(*PointerType)
+	if fromOk && toOk && underlying(fromPtr.At).Eq(underlying(toPtr.At)) {
+		return &Register{ty, builder.BuildBitCast(val.LLVM(), ty.LLVM(), "")}, nil
+	}
+	udiag := UDiag("Cannot convert a value of type " + from.String() + " to type " + ty.String() + ".")
+	return nil, &udiag
+}
+
+/*
+ * buildRetype gives `val` the type `ty`, which has the same underlying type.
+ * The two have the same layout, but a named struct type is an LLVM type of its
+ * own, so the value may have to be reinterpreted through memory.
+ */
+func (block *Block) buildRetype(val TypedValue, ty Type) TypedValue {
+	llvmVal := val.LLVM()
+	if llvmVal.Type() == ty.LLVM() {
+		return &Register{ty, llvmVal}
+	}
+	tmp := block.buildAlloca(MemLLVM(val.Type()), "retype.tmp")
+	buildStoreValue(block.Builder, val.Type(), llvmVal, tmp)
+	cast := block.Builder.BuildBitCast(tmp, llvm.PointerType(MemLLVM(ty), 0), "")
+	return &Register{ty, buildLoadValue(block.Builder, ty, cast)}
+}
+
+// truncates or extends an integer; extension follows the signedness of the source.
+func (block *Block) buildIntResize(val llvm.Value, from *IntType, to *IntType) llvm.Value {
+	if from.BitWidth() > to.BitWidth() {
+		return block.Builder.BuildTrunc(val, to.LLVM(), "")
+	}
+	if from.BitWidth() < to.BitWidth() {
+		if from.Signed() {
+			return block.Builder.BuildSExt(val, to.LLVM(), "")
+		}
+		return block.Builder.BuildZExt(val, to.LLVM(), "")
+	}
+	return val
+}
@@ -12,6 +12,7 @@ type GoDiag struct {
 	start, end token.Pos
 	fset       *token.FileSet
 	msg        string
+	hint       string // optional follow-up, e.g. a "did you mean" suggestion.
 }
 
 const (
@@ -33,11 +34,17 @@ type Blame struct {
 }
 
 func DiagFromAST(ast ast.Node, format string, args ...interface{}) *GoDiag {
-	return &GoDiag{ast.Pos(), ast.End(), nil, fmt.Sprintf(format, args...)}
+	return &GoDiag{ast.Pos(), ast.End(), nil, fmt.Sprintf(format, args...), ""}
 }
 
 func BindDiagToAST(ast ast.Node, unbound UDiag) *GoDiag {
-	return &GoDiag{ast.Pos(), ast.End(), nil, string(unbound)}
+	return &GoDiag{ast.Pos(), ast.End(), nil, string(unbound), ""}
+}
+
+// attaches a hint to the diagnostic; returns the diagnostic for convenience.
+func (diag *GoDiag) WithHint(hint string) *GoDiag {
+	diag.hint = hint
+	return diag
 }
 
 // TODO: this is pretty much the same as UDiag; fix!
@@ -47,6 +54,10 @@ func (err *GenError) Msg() string {
 	return string(*err)
 }
 
+func (err *GenError) Hint() string {
+	return ""
+}
+
 func (err *GenError) Blame() Blame {
 	return Blame{BLAME_NONE, "", 0, 0, 0, 0, 0, 0, 0, "", "", ""}
 }
@@ -54,6 +65,7 @@ func (err *GenError) Blame() Blame {
 type Diag interface {
 	Blame() Blame
 	Msg() string
+	Hint() string // empty if there's nothing more to say.
 }
 
 func (diag *GoDiag) Blame() Blame {
@@ -81,6 +93,10 @@ func (diag *GoDiag) Msg() string {
 	return diag.msg
 }
 
+func (diag *GoDiag) Hint() string {
+	return diag.hint
+}
+
 func (blame Blame) simpleRef() string {
 	switch blame.Type {
 	case BLAME_TEXT_SINGLE:
@@ -99,11 +115,11 @@ func (blame Blame) simpleRef() string {
 	return ""
 }
 
-func (blame Blame) printLine() bool {
+func (blame Blame) printLine() (string, bool) {
 	assert(blame.Type == BLAME_TEXT_SINGLE, "Attempting to get a single line for a non-single-line diagnostic!")
 	file, err := os.Open(blame.File)
 	if err != nil {
-		return false
+		return "", false
 	}
 	// now seek forward to line n
 	n := blame.Line
@@ -113,7 +129,7 @@ func (blame Blame) printLine() bool {
 			read, err := file.Read(byt)
 			if err != nil || read == 0 {
 				file.Close()
-				return false
+				return "", false
 			}
 		}
 		byt[0] = 0
@@ -131,12 +147,13 @@ func (blame Blame) printLine() bool {
 	}
 	file.Close()
 	lineStr := string(line)
-	fmt.Printf("\t%s\n", lineStr)
-	return true
+	fmt.Fprintf(os.Stderr, "\t%s\n", colorize(lineStr, ANSI_DIM))
+	return lineStr, true
 }
 
 func (blame Blame) printTextSingle() {
-	if !blame.printLine() { // something went wrong with finding the line in the file.
+	line, ok := blame.printLine()
+	if !ok { // something went wrong with finding the line in the file.
 		return
 	}
 
@@ -144,41 +161,66 @@ func (blame Blame) printTextSingle() {
 
 	caretOffset := blame.Caret - blame.Col
 
-	detailBuf := make([]byte, blame.Col+blame.Extent)
-	var i uint
-	for i = 0; i < blame.Col-1; i++ {
-		detailBuf[i] = ' '
+	// always show at least the caret, even for empty ranges.
+	extent := blame.Extent
+	if extent == 0 {
+		extent = 1
 	}
-	for i = 0; i < blame.Extent; i++ {
+
+	// keep tabs from the source line so the range lines up underneath it.
+	padBuf := make([]byte, blame.Col-1)
+	for i := range padBuf {
+		if i < len(line) && line[i] == '\t' {
+			padBuf[i] = '\t'
+		} else {
+			padBuf[i] = ' '
+		}
+	}
+	rangeBuf := make([]byte, extent)
+	var i uint
+	for i = 0; i < extent; i++ {
 		if i == caretOffset {
-			detailBuf[blame.Col+i] = '^'
+			rangeBuf[i] = '^'
 		} else {
-			detailBuf[blame.Col+i] = '~'
+			rangeBuf[i] = '~'
 		}
 	}
 
-	fmt.Printf("\t%s\n", string(detailBuf))
+	fmt.Fprintf(os.Stderr, "\t%s%s\n", string(padBuf), colorize(string(rangeBuf), ANSI_BOLD, ANSI_GREEN))
 }
 
 func (blame Blame) printTextMulti() {
-	fmt.Printf("\tTODO: Multi-line diagnostic\n")
+	fmt.Fprintf(os.Stderr, "\tTODO: Multi-line diagnostic\n")
 }
 
 func (blame Blame) printBinary() {
 }
 
 func (blame Blame) printCmd() {
-	fmt.Printf("\tCommand invocation: %s\n", blame.Invocation)
-	fmt.Printf("\tCommand Output:\n%s", blame.Output)
+	fmt.Fprintf(os.Stderr, "\t%s %s\n", colorize("Command invocation:", ANSI_BOLD), blame.Invocation)
+	fmt.Fprintf(os.Stderr, "\t%s\n%s", colorize("Command Output:", ANSI_BOLD), colorize(blame.Output, ANSI_DIM))
+}
+
+func printSeverity(severity string) {
+	fmt.Fprintf(os.Stderr, "%s ", colorize(severity+":", ANSI_BOLD, ANSI_RED))
+}
+
+func printHint(hint string) {
+	if hint == "" {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\t%s %s\n", colorize("note:", ANSI_BOLD, ANSI_CYAN), hint)
 }
 
 func PrintDiagnostic(diag Diag) {
 	blame := diag.Blame()
+	printSeverity("Error")
 	if blame.Type == BLAME_NONE {
-		fmt.Printf("Error: %s\n", diag.Msg())
+		fmt.Fprintf(os.Stderr, "%s\n", colorize(diag.Msg(), ANSI_BOLD))
+		printHint(diag.Hint())
 		return
 	}
-	fmt.Printf("Error: %s: %s\n", blame.simpleRef(), diag.Msg())
+	fmt.Fprintf(os.Stderr, "%s %s\n", colorize(blame.simpleRef()+":", ANSI_BOLD), colorize(diag.Msg(), ANSI_BOLD))
 	switch blame.Type {
 	case BLAME_TEXT_SINGLE:
 		blame.printTextSingle()
@@ -197,4 +239,5 @@ func PrintDiagnostic(diag Diag) {
 		panic("Bad internal state! Unknown blame type given.")
 		break
 	}
+	printHint(diag.Hint())
 }
@@ -0,0 +1,699 @@
+package main
+
+import "go/ast"
+import "go/token"
+import "sort"
+import "strings"
+import "llvm"
+
+/*
+ * Generic functions and types are monomorphized: each distinct list of type
+ * arguments gets an instance of its own, translated from the declaration with
+ * the type parameters bound to the arguments. An instance is named after its
+ * generic and its type arguments, as in `Max[int]`, which keeps symbols
+ * deterministic. Type arguments are checked against their constraints, and
+ * each instance is type-checked as it's translated.
+ */
+
+/*
+ * The types that a constraint permits, besides requiring its methods: those
+ * matching any of its terms (or any type at all, if there are none), which
+ * must also be comparable if `Comparable` is set.
+ */
+type TypeSet struct {
+	Terms      []TypeTerm
+	Comparable bool
+}
+
+// `T`, or with `Tilde`, `~T`: any type whose underlying type is T.
+type TypeTerm struct {
+	Ty    Type
+	Tilde bool
+}
+
+func (term TypeTerm) String() string {
+	if term.Tilde {
+		return "~" + term.Ty.String()
+	}
+	return term.Ty.String()
+}
+
+func (set *TypeSet) String() string {
+	elems := make([]string, 0)
+	if set.Comparable {
+		elems = append(elems, "comparable")
+	}
+	if len(set.Terms) > 0 {
+		terms := make([]string, len(set.Terms))
+		for i, term := range set.Terms {
+			terms[i] = term.String()
+		}
+		elems = append(elems, strings.Join(terms, " | "))
+	}
+	return strings.Join(elems, "; ")
+}
+
+// compares type sets, either of which may be nil (i.e. all types).
+func (set *TypeSet) Eq(other *TypeSet) bool {
+	if set == nil || other == nil {
+		return set == other
+	}
+	if set.Comparable != other.Comparable || len(set.Terms) != len(other.Terms) {
+		return false
+	}
+	for i, term := range set.Terms {
+		if term.Tilde != other.Terms[i].Tilde || !term.Ty.Eq(other.Terms[i].Ty) {
+			return false
+		}
+	}
+	return true
+}
+
+// the underlying type of `ty`.
+func underlying(ty Type) Type {
+	if named, ok := ty.(*NamedType); ok {
+		return named.Underlying
+	}
+	return ty
+}
+
+// returns why `ty` doesn't satisfy `constraint`, or "" if it does.
+func unsatisfied(ty Type, constraint Type) string {
+	iface, ok := underlying(constraint).(*InterfaceType)
+	assert(ok, "Constraint is not an interface!")
+	if missing, _ := missingMethods(ty, iface); len(missing) > 0 {
+		return "missing method " + missing[0]
+	}
+	set := iface.Set
+	if set == nil {
+		return ""
+	}
+	if set.Comparable && !isComparable(ty) {
+		return ty.String() + " is not comparable"
+	}
+	if len(set.Terms) == 0 {
+		return ""
+	}
+	for _, term := range set.Terms {
+		if term.Ty.Eq(ty) || (term.Tilde && term.Ty.Eq(underlying(ty))) {
+			return ""
+		}
+	}
+	return ty.String() + " is not in " + set.String()
+}
+
+// reports whether `expr` is a union of types, or a `~T` term.
+func isTermExpr(expr ast.Expr) bool {
+	switch exprTy := expr.(type) {
+	case *ast.BinaryExpr:
+		return exprTy.Op == token.OR
+	case *ast.UnaryExpr:
+		return exprTy.Op == token.TILDE
+	case *ast.ParenExpr:
+		return isTermExpr(exprTy.X)
+	}
+	return false
+}
+
+/*
+ * translateTerms translates the union of types `expr`, e.g. `~int | ~float64`.
+ * A constraint in a union contributes its own terms.
+ */
+func (trans *Translator) translateTerms(scope *Scope, expr ast.Expr) ([]TypeTerm, *GoDiag) {
+	switch exprTy := expr.(type) {
+	case *ast.BinaryExpr:
+		if exprTy.Op == token.OR {
+			terms, diag := trans.translateTerms(scope, exprTy.X)
+			if diag != nil {
+				return nil, diag
+			}
+			more, diag := trans.translateTerms(scope, exprTy.Y)
+			if diag != nil {
+				return nil, diag
+			}
+			return append(terms, more...), nil
+		}
+	case *ast.UnaryExpr:
+		if exprTy.Op == token.TILDE {
+			ty, diag := trans.translateType(scope, exprTy.X)
+			if diag != nil {
+				return nil, diag
+			}
+			if !underlying(ty).Eq(ty) {
+				return nil, DiagFromAST(expr, "Invalid use of ~: the underlying type of %s is %s.", ty.String(), underlying(ty).String())
+			}
+			return []TypeTerm{{ty, true}}, nil
+		}
+	case *ast.ParenExpr:
+		return trans.translateTerms(scope, exprTy.X)
+	}
+	ty, diag := trans.translateType(scope, expr)
+	if diag != nil {
+		return nil, diag
+	}
+	if iface, ok := underlying(ty).(*InterfaceType); ok {
+		if len(iface.Methods) > 0 || iface.Set == nil || len(iface.Set.Terms) == 0 {
+			return nil, DiagFromAST(expr, "Cannot use %s in a union.", ty.String())
+		}
+		return iface.Set.Terms, nil
+	}
+	return []TypeTerm{{ty, false}}, nil
+}
+
+/*
+ * translateConstraint translates the constraint of a type parameter. Besides
+ * interfaces, that may be a union, or a single type, which stand for an
+ * interface with just those types in its type set.
+ */
+func (trans *Translator) translateConstraint(scope *Scope, expr ast.Expr) (Type, *GoDiag) {
+	if isTermExpr(expr) {
+		terms, diag := trans.translateTerms(scope, expr)
+		if diag != nil {
+			return nil, diag
+		}
+		return &InterfaceType{[]IfaceMethod{}, &TypeSet{terms, false}}, nil
+	}
+	ty, diag := trans.translateType(scope, expr)
+	if diag != nil {
+		return nil, diag
+	}
+	if _, ok := underlying(ty).(*InterfaceType); !ok {
+		return &InterfaceType{[]IfaceMethod{}, &TypeSet{[]TypeTerm{{ty, false}}, false}}, nil
+	}
+	return ty, nil
+}
+
+// the names of the type parameters in `params`, in order.
+func typeParamNames(params *ast.FieldList) []string {
+	names := make([]string, 0)
+	for _, field := range params.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+// the type of each of the parameters in `params`, in order.
+func paramTypeExprs(params *ast.FieldList) []ast.Expr {
+	exprs := make([]ast.Expr, 0)
+	for _, field := range params.List {
+		count := len(field.Names)
+		if count == 0 { // unnamed parameter
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			exprs = append(exprs, field.Type)
+		}
+	}
+	return exprs
+}
+
+// splits `x[a, b]` into `x` and its indices, which are nil if `expr` isn't indexed.
+func splitIndices(expr ast.Expr) (ast.Expr, []ast.Expr) {
+	switch exprTy := expr.(type) {
+	case *ast.IndexExpr:
+		return exprTy.X, []ast.Expr{exprTy.Index}
+	case *ast.IndexListExpr:
+		return exprTy.X, exprTy.Indices
+	}
+	return expr, nil
+}
+
+// the name of the instance of the generic `name` with type arguments `args`.
+func instanceName(name string, args []Type) string {
+	argStrs := make([]string, len(args))
+	for i, arg := range args {
+		argStrs[i] = arg.String()
+	}
+	return name + "[" + strings.Join(argStrs, ",") + "]"
+}
+
+/*
+ * bindTypeParams returns a scope, nested in `outer`, that binds the type
+ * parameters `params` to `args`, once each argument has been checked against
+ * its constraint. Constraints may refer to the type parameters themselves.
+ */
+func (trans *Translator) bindTypeParams(node ast.Node, outer *Scope, params *ast.FieldList, args []Type) (*Scope, *GoDiag) {
+	names := typeParamNames(params)
+	if len(names) != len(args) {
+		return nil, DiagFromAST(node, "Expected %d type arguments, found %d.", len(names), len(args))
+	}
+	scope := outer.createChild()
+	for i, name := range names {
+		if !scope.addType(name, args[i]) {
+			return nil, DiagFromAST(params, "Type parameter %s is declared more than once.", name)
+		}
+	}
+	idx := 0
+	for _, field := range params.List {
+		constraint, diag := trans.translateConstraint(scope, field.Type)
+		if diag != nil {
+			return nil, diag
+		}
+		for range field.Names {
+			if reason := unsatisfied(args[idx], constraint); reason != "" {
+				return nil, DiagFromAST(node, "%s does not satisfy %s (%s).", args[idx].String(), constraint.String(), reason)
+			}
+			idx++
+		}
+	}
+	return scope, nil
+}
+
+/*
+ * A generic function. Each instance is a FuncValue of its own, and its body
+ * is translated once everything declared in the file has been.
+ */
+type GenericFunc struct {
+	Decl      *ast.FuncDecl
+	Scope     *Scope
+	Instances map[string]*FuncValue
+}
+
+func (generic *GenericFunc) RValue(expected_type Type) (TypedValue, *UDiag) {
+	udiag := UDiag("Cannot use generic function " + generic.Decl.Name.Name + " without instantiation.")
+	return nil, &udiag
+}
+
+func (generic *GenericFunc) String() string {
+	return "<generic func " + generic.Decl.Name.Name + ">"
+}
+
+func (generic *GenericFunc) LValue() bool {
+	return false
+}
+
+/*
+ * A generic type. It isn't really a type: only its instances are, which are
+ * defined types, named like `List[int]`. It's bound as a type nonetheless, so
+ * that its name shares the namespace of the others.
+ */
+type GenericType struct {
+	Spec  *ast.TypeSpec
+	Scope *Scope
+	// the methods declared on the generic type, which every instance gets.
+	Methods   []*ast.FuncDecl
+	Instances map[string]*NamedType
+}
+
+func (generic *GenericType) String() string {
+	return generic.Spec.Name.Name
+}
+
+func (generic *GenericType) LLVM() llvm.Type {
+	panic("Generic types have no LLVM type; only their instances do.")
+}
+
+func (generic *GenericType) Eq(ty Type) bool {
+	return ty == Type(generic)
+}
+
+func (generic *GenericType) Base() Type {
+	return generic
+}
+
+func (generic *GenericType) BaseIDString() string {
+	return "g." + generic.Spec.Name.Name
+}
+
+func (generic *GenericType) Zero(ns *LLVMNamespace) TypedValue {
+	panic("Generic types have no zero value; only their instances do.")
+}
+
+func (generic *GenericType) Named() bool {
+	return true
+}
+
+/*
+ * instantiateType returns the instance of `generic` with type arguments
+ * `args`. A new instance gets every method of the generic type.
+ */
+func (trans *Translator) instantiateType(node ast.Node, generic *GenericType, args []Type) (*NamedType, *GoDiag) {
+	name := instanceName(generic.Spec.Name.Name, args)
+	if named, ok := generic.Instances[name]; ok {
+		return named, nil
+	}
+	scope, diag := trans.bindTypeParams(node, generic.Scope, generic.Spec.TypeParams, args)
+	if diag != nil {
+		return nil, diag
+	}
+	named := CreateNamedType(name)
+	named.Generic = generic
+	named.TypeArgs = args
+	// bound before its underlying type is translated, which may refer to it.
+	generic.Instances[name] = named
+	ty, diag := trans.translateType(scope, generic.Spec.Type)
+	if diag != nil {
+		delete(generic.Instances, name)
+		return nil, diag
+	}
+	// like `type A B`, `type A[T any] B` has B's underlying type.
+	for {
+		inner, ok := ty.(*NamedType)
+		if !ok || inner.Underlying == nil {
+			break
+		}
+		ty = inner.Underlying
+	}
+	named.Underlying = ty
+	if containsByValue(ty, named) {
+		return nil, DiagFromAST(generic.Spec.Name, "Invalid recursive type \"%s\".", name)
+	}
+	for _, decl := range generic.Methods {
+		if diag := trans.declareInstanceMethod(named, decl); diag != nil {
+			return nil, diag
+		}
+	}
+	return named, nil
+}
+
+// translates `List[int]` and the like, where `expr` instantiates a generic type.
+func (trans *Translator) translateInstanceType(scope *Scope, expr ast.Expr) (Type, *GoDiag) {
+	base, indices := splitIndices(expr)
+	ident, ok := base.(*ast.Ident)
+	var generic *GenericType
+	if ok {
+		generic, ok = scope.lookupType(ident.Name).(*GenericType)
+	}
+	if !ok {
+		return nil, DiagFromAST(base, "Only generic types take type arguments.")
+	}
+	args := make([]Type, len(indices))
+	for i, index := range indices {
+		arg, diag := trans.translateType(scope, index)
+		if diag != nil {
+			return nil, diag
+		}
+		args[i] = arg
+	}
+	return trans.instantiateType(expr, generic, args)
+}
+
+// the generic type that a method with receiver `recv` belongs to, if any.
+func (trans *Translator) genericReceiver(recv *ast.FieldList) *GenericType {
+	if len(recv.List) != 1 {
+		return nil
+	}
+	tyExpr, _ := receiverTypeExpr(recv.List[0].Type)
+	base, indices := splitIndices(tyExpr)
+	ident, ok := base.(*ast.Ident)
+	if !ok || indices == nil {
+		return nil
+	}
+	generic, _ := trans.Scope.lookupType(ident.Name).(*GenericType)
+	return generic
+}
+
+// adds the method `decl` to `generic`, and so to each of its instances.
+func (trans *Translator) addGenericMethod(generic *GenericType, decl *ast.FuncDecl) *GoDiag {
+	if decl.Name.Name == "_" {
+		return nil
+	}
+	for _, other := range generic.Methods {
+		if other.Name.Name == decl.Name.Name {
+			return DiagFromAST(decl.Name, "Method %s.%s is already declared.", generic.String(), decl.Name.Name)
+		}
+	}
+	generic.Methods = append(generic.Methods, decl)
+
+	// types may have been instantiated before the method was declared.
+	names := make([]string, 0, len(generic.Instances))
+	for name := range generic.Instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if diag := trans.declareInstanceMethod(generic.Instances[name], decl); diag != nil {
+			return diag
+		}
+	}
+	return nil
+}
+
+/*
+ * declareInstanceMethod declares the method `decl` of a generic type on its
+ * instance `named`. The receiver names the type parameters afresh, as in
+ * `func (l *List[E]) Push(e E)`.
+ */
+func (trans *Translator) declareInstanceMethod(named *NamedType, decl *ast.FuncDecl) *GoDiag {
+	tyExpr, isPtr := receiverTypeExpr(decl.Recv.List[0].Type)
+	_, indices := splitIndices(tyExpr)
+	if len(indices) != len(named.TypeArgs) {
+		return DiagFromAST(tyExpr, "Expected %d type parameters in the receiver, found %d.", len(named.TypeArgs), len(indices))
+	}
+	scope := named.Generic.Scope.createChild()
+	for i, index := range indices {
+		ident, ok := index.(*ast.Ident)
+		if !ok {
+			return DiagFromAST(index, "Expected the name of a type parameter.")
+		}
+		if ident.Name != "_" {
+			scope.addType(ident.Name, named.TypeArgs[i])
+		}
+	}
+	fn, diag := trans.addMethod(scope, named, isPtr, decl)
+	if diag != nil || fn == nil {
+		return diag
+	}
+	trans.queueInstance(scope, decl, fn)
+	return nil
+}
+
+/*
+ * instantiateFunc returns the instance of `generic` with type arguments
+ * `args`. Its body is translated later, with the rest of the instances.
+ */
+func (trans *Translator) instantiateFunc(node ast.Node, generic *GenericFunc, args []Type) (*FuncValue, *GoDiag) {
+	decl := generic.Decl
+	name := instanceName(decl.Name.Name, args)
+	if fn, ok := generic.Instances[name]; ok {
+		return fn, nil
+	}
+	scope, diag := trans.bindTypeParams(node, generic.Scope, decl.Type.TypeParams, args)
+	if diag != nil {
+		return nil, diag
+	}
+	fnTy, diag := trans.translateFuncType(scope, decl.Type)
+	if diag != nil {
+		return nil, diag
+	}
+	fn := &FuncValue{name, fnTy, trans.mod.AddFunction(name, fnTy.LLVMSignature())}
+	generic.Instances[name] = fn
+	trans.queueInstance(scope, decl, fn)
+	return fn, nil
+}
+
+/*
+ * queueInstance queues the body of `decl` for translation into `fn`, the
+ * instance whose type parameters are bound in `scope`. Instances can be
+ * created before everything they refer to is declared (e.g. by a function's
+ * signature), so their bodies wait until the rest of the file is translated.
+ */
+func (trans *Translator) queueInstance(scope *Scope, decl *ast.FuncDecl, fn *FuncValue) {
+	root := trans.root()
+	root.Pending = append(root.Pending, func() *GoDiag {
+		inst := *root
+		inst.Parent = root
+		inst.Scope = scope
+		return inst.translateFunc(decl, fn)
+	})
+}
+
+/*
+ * genericCallee returns the generic function that `expr` names, if any, along
+ * with the type arguments it gives explicitly, as in `Map[int, string]`.
+ */
+func (block *Block) genericCallee(expr ast.Expr) (*GenericFunc, []ast.Expr) {
+	if paren, ok := expr.(*ast.ParenExpr); ok {
+		return block.genericCallee(paren.X)
+	}
+	base, indices := splitIndices(expr)
+	ident, ok := base.(*ast.Ident)
+	if !ok {
+		return nil, nil
+	}
+	bound := block.Scope.lookupVar(ident.Name)
+	if bound == nil {
+		return nil, nil
+	}
+	generic, _ := bound.Val.(*GenericFunc)
+	return generic, indices
+}
+
+// translates a call of a generic function, instantiating it as needed.
+func (block *Block) translateGenericCall(call *ast.CallExpr, generic *GenericFunc, explicit []ast.Expr) (UntypedValue, *GoDiag) {
+	args, diag := block.translateArgs(call)
+	if diag != nil {
+		return nil, diag
+	}
+	typeArgs, diag := block.inferTypeArgs(call, generic, explicit, call.Args, args)
+	if diag != nil {
+		return nil, diag
+	}
+	fn, diag := block.Trans.instantiateFunc(call, generic, typeArgs)
+	if diag != nil {
+		return nil, diag
+	}
+	return block.buildCallArgs(call, fn, args)
+}
+
+// translates `f[int]`, an instance of the generic function `f` used as a value.
+func (block *Block) translateInstantiation(expr ast.Expr, generic *GenericFunc, explicit []ast.Expr) (UntypedValue, *GoDiag) {
+	typeArgs, diag := block.inferTypeArgs(expr, generic, explicit, nil, nil)
+	if diag != nil {
+		return nil, diag
+	}
+	return block.Trans.instantiateFunc(expr, generic, typeArgs)
+}
+
+/*
+ * inferTypeArgs works out the type arguments for `generic`, given the
+ * `explicit` ones, which come first, and the arguments `args` (translated
+ * from `argExprs`) it's being called with. Typed arguments are matched
+ * against the types of their parameters first; an untyped constant only
+ * decides a parameter of type `T` after that, with its default type.
+ */
+func (block *Block) inferTypeArgs(node ast.Node, generic *GenericFunc, explicit []ast.Expr, argExprs []ast.Expr, args []UntypedValue) ([]Type, *GoDiag) {
+	decl := generic.Decl
+	names := typeParamNames(decl.Type.TypeParams)
+	if len(explicit) > len(names) {
+		return nil, DiagFromAST(node, "Expected at most %d type arguments, found %d.", len(names), len(explicit))
+	}
+	inf := &inference{make(map[string]bool), make(map[string]Type)}
+	for i, name := range names {
+		inf.params[name] = true
+		if i < len(explicit) {
+			ty, diag := block.translateType(explicit[i])
+			if diag != nil {
+				return nil, diag
+			}
+			inf.bound[name] = ty
+		}
+	}
+
+	// with the wrong number of arguments, the call itself reports it.
+	params := paramTypeExprs(decl.Type.Params)
+	if len(params) == len(args) {
+		for i, arg := range args {
+			if arg == nil || isUntyped(arg) {
+				continue
+			}
+			if msg := inf.unify(params[i], arg.(TypedValue).Type()); msg != "" {
+				return nil, DiagFromAST(argExprs[i], "%s", msg)
+			}
+		}
+		for i, arg := range args {
+			ident, ok := params[i].(*ast.Ident)
+			if arg == nil || !isUntyped(arg) || !ok || !inf.params[ident.Name] {
+				continue
+			}
+			if _, ok := inf.bound[ident.Name]; ok {
+				continue
+			}
+			// an untyped expression like `1 << n` mustn't be built just to
+			// find its type.
+			if dflt, ok := arg.(*UntypedExpr); ok {
+				if dflt.Default != nil {
+					inf.bound[ident.Name] = dflt.Default
+				}
+			} else if typed, udiag := arg.RValue(nil); udiag == nil {
+				inf.bound[ident.Name] = typed.Type()
+			}
+		}
+	}
+
+	typeArgs := make([]Type, len(names))
+	for i, name := range names {
+		ty, ok := inf.bound[name]
+		if !ok {
+			return nil, DiagFromAST(node, "Cannot infer type argument %s of %s.", name, decl.Name.Name)
+		}
+		typeArgs[i] = ty
+	}
+	return typeArgs, nil
+}
+
+// the type parameters being inferred, and the types found for them so far.
+type inference struct {
+	params map[string]bool
+	bound  map[string]Type
+}
+
+/*
+ * unify matches the type expression `param` against the type `arg`, binding
+ * any type parameters that appear in it. It only complains if a type
+ * parameter would have two different types; any other mismatch is left for
+ * the call to report.
+ */
+func (inf *inference) unify(param ast.Expr, arg Type) string {
+	switch paramTy := param.(type) {
+	case *ast.Ident:
+		if !inf.params[paramTy.Name] {
+			return ""
+		}
+		if prev, ok := inf.bound[paramTy.Name]; ok {
+			if !prev.Eq(arg) {
+				return "Type parameter " + paramTy.Name + " would be both " + prev.String() + " and " + arg.String() + "."
+			}
+			return ""
+		}
+		inf.bound[paramTy.Name] = arg
+	case *ast.ParenExpr:
+		return inf.unify(paramTy.X, arg)
+	case *ast.StarExpr:
+		if ptrTy := pointerTypeOf(arg); ptrTy != nil {
+			return inf.unify(paramTy.X, ptrTy.At)
+		}
+	case *ast.ArrayType:
+		switch argTy := underlying(arg).(type) {
+		case *SliceType:
+			if paramTy.Len == nil {
+				return inf.unify(paramTy.Elt, argTy.Elem)
+			}
+		case *ArrayType:
+			if paramTy.Len != nil {
+				return inf.unify(paramTy.Elt, argTy.Elem)
+			}
+		}
+	case *ast.MapType:
+		if mapTy, ok := underlying(arg).(*MapType); ok {
+			if msg := inf.unify(paramTy.Key, mapTy.Key); msg != "" {
+				return msg
+			}
+			return inf.unify(paramTy.Value, mapTy.Elem)
+		}
+	case *ast.FuncType:
+		fnTy := funcTypeOf(arg)
+		if fnTy == nil {
+			return ""
+		}
+		params := paramTypeExprs(paramTy.Params)
+		if len(params) != len(fnTy.Params) {
+			return ""
+		}
+		for i, param := range params {
+			if msg := inf.unify(param, fnTy.Params[i]); msg != "" {
+				return msg
+			}
+		}
+		if paramTy.Results != nil && len(paramTy.Results.List) == 1 && fnTy.Result != nil {
+			return inf.unify(paramTy.Results.List[0].Type, fnTy.Result)
+		}
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		named, ok := arg.(*NamedType)
+		if !ok || named.Generic == nil {
+			return ""
+		}
+		_, indices := splitIndices(param)
+		if len(indices) != len(named.TypeArgs) {
+			return ""
+		}
+		for i, index := range indices {
+			if msg := inf.unify(index, named.TypeArgs[i]); msg != "" {
+				return msg
+			}
+		}
+	}
+	return ""
+}
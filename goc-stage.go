@@ -8,10 +8,11 @@ import "fmt"
 type GocStage struct {
 	Input  string
 	Output string
+	Target Target
 }
 
-func CreateGocStage(Input string, Output string) *GocStage {
-	return &GocStage{Input, Output}
+func CreateGocStage(Input string, Output string, Target Target) *GocStage {
+	return &GocStage{Input, Output, Target}
 }
 
 func (stage *GocStage) Name() string {
@@ -25,7 +26,7 @@ func (stage *GocStage) Run() Diag {
 		diag := GenError(fmt.Sprintf("Error while parsing file %s: %s", stage.Input, err.Error()))
 		return &diag
 	}
-	trans := CreateTranslator()
+	trans := CreateTranslator(stage.Target)
 	mod, diag := trans.translateFile(ast, fset)
 	if diag != nil {
 		llvm.DisposeModule(mod)
@@ -1,13 +1,61 @@
 package main
 
+import "flag"
+import "fmt"
 import "os"
+
+/*
+ * Picks the triple to compile for: an explicit -target wins, then GOOS/GOARCH
+ * from the environment, and otherwise the host.
+ */
+func selectTriple(targetFlag string) (string, Diag) {
+	if targetFlag != "" {
+		return targetFlag, nil
+	}
+	goos := os.Getenv("GOOS")
+	goarch := os.Getenv("GOARCH")
+	if goos != "" || goarch != "" {
+		return TripleForGo(goos, goarch)
+	}
+	return HostTriple()
+}
+
 func main() {
+	colorFlag := flag.String("color", "auto", "colorize diagnostics: auto, always or never")
+	targetFlag := flag.String("target", "", "LLVM target triple to compile for (default: $GOOS/$GOARCH, or the host)")
+	flag.Parse()
+
+	colorMode, ok := ParseColorMode(*colorFlag)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Invalid value \"%s\" for -color; expected auto, always or never.\n", *colorFlag)
+		os.Exit(2)
+	}
+	SetColorMode(colorMode)
+
+	triple, diag := selectTriple(*targetFlag)
+	if diag != nil {
+		PrintDiagnostic(diag)
+		os.Exit(1)
+	}
+	target, diag := CreateTarget(triple)
+	if diag != nil {
+		PrintDiagnostic(diag)
+		os.Exit(1)
+	}
+	defer target.DisposeTarget()
+
+	runtimeObj, diag := FindRuntime(target)
+	if diag != nil {
+		PrintDiagnostic(diag)
+		os.Exit(1)
+	}
+
 	pipe := CreatePipeline()
-	pipe.AddStage(CreateGocStage("test.go", "test.bc"))
-	pipe.AddStage(CreateLLCStage("test.bc", "test.o"))
-	pipe.AddStage(CreateLinkStage([]string{"rt/c/rt.o", "test.o"}, "test"))
+	pipe.AddStage(CreateGocStage("test.go", "test.bc", target))
+	pipe.AddStage(CreateLLCStage("test.bc", "test.o", target))
+	pipe.AddStage(CreateLinkStage([]string{runtimeObj, "test.o"}, target.ExecutableName("test"), target))
 	//pipe.AddStage(CreateCleanStage("test.bc", "test.o"))
-	diag := pipe.Execute(true)
+	diag = pipe.Execute(true)
 	if diag != nil {
 		PrintDiagnostic(diag)
 		os.Exit(1)
@@ -0,0 +1,713 @@
+package main
+
+import "go/ast"
+import "llvm"
+import "sort"
+import "strings"
+
+/*
+ * translateInterfaceType translates an interface type expression. Embedded
+ * interfaces contribute all of their methods; the same method may come from
+ * several of them, as long as its signature is the same each time. Embedded
+ * types and unions of them (e.g. `~int | ~float64`) restrict the type set of
+ * the interface, which can then only be used as a constraint.
+ */
+func (trans *Translator) translateInterfaceType(scope *Scope, expr *ast.InterfaceType) (Type, *GoDiag) {
+	methods := make([]IfaceMethod, 0)
+	add := func(node ast.Node, method IfaceMethod) *GoDiag {
+		for _, existing := range methods {
+			if existing.Name == method.Name {
+				if existing.Sig.Eq(method.Sig) {
+					return nil
+				}
+				return DiagFromAST(node, "Duplicate method %s.", method.Name)
+			}
+		}
+		methods = append(methods, method)
+		return nil
+	}
+	var set *TypeSet
+	restrict := func(node ast.Node, other *TypeSet) *GoDiag {
+		if set == nil {
+			set = &TypeSet{}
+		}
+		if len(set.Terms) > 0 && len(other.Terms) > 0 {
+			return DiagFromAST(node, "Interfaces with more than one union of types are not supported yet.")
+		}
+		set.Terms = append(set.Terms, other.Terms...)
+		set.Comparable = set.Comparable || other.Comparable
+		return nil
+	}
+
+	for _, field := range expr.Methods.List {
+		if len(field.Names) == 0 && isTermExpr(field.Type) {
+			terms, diag := trans.translateTerms(scope, field.Type)
+			if diag != nil {
+				return nil, diag
+			}
+			if diag := restrict(field, &TypeSet{terms, false}); diag != nil {
+				return nil, diag
+			}
+			continue
+		}
+		if len(field.Names) == 0 {
+			ty, diag := trans.translateType(scope, field.Type)
+			if diag != nil {
+				return nil, diag
+			}
+			if named, ok := ty.(*NamedType); ok && named.Underlying == nil {
+				return nil, DiagFromAST(field.Type, "Interface %s must be declared before it is embedded.", named.Name)
+			}
+			embedded, ok := ty.Base().(*InterfaceType)
+			if !ok {
+				if diag := restrict(field, &TypeSet{[]TypeTerm{{ty, false}}, false}); diag != nil {
+					return nil, diag
+				}
+				continue
+			}
+			if embedded.Set != nil {
+				if diag := restrict(field, embedded.Set); diag != nil {
+					return nil, diag
+				}
+			}
+			for _, method := range embedded.Methods {
+				if diag := add(field, method); diag != nil {
+					return nil, diag
+				}
+			}
+			continue
+		}
+		fnExpr, ok := field.Type.(*ast.FuncType)
+		assert(ok, "Expected *ast.FuncType for an interface method!")
+		sig, diag := trans.translateFuncType(scope, fnExpr)
+		if diag != nil {
+			return nil, diag
+		}
+		for _, name := range field.Names {
+			if diag := add(name, IfaceMethod{name.Name, sig}); diag != nil {
+				return nil, diag
+			}
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+	return &InterfaceType{methods, set}, nil
+}
+
+// the key the runtime matches methods by: the name, followed by the signature.
+func methodKey(name string, sig *FuncType) string {
+	return name + strings.TrimPrefix(sig.String(), "func ")
+}
+
+/*
+ * missingMethods returns the methods of `iface` that a `ty` doesn't have, and
+ * a hint about why, if there's anything more to say than that.
+ */
+func missingMethods(ty Type, iface *InterfaceType) ([]string, string) {
+	missing := make([]string, 0)
+	hint := ""
+	if other, ok := ty.Base().(*InterfaceType); ok {
+		for _, method := range iface.Methods {
+			idx := other.MethodIndex(method.Name)
+			if idx < 0 || !other.Methods[idx].Sig.Eq(method.Sig) {
+				missing = append(missing, method.Name)
+			}
+		}
+		return missing, hint
+	}
+
+	methods := MethodSet(ty)
+	for _, want := range iface.Methods {
+		found := false
+		for _, method := range methods {
+			if method.Name != want.Name {
+				continue
+			}
+			found = true
+			if !method.Signature().Eq(want.Sig) {
+				missing = append(missing, want.Name)
+				hint = "Method " + want.Name + " has type " + method.Signature().String() + ", but " + want.Sig.String() + " is needed."
+			}
+		}
+		if found {
+			continue
+		}
+		missing = append(missing, want.Name)
+		// a `T` doesn't get the methods of a `*T`.
+		if named, ok := ty.(*NamedType); ok {
+			if method := named.Method(want.Name); method != nil && method.PtrRecv {
+				hint = "Method " + want.Name + " has a pointer receiver, so only *" + named.Name + " implements it."
+			}
+		}
+	}
+	return missing, hint
+}
+
+func notImplementedDiag(expr ast.Expr, ty Type, ifaceTy Type, missing []string, hint string) *GoDiag {
+	diag := DiagFromAST(expr, "Type %s does not implement %s (missing %s).", ty.String(), ifaceTy.String(), strings.Join(missing, ", "))
+	if hint != "" {
+		diag = diag.WithHint(hint)
+	}
+	return diag
+}
+
+/*
+ * The descriptors the runtime uses for interfaces (see rt/common/iface.h).
+ * Each one is emitted once per module, the first time it's needed.
+ */
+type typeGlobal struct {
+	Ty     Type
+	Global llvm.Value
+}
+
+type itabDescriptor struct {
+	Ty     Type
+	Iface  Type
+	Global llvm.Value
+}
+
+type IfaceTables struct {
+	Types    []typeGlobal
+	Ifaces   []typeGlobal
+	Itabs    []itabDescriptor
+	Wrappers map[*Method]llvm.Value
+}
+
+func CreateIfaceTables() *IfaceTables {
+	return &IfaceTables{Wrappers: make(map[*Method]llvm.Value)}
+}
+
+func bytePtrType() llvm.Type {
+	return llvm.PointerType(llvm.IntType(8), 0)
+}
+
+func (trans *Translator) constBytePtr(val llvm.Value) llvm.Value {
+	return llvm.ConstBitCast(val, bytePtrType())
+}
+
+/*
+ * methodWrapper returns a function that calls `method` with its receiver
+ * passed as an i8* to the receiver's value, which is how interfaces hold
+ * values. A value receiver is loaded from there; a pointer receiver is the
+ * pointer itself.
+ */
+func (trans *Translator) methodWrapper(named *NamedType, method *Method) llvm.Value {
+	if wrapper, ok := trans.Ifaces.Wrappers[method]; ok {
+		return wrapper
+	}
+	sig := method.Signature()
+	fnTy := &FuncType{append([]Type{&PointerType{global_type_factory.IntType(BLTN_TY_UINT8)}}, sig.Params...), sig.Result}
+	wrapper := trans.mod.AddFunction(method.Fn.Name+"$iface", fnTy.LLVMSignature())
+	llvm.SetLinkage(wrapper, llvm.InternalLinkage)
+	trans.Ifaces.Wrappers[method] = wrapper
+
+	builder := llvm.CreateBuilder()
+	defer builder.Dispose()
+	builder.PositionBuilderAtEnd(llvm.AppendBasicBlock(wrapper, "entry"))
+	recv := builder.BuildBitCast(llvm.GetParam(wrapper, 0), llvm.PointerType(MemLLVM(named), 0), "")
+	if !method.PtrRecv {
+		recv = buildLoadValue(builder, named, recv)
+	}
+	args := []llvm.Value{recv}
+	for i := range sig.Params {
+		args = append(args, llvm.GetParam(wrapper, uint(i+1)))
+	}
+	result := builder.BuildCall(method.Fn.LLVM(), args, "")
+	if sig.Result == nil {
+		builder.BuildRetVoid()
+	} else {
+		builder.BuildRet(result)
+	}
+	return wrapper
+}
+
+// returns the method set of `ty`, sorted by name as the runtime expects.
+func sortedMethodSet(ty Type) []*Method {
+	methods := append([]*Method{}, MethodSet(ty)...)
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+	return methods
+}
+
+// the named type whose methods a `ty` has, if any: `T` for both `T` and `*T`.
+func methodOwner(ty Type) *NamedType {
+	if ptr, ok := ty.(*PointerType); ok {
+		ty = ptr.At
+	}
+	named, _ := ty.(*NamedType)
+	return named
+}
+
+/*
+ * typeDescriptor returns (as an i8*) the descriptor of the dynamic type `ty`:
+ * its name, for messages, its method set, for building itables at runtime,
+ * and how to hash and compare its values, for interfaces used as map keys.
+ * Identical types share a descriptor, so comparing descriptors compares types.
+ */
+func (trans *Translator) typeDescriptor(ty Type) llvm.Value {
+	for _, desc := range trans.Ifaces.Types {
+		if desc.Ty.Eq(ty) {
+			return trans.constBytePtr(desc.Global)
+		}
+	}
+	intTy := global_type_factory.IntType(BLTN_TY_INT).LLVM()
+	methodTy := llvm.StructType([]llvm.Type{bytePtrType(), bytePtrType()}, false)
+	methods := sortedMethodSet(ty)
+	entries := make([]llvm.Value, len(methods))
+	for i, method := range methods {
+		key := trans.LLns.internCString(methodKey(method.Name, method.Signature()))
+		wrapper := trans.methodWrapper(methodOwner(ty), method)
+		entries[i] = llvm.ConstStruct([]llvm.Value{key, trans.constBytePtr(wrapper)}, false)
+	}
+	methodsPtr := llvm.ConstPointerNull(llvm.PointerType(methodTy, 0))
+	if len(entries) > 0 {
+		arrTy := llvm.ArrayType(methodTy, uint(len(entries)))
+		arr := trans.LLns.createAndSetGlobal("type."+ty.String()+".methods", arrTy, llvm.ConstArray(methodTy, entries))
+		zero := llvm.ConstInt(llvm.IntType(32), 0, false)
+		methodsPtr = llvm.ConstGEP(arr, []llvm.Value{zero, zero})
+	}
+	name := trans.LLns.internCString(ty.String())
+	count := llvm.ConstInt(intTy, uint64(len(entries)), false)
+
+	// a type whose values can't be compared has -1 parts, and panics when hashed.
+	nsegs := llvm.ConstAllOnes(intTy)
+	segsPtr := llvm.ConstPointerNull(llvm.PointerType(keySegType(), 0))
+	if isComparable(ty) {
+		segs := trans.keySegments(ty, 0, nil)
+		nsegs = llvm.ConstInt(intTy, uint64(len(segs)), false)
+		segsPtr = trans.keySegmentsGlobal("type."+ty.String()+".segs", segs)
+	}
+	var direct uint64 = 0
+	if isPointerShaped(ty) {
+		direct = 1
+	}
+	fields := []llvm.Value{name, count, methodsPtr, nsegs, segsPtr, llvm.ConstInt(intTy, direct, false)}
+	init := llvm.ConstStruct(fields, false)
+	global := trans.LLns.createAndSetGlobal("type."+ty.String(), init.Type(), init)
+	trans.Ifaces.Types = append(trans.Ifaces.Types, typeGlobal{ty, global})
+	return trans.constBytePtr(global)
+}
+
+// returns (as an i8*) the descriptor of interface `ty`: its name and method keys.
+func (trans *Translator) interfaceDescriptor(ty Type) llvm.Value {
+	for _, desc := range trans.Ifaces.Ifaces {
+		if desc.Ty.Eq(ty) {
+			return trans.constBytePtr(desc.Global)
+		}
+	}
+	iface := ty.Base().(*InterfaceType)
+	intTy := global_type_factory.IntType(BLTN_TY_INT).LLVM()
+	keys := make([]llvm.Value, len(iface.Methods))
+	for i, method := range iface.Methods {
+		keys[i] = trans.LLns.internCString(methodKey(method.Name, method.Sig))
+	}
+	keysPtr := llvm.ConstPointerNull(llvm.PointerType(bytePtrType(), 0))
+	if len(keys) > 0 {
+		arr := trans.LLns.createAndSetGlobal("iface."+ty.String()+".keys", llvm.ArrayType(bytePtrType(), uint(len(keys))), llvm.ConstArray(bytePtrType(), keys))
+		zero := llvm.ConstInt(llvm.IntType(32), 0, false)
+		keysPtr = llvm.ConstGEP(arr, []llvm.Value{zero, zero})
+	}
+	name := trans.LLns.internCString(ty.String())
+	count := llvm.ConstInt(intTy, uint64(len(keys)), false)
+	init := llvm.ConstStruct([]llvm.Value{name, count, keysPtr}, false)
+	global := trans.LLns.createAndSetGlobal("iface."+ty.String(), init.Type(), init)
+	trans.Ifaces.Ifaces = append(trans.Ifaces.Ifaces, typeGlobal{ty, global})
+	return trans.constBytePtr(global)
+}
+
+/*
+ * itab returns (as an i8*) the itable for a `ty` held in an interface of type
+ * `ifaceTy`, which `ty` must implement. Conversions the compiler can see use
+ * these; the runtime builds the same thing for conversions it can't.
+ */
+func (trans *Translator) itab(ty Type, ifaceTy Type) llvm.Value {
+	for _, desc := range trans.Ifaces.Itabs {
+		if desc.Ty.Eq(ty) && desc.Iface.Base().Eq(ifaceTy.Base()) {
+			return trans.constBytePtr(desc.Global)
+		}
+	}
+	iface := ifaceTy.Base().(*InterfaceType)
+	owner := methodOwner(ty)
+	entries := []llvm.Value{trans.typeDescriptor(ty)}
+	for _, want := range iface.Methods {
+		wrapper := trans.methodWrapper(owner, owner.Method(want.Name))
+		entries = append(entries, trans.constBytePtr(wrapper))
+	}
+	arrTy := llvm.ArrayType(bytePtrType(), uint(len(entries)))
+	global := trans.LLns.createAndSetGlobal("itab."+ty.String()+","+ifaceTy.String(), arrTy, llvm.ConstArray(bytePtrType(), entries))
+	trans.Ifaces.Itabs = append(trans.Ifaces.Itabs, itabDescriptor{ty, ifaceTy, global})
+	return trans.constBytePtr(global)
+}
+
+// pointers fit in an interface's data word as they are; other values are boxed.
+func isPointerShaped(ty Type) bool {
+	switch ty.Base().(type) {
+	case *PointerType, *UnsafePointerType:
+		return true
+	}
+	return false
+}
+
+// returns the data word for a `val` held in an interface.
+func (block *Block) buildBox(val TypedValue) llvm.Value {
+	if isPointerShaped(val.Type()) {
+		return block.Builder.BuildBitCast(val.LLVM(), bytePtrType(), "")
+	}
+	memTy := MemLLVM(val.Type())
+	size := llvm.ConstInt(global_type_factory.IntType(BLTN_TY_INT).LLVM(), block.Trans.Target.AllocSize(memTy), false)
+	box := block.buildRuntimeCall("gogo_alloc", size)
+	ptr := block.Builder.BuildBitCast(box, llvm.PointerType(memTy, 0), "")
+	buildStoreValue(block.Builder, val.Type(), val.LLVM(), ptr)
+	return box
+}
+
+// the inverse of buildBox: returns the `ty` held in the data word `data`.
+func (block *Block) buildUnbox(data llvm.Value, ty Type) TypedValue {
+	if isPointerShaped(ty) {
+		return &Register{ty, block.Builder.BuildBitCast(data, ty.LLVM(), "")}
+	}
+	ptr := block.Builder.BuildBitCast(data, llvm.PointerType(MemLLVM(ty), 0), "")
+	return &Register{ty, buildLoadValue(block.Builder, ty, ptr)}
+}
+
+func (block *Block) buildInterface(ty Type, itab llvm.Value, data llvm.Value) llvm.Value {
+	agg := llvm.Undef(ty.LLVM())
+	agg = block.Builder.BuildInsertValue(agg, itab, 0, "")
+	return block.Builder.BuildInsertValue(agg, data, 1, "")
+}
+
+func (block *Block) splitInterface(val llvm.Value) (llvm.Value, llvm.Value) {
+	itab := block.Builder.BuildExtractValue(val, 0, "")
+	data := block.Builder.BuildExtractValue(val, 1, "")
+	return itab, data
+}
+
+/*
+ * assignTo converts `val`, the value of `expr`, to `ty` for an assignment (or
+ * a call, return, etc.), where it must be assignable. With a nil `ty`, the
+ * value keeps its own type (or its default type, if it's untyped).
+ */
+func (block *Block) assignTo(expr ast.Expr, val UntypedValue, ty Type) (TypedValue, *GoDiag) {
+	if fn, ok := val.(*FuncValue); ok {
+		// a function that isn't being called is used as a closure.
+		val = &Register{fn.Ty, block.Trans.funcClosure(fn)}
+	}
+	if ty != nil {
+		if iface, ok := ty.Base().(*InterfaceType); ok {
+			if iface.Set != nil {
+				return nil, DiagFromAST(expr, "Cannot use %s outside a type constraint.", ty.String())
+			}
+			if _, isNil := val.(*NilValue); !isNil {
+				return block.buildToInterface(expr, val, ty, iface)
+			}
+		}
+		if typed, ok := val.(TypedValue); ok && typed.Type() != nil {
+			from := typed.Type()
+			if !assignable(from, ty) {
+				return nil, BindDiagToAST(expr, *TypeMismatchDiag(ty, from))
+			}
+			if !from.Eq(ty) {
+				// e.g. a []int assigned to a variable of a named slice type.
+				rval, udiag := typed.RValue(nil)
+				if udiag != nil {
+					return nil, BindDiagToAST(expr, *udiag)
+				}
+				return block.buildRetype(rval, ty), nil
+			}
+		}
+	}
+	typed, udiag := val.RValue(ty)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr, *udiag)
+	}
+	return typed, nil
+}
+
+// converts `val` to the interface type `ty`, which it must implement.
+func (block *Block) buildToInterface(expr ast.Expr, val UntypedValue, ty Type, iface *InterfaceType) (TypedValue, *GoDiag) {
+	typed, udiag := val.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr, *udiag)
+	}
+	from := typed.Type()
+	if from.Eq(ty) {
+		return typed, nil
+	}
+	if missing, hint := missingMethods(from, iface); len(missing) > 0 {
+		return nil, notImplementedDiag(expr, from, ty, missing, hint)
+	}
+
+	if underlying(from).Eq(underlying(ty)) {
+		return &Register{ty, typed.LLVM()}, nil
+	}
+	if _, ok := from.Base().(*InterfaceType); ok {
+		// the itable has to match the new interface's methods.
+		itab, data := block.splitInterface(typed.LLVM())
+		newItab := block.buildRuntimeCall("gogo_itab_convert", itab, block.Trans.interfaceDescriptor(ty))
+		return &Register{ty, block.buildInterface(ty, newItab, data)}, nil
+	}
+	itab := block.Trans.itab(from, ty)
+	return &Register{ty, block.buildInterface(ty, itab, block.buildBox(typed))}, nil
+}
+
+/*
+ * selectIfaceMethod selects the method `expr.Sel` of the interface value `x`,
+ * looking its implementation up in the itable. The receiver is the data word.
+ */
+func (block *Block) selectIfaceMethod(expr *ast.SelectorExpr, x TypedValue, iface *InterfaceType) *BoundMethod {
+	idx := iface.MethodIndex(expr.Sel.Name)
+	if idx < 0 {
+		return nil
+	}
+	itab, data := block.splitInterface(x.LLVM())
+	block.buildNilCheck(itab)
+	slots := block.Builder.BuildBitCast(itab, llvm.PointerType(bytePtrType(), 0), "")
+	slot := block.Builder.BuildGEP(slots, []llvm.Value{llvm.ConstInt(llvm.IntType(32), uint64(idx+1), false)}, "")
+	sig := iface.Methods[idx].Sig
+	fnTy := &FuncType{append([]Type{&PointerType{global_type_factory.IntType(BLTN_TY_UINT8)}}, sig.Params...), sig.Result}
+	fn := block.Builder.BuildBitCast(block.Builder.BuildLoad(slot, ""), llvm.PointerType(fnTy.LLVMSignature(), 0), "")
+	method := &Method{expr.Sel.Name, false, &FuncValue{expr.Sel.Name, fnTy, fn}}
+	return &BoundMethod{method, data}
+}
+
+// panics with a nil dereference if `ptr` is null.
+func (block *Block) buildNilCheck(ptr llvm.Value) {
+	isNil := block.Builder.BuildICmp(llvm.IntEQ, ptr, llvm.ConstPointerNull(ptr.Type()), "")
+	block.buildRuntimeCheck(isNil, block.Trans.runtimeFunction("gogo_panic_nil"))
+}
+
+// translates the operand of a type assertion, which must be an interface.
+func (block *Block) translateAssertOperand(expr *ast.TypeAssertExpr) (TypedValue, *InterfaceType, *GoDiag) {
+	x, diag := block.translateOperand(expr.X)
+	if diag != nil {
+		return nil, nil, diag
+	}
+	typed, udiag := x.RValue(nil)
+	if udiag != nil {
+		return nil, nil, BindDiagToAST(expr.X, *udiag)
+	}
+	iface, ok := typed.Type().Base().(*InterfaceType)
+	if !ok {
+		return nil, nil, DiagFromAST(expr.X, "Invalid type assertion: a value of type %s is not an interface.", typed.Type().String())
+	}
+	return typed, iface, nil
+}
+
+/*
+ * buildTypeMatch builds the test of whether the interface value `x` holds a
+ * `ty`. If `ty` is an interface, the itable for the result is returned too.
+ */
+func (block *Block) buildTypeMatch(expr ast.Expr, x TypedValue, iface *InterfaceType, ty Type) (llvm.Value, llvm.Value, *GoDiag) {
+	itab, _ := block.splitInterface(x.LLVM())
+	if _, ok := ty.Base().(*InterfaceType); ok {
+		newItab := block.buildRuntimeCall("gogo_itab_convert", itab, block.Trans.interfaceDescriptor(ty))
+		ok := block.Builder.BuildICmp(llvm.IntNE, newItab, llvm.ConstPointerNull(bytePtrType()), "")
+		return ok, newItab, nil
+	}
+	if missing, hint := missingMethods(ty, iface); len(missing) > 0 {
+		diag := DiagFromAST(expr, "Impossible type assertion: %s does not implement %s (missing %s).", ty.String(), x.Type().String(), strings.Join(missing, ", "))
+		if hint != "" {
+			diag = diag.WithHint(hint)
+		}
+		return llvm.Value{}, llvm.Value{}, diag
+	}
+	dynType := block.buildRuntimeCall("gogo_type_of", itab)
+	ok := block.Builder.BuildICmp(llvm.IntEQ, dynType, block.Trans.typeDescriptor(ty), "")
+	return ok, llvm.Value{}, nil
+}
+
+// returns the `ty` held by `x`, once buildTypeMatch has found it's there.
+func (block *Block) buildAsserted(x TypedValue, ty Type, newItab llvm.Value) TypedValue {
+	_, data := block.splitInterface(x.LLVM())
+	if _, ok := ty.Base().(*InterfaceType); ok {
+		return &Register{ty, block.buildInterface(ty, newItab, data)}
+	}
+	return block.buildUnbox(data, ty)
+}
+
+// translates `x.(T)`, which panics if `x` doesn't hold a `T`.
+func (block *Block) translateTypeAssert(expr *ast.TypeAssertExpr) (UntypedValue, *GoDiag) {
+	if expr.Type == nil {
+		return nil, DiagFromAST(expr, "Use of .(type) outside of a type switch.")
+	}
+	x, iface, diag := block.translateAssertOperand(expr)
+	if diag != nil {
+		return nil, diag
+	}
+	ty, diag := block.translateType(expr.Type)
+	if diag != nil {
+		return nil, diag
+	}
+	ok, newItab, diag := block.buildTypeMatch(expr.Type, x, iface, ty)
+	if diag != nil {
+		return nil, diag
+	}
+	itab, _ := block.splitInterface(x.LLVM())
+	failed := block.Builder.BuildNot(ok, "")
+	ns := block.Trans.LLns
+	if _, isIface := ty.Base().(*InterfaceType); isIface {
+		block.buildRuntimeCheck(failed, block.Trans.runtimeFunction("gogo_panic_assert_iface"), itab, ns.internCString(x.Type().String()), block.Trans.interfaceDescriptor(ty))
+	} else {
+		block.buildRuntimeCheck(failed, block.Trans.runtimeFunction("gogo_panic_assert"), itab, ns.internCString(x.Type().String()), ns.internCString(ty.String()))
+	}
+	return block.buildAsserted(x, ty, newItab), nil
+}
+
+/*
+ * translateAssertCommaOk translates `v, ok := x.(T)`, which doesn't panic:
+ * if `x` doesn't hold a `T`, `v` is the zero `T` and `ok` is false.
+ */
+func (block *Block) translateAssertCommaOk(expr *ast.TypeAssertExpr) (TypedValue, TypedValue, *GoDiag) {
+	if expr.Type == nil {
+		return nil, nil, DiagFromAST(expr, "Use of .(type) outside of a type switch.")
+	}
+	x, iface, diag := block.translateAssertOperand(expr)
+	if diag != nil {
+		return nil, nil, diag
+	}
+	ty, diag := block.translateType(expr.Type)
+	if diag != nil {
+		return nil, nil, diag
+	}
+	ok, newItab, diag := block.buildTypeMatch(expr.Type, x, iface, ty)
+	if diag != nil {
+		return nil, nil, diag
+	}
+	result := block.createVariable("assert.val", ty)
+	buildStoreValue(block.Builder, ty, ty.Zero(block.Trans.LLns).LLVM(), result.Ptr)
+	okBB := block.appendBasicBlock("assert.ok")
+	endBB := block.appendBasicBlock("assert.end")
+	block.buildCondBr(ok, okBB, endBB)
+	block.positionAtEnd(okBB)
+	result.BuildAssign(block, block.buildAsserted(x, ty, newItab))
+	block.buildBr(endBB)
+	block.positionAtEnd(endBB)
+	return &Register{ty, result.LLVM()}, &Register{global_type_factory.BoolType(), ok}, nil
+}
+
+/*
+ * translateTypeSwitch translates `switch v := x.(type) { ... }`. Each case's
+ * types are tested in order, and the first match runs its clause; if none
+ * match, the default clause (if any) runs. In a clause with a single type,
+ * `v` has that type; otherwise, it's `x` itself.
+ */
+func (block *Block) translateTypeSwitch(stmt *ast.TypeSwitchStmt) *GoDiag {
+	scoped := block.createChild()
+	if stmt.Init != nil {
+		if diag := scoped.translateStatement(stmt.Init); diag != nil {
+			return diag
+		}
+	}
+	var bind *ast.Ident
+	var assert *ast.TypeAssertExpr
+	switch guard := stmt.Assign.(type) {
+	case *ast.AssignStmt:
+		bind, _ = guard.Lhs[0].(*ast.Ident)
+		assert, _ = guard.Rhs[0].(*ast.TypeAssertExpr)
+	case *ast.ExprStmt:
+		assert, _ = guard.X.(*ast.TypeAssertExpr)
+	}
+	x, iface, diag := scoped.translateAssertOperand(assert)
+	if diag != nil {
+		return diag
+	}
+	itab, _ := scoped.splitInterface(x.LLVM())
+
+	endBB := scoped.appendBasicBlock("typeswitch.end")
+	// break leaves the switch; continue still refers to the enclosing loop.
+	loop := &Loop{Break: endBB, IsSwitch: true, Outer: block.Loop}
+	fallsThrough := false
+	var dflt *ast.CaseClause
+	for _, clauseStmt := range stmt.Body.List {
+		clause, _ := clauseStmt.(*ast.CaseClause)
+		if clause.List == nil {
+			dflt = clause
+			continue
+		}
+		bodyBB := scoped.appendBasicBlock("typeswitch.case")
+		var bound TypedValue = x
+		var boundTy Type
+		var newItab llvm.Value
+		for _, tyExpr := range clause.List {
+			var ok llvm.Value
+			if scoped.isNilExpr(tyExpr) {
+				ok = scoped.Builder.BuildICmp(llvm.IntEQ, itab, llvm.ConstPointerNull(bytePtrType()), "")
+			} else {
+				ty, diag := scoped.translateType(tyExpr)
+				if diag != nil {
+					return diag
+				}
+				ok, newItab, diag = scoped.buildTypeMatch(tyExpr, x, iface, ty)
+				if diag != nil {
+					return diag
+				}
+				boundTy = ty
+			}
+			nextBB := scoped.appendBasicBlock("typeswitch.next")
+			scoped.buildCondBr(ok, bodyBB, nextBB)
+			scoped.positionAtEnd(nextBB)
+		}
+
+		clauseBlock := scoped.createChild()
+		clauseBlock.Loop = loop
+		clauseBlock.positionAtEnd(bodyBB)
+		if len(clause.List) == 1 && boundTy != nil {
+			bound = clauseBlock.buildAsserted(x, boundTy, newItab)
+		}
+		if bind != nil {
+			if diag := clauseBlock.declareVariable(bind, bound); diag != nil {
+				return diag
+			}
+		}
+		if diag := clauseBlock.translateStatements(clause.Body); diag != nil {
+			return diag
+		}
+		if !clauseBlock.Terminated {
+			clauseBlock.buildBr(endBB)
+			fallsThrough = true
+		}
+		// the next clause's tests carry on from where these left off.
+		scoped.positionAtEnd(scoped.Block)
+	}
+
+	// every test failed.
+	if dflt != nil {
+		dfltBlock := scoped.createChild()
+		dfltBlock.Loop = loop
+		dfltBlock.positionAtEnd(scoped.Block)
+		if bind != nil {
+			if diag := dfltBlock.declareVariable(bind, x); diag != nil {
+				return diag
+			}
+		}
+		if diag := dfltBlock.translateStatements(dflt.Body); diag != nil {
+			return diag
+		}
+		if !dfltBlock.Terminated {
+			dfltBlock.buildBr(endBB)
+			fallsThrough = true
+		}
+	} else {
+		scoped.buildBr(endBB)
+		fallsThrough = true
+	}
+
+	block.positionAtEnd(endBB)
+	if !fallsThrough && !loop.Broken {
+		block.Builder.BuildUnreachable()
+		block.Terminated = true
+	}
+	return nil
+}
+
+// reports whether `expr` is the predeclared nil (and not something shadowing it).
+func (block *Block) isNilExpr(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	bound := block.Scope.lookupVar(ident.Name)
+	if bound == nil {
+		return false
+	}
+	_, isNil := bound.Val.(*NilValue)
+	return isNil
+}
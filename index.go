@@ -0,0 +1,304 @@
+package main
+
+import "go/ast"
+import "llvm"
+import "math/big"
+
+/*
+ * translateIndex translates an index or slice bound, which may have any
+ * integer type, and converts it to an int. Constant indices must not be
+ * negative.
+ */
+func (block *Block) translateIndex(expr ast.Expr) (TypedValue, *GoDiag) {
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	val, diag := block.translateOperand(expr)
+	if diag != nil {
+		return nil, diag
+	}
+	var typed TypedValue
+	var udiag *UDiag
+	if isUntyped(val) {
+		typed, udiag = val.RValue(intTy)
+	} else {
+		typed, udiag = val.RValue(nil)
+	}
+	if udiag != nil {
+		return nil, BindDiagToAST(expr, *udiag)
+	}
+	idxTy, ok := typed.Type().Base().(*IntType)
+	if !ok {
+		return nil, DiagFromAST(expr, "Index must be an integer, but found type %s.", typed.Type().String())
+	}
+	if cnst, ok := typed.(*TypedConstInt); ok {
+		if cnst.Inner.Int.Sign() < 0 {
+			return nil, DiagFromAST(expr, "Index %s must not be negative.", cnst.Inner.Int.String())
+		}
+		return &TypedConstInt{cnst.Inner, intTy}, nil
+	}
+	resized := block.buildIntResize(typed.LLVM(), idxTy, intTy.(*IntType))
+	return &Register{intTy, resized}, nil
+}
+
+// returns the value of a constant index, if it is one.
+func constIndex(val TypedValue) (*big.Int, bool) {
+	cnst, ok := val.(*TypedConstInt)
+	if !ok {
+		return nil, false
+	}
+	return cnst.Inner.Int, true
+}
+
+// panics at runtime unless 0 <= index < length.
+func (block *Block) buildIndexCheck(index llvm.Value, length llvm.Value) {
+	// a negative index is a huge unsigned one, so one comparison does both.
+	outOfRange := block.Builder.BuildICmp(llvm.IntUGE, index, length, "")
+	block.buildRuntimeCheck(outOfRange, block.Trans.runtimeFunction("gogo_panic_index"), index, length)
+}
+
+/*
+ * panics at runtime unless 0 <= low <= high <= max. `panicFn` reports the
+ * failure, and says whether `max` is a length or a capacity.
+ */
+func (block *Block) buildSliceCheck(low llvm.Value, high llvm.Value, max llvm.Value, panicFn string) {
+	builder := block.Builder
+	highBad := builder.BuildICmp(llvm.IntUGT, high, max, "")
+	lowBad := builder.BuildICmp(llvm.IntUGT, low, high, "")
+	outOfRange := builder.BuildOr(highBad, lowBad, "")
+	block.buildRuntimeCheck(outOfRange, block.Trans.runtimeFunction(panicFn), low, high, max)
+}
+
+// panics at runtime unless 0 <= low <= high <= max <= cap.
+func (block *Block) buildSlice3Check(low llvm.Value, high llvm.Value, max llvm.Value, capacity llvm.Value) {
+	builder := block.Builder
+	maxBad := builder.BuildICmp(llvm.IntUGT, max, capacity, "")
+	highBad := builder.BuildICmp(llvm.IntUGT, high, max, "")
+	lowBad := builder.BuildICmp(llvm.IntUGT, low, high, "")
+	outOfRange := builder.BuildOr(builder.BuildOr(maxBad, highBad, ""), lowBad, "")
+	block.buildRuntimeCheck(outOfRange, block.Trans.runtimeFunction("gogo_panic_slice3"), low, high, max, capacity)
+}
+
+/*
+ * translateIndexExpr translates `x[i]`. Elements of slices and of addressable
+ * arrays are themselves addressable, so those are returned as Variables, which
+ * can be assigned to.
+ */
+func (block *Block) translateIndexExpr(expr *ast.IndexExpr) (UntypedValue, *GoDiag) {
+	x, diag := block.translateOperand(expr.X)
+	if diag != nil {
+		return nil, diag
+	}
+	x = block.derefArray(x)
+	if !isUntyped(x) {
+		if m, ok := x.(TypedValue).Type().Base().(*MapType); ok {
+			typed, udiag := x.RValue(nil)
+			if udiag != nil {
+				return nil, BindDiagToAST(expr.X, *udiag)
+			}
+			return block.translateMapIndex(expr, typed, m)
+		}
+	}
+	index, diag := block.translateIndex(expr.Index)
+	if diag != nil {
+		return nil, diag
+	}
+	if variable, ok := x.(*Variable); ok {
+		if arrTy, ok := variable.Ty.Base().(*ArrayType); ok {
+			return block.buildArrayElement(expr, variable.Ptr, arrTy, index)
+		}
+	}
+
+	typed, udiag := x.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr.X, *udiag)
+	}
+	switch base := typed.Type().Base().(type) {
+	case *SliceType:
+		// slice elements live in the backing array, so they're always addressable.
+		ptr, length, _ := block.splitSlice(typed.LLVM())
+		block.buildIndexCheck(index.LLVM(), length)
+		elemPtr := block.Builder.BuildInBoundsGEP(ptr, []llvm.Value{index.LLVM()}, "")
+		return &Variable{base.Elem, elemPtr, block.Builder}, nil
+	case *ArrayType:
+		// e.g. the result of a call: with a constant index, we can take the
+		// element straight out of the aggregate.
+		if idx, ok := constIndex(index); ok {
+			if diag := checkConstIndex(expr, idx, base.Len); diag != nil {
+				return nil, diag
+			}
+			elem := block.Builder.BuildExtractValue(typed.LLVM(), uint(idx.Int64()), "")
+			return &Register{base.Elem, buildFromMem(block.Builder, base.Elem, elem)}, nil
+		}
+		tmp := block.buildAlloca(MemLLVM(typed.Type()), "array.tmp")
+		buildStoreValue(block.Builder, typed.Type(), typed.LLVM(), tmp)
+		elem, diag := block.buildArrayElement(expr, tmp, base, index)
+		if diag != nil {
+			return nil, diag
+		}
+		// but it still isn't addressable.
+		return &Register{base.Elem, elem.LLVM()}, nil
+	case *StringType:
+		byteTy := global_type_factory.IntType(BLTN_TY_UINT8)
+		if str, ok := typed.(*TypedConstString); ok {
+			if idx, ok := constIndex(index); ok && idx.Cmp(big.NewInt(int64(len(str.Inner.Str)))) >= 0 {
+				return nil, DiagFromAST(expr.Index, "Index %s out of range for string of length %d.", idx.String(), len(str.Inner.Str))
+			}
+		}
+		ptr, length := block.splitString(typed.LLVM())
+		block.buildIndexCheck(index.LLVM(), length)
+		elemPtr := block.Builder.BuildInBoundsGEP(ptr, []llvm.Value{index.LLVM()}, "")
+		return &Register{byteTy, block.Builder.BuildLoad(elemPtr, "")}, nil
+	}
+	return nil, DiagFromAST(expr.X, "Cannot index a value of type %s.", typed.Type().String())
+}
+
+// returns the element at `index` of the array at `ptr`, checking its bounds.
+func (block *Block) buildArrayElement(expr *ast.IndexExpr, ptr llvm.Value, arrTy *ArrayType, index TypedValue) (*Variable, *GoDiag) {
+	if idx, ok := constIndex(index); ok {
+		if diag := checkConstIndex(expr, idx, arrTy.Len); diag != nil {
+			return nil, diag
+		}
+	} else {
+		block.buildIndexCheck(index.LLVM(), constIntValue(arrTy.Len).LLVM())
+	}
+	zero := llvm.ConstInt(index.Type().LLVM(), 0, false)
+	elemPtr := block.Builder.BuildInBoundsGEP(ptr, []llvm.Value{zero, index.LLVM()}, "")
+	return &Variable{arrTy.Elem, elemPtr, block.Builder}, nil
+}
+
+func checkConstIndex(expr *ast.IndexExpr, idx *big.Int, length int64) *GoDiag {
+	if idx.Cmp(big.NewInt(length)) >= 0 {
+		return DiagFromAST(expr.Index, "Index %s out of range for array of length %d.", idx.String(), length)
+	}
+	return nil
+}
+
+// translates the optional bound of a slice expression; a missing one is `dflt`.
+func (block *Block) translateSliceBound(expr ast.Expr, dflt TypedValue) (TypedValue, *GoDiag) {
+	if expr == nil {
+		return dflt, nil
+	}
+	return block.translateIndex(expr)
+}
+
+/*
+ * translateSliceExpr translates `x[low:high]` and `x[low:high:max]`. Strings
+ * slice to strings; arrays (which must be addressable) and slices slice to
+ * slices sharing the same elements.
+ */
+func (block *Block) translateSliceExpr(expr *ast.SliceExpr) (UntypedValue, *GoDiag) {
+	x, diag := block.translateOperand(expr.X)
+	if diag != nil {
+		return nil, diag
+	}
+	x = block.derefArray(x)
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+
+	// where the elements start, how many there are, and how many there's room for.
+	var ptr llvm.Value
+	var length, capacity TypedValue
+	var resultTy Type
+	panicFn := "gogo_panic_slice"
+	isString := false
+	if variable, ok := x.(*Variable); ok && isArrayType(variable.Ty) {
+		arrTy, _ := variable.Ty.Base().(*ArrayType)
+		zero := llvm.ConstInt(intTy.LLVM(), 0, false)
+		ptr = block.Builder.BuildInBoundsGEP(variable.Ptr, []llvm.Value{zero, zero}, "")
+		length = constIntValue(arrTy.Len)
+		capacity = length
+		resultTy = &SliceType{arrTy.Elem}
+	} else {
+		typed, udiag := x.RValue(nil)
+		if udiag != nil {
+			return nil, BindDiagToAST(expr.X, *udiag)
+		}
+		resultTy = typed.Type()
+		switch typed.Type().Base().(type) {
+		case *StringType:
+			if expr.Slice3 {
+				return nil, DiagFromAST(expr, "Cannot use a 3-index slice expression on a string.")
+			}
+			var strLen llvm.Value
+			ptr, strLen = block.splitString(typed.LLVM())
+			length = &Register{intTy, strLen}
+			if str, ok := typed.(*TypedConstString); ok {
+				length = constIntValue(int64(len(str.Inner.Str)))
+			}
+			capacity = length
+			isString = true
+		case *SliceType:
+			var sliceLen, sliceCap llvm.Value
+			ptr, sliceLen, sliceCap = block.splitSlice(typed.LLVM())
+			length = &Register{intTy, sliceLen}
+			capacity = &Register{intTy, sliceCap}
+			panicFn = "gogo_panic_slice_cap"
+		case *ArrayType:
+			return nil, DiagFromAST(expr.X, "Cannot slice an array that isn't addressable.")
+		default:
+			return nil, DiagFromAST(expr.X, "Cannot slice a value of type %s.", typed.Type().String())
+		}
+	}
+
+	low, diag := block.translateSliceBound(expr.Low, constIntValue(0))
+	if diag != nil {
+		return nil, diag
+	}
+	high, diag := block.translateSliceBound(expr.High, length)
+	if diag != nil {
+		return nil, diag
+	}
+	if expr.High != nil {
+		if diag := checkConstBound(expr.High, high, capacity); diag != nil {
+			return nil, diag
+		}
+	}
+	max := capacity
+	if expr.Slice3 {
+		max, diag = block.translateIndex(expr.Max)
+		if diag != nil {
+			return nil, diag
+		}
+		if diag := checkConstBound(expr.Max, max, capacity); diag != nil {
+			return nil, diag
+		}
+	}
+	if diag := checkConstBounds(expr, low, high, max); diag != nil {
+		return nil, diag
+	}
+	if expr.Slice3 {
+		block.buildSlice3Check(low.LLVM(), high.LLVM(), max.LLVM(), capacity.LLVM())
+	} else {
+		block.buildSliceCheck(low.LLVM(), high.LLVM(), capacity.LLVM(), panicFn)
+	}
+
+	newPtr := block.Builder.BuildGEP(ptr, []llvm.Value{low.LLVM()}, "")
+	newLen := block.Builder.BuildSub(high.LLVM(), low.LLVM(), "")
+	if isString {
+		return &Register{resultTy, block.buildString(resultTy, newPtr, newLen)}, nil
+	}
+	newCap := block.Builder.BuildSub(max.LLVM(), low.LLVM(), "")
+	return &Register{resultTy, block.buildSlice(resultTy, newPtr, newLen, newCap)}, nil
+}
+
+// reports slice bounds that are already known to be out of order at compile time.
+func checkConstBounds(expr *ast.SliceExpr, low TypedValue, high TypedValue, max TypedValue) *GoDiag {
+	lowConst, lowOk := constIndex(low)
+	highConst, highOk := constIndex(high)
+	maxConst, maxOk := constIndex(max)
+	if lowOk && highOk && lowConst.Cmp(highConst) > 0 {
+		return DiagFromAST(expr, "Invalid slice indices: %s > %s.", lowConst.String(), highConst.String())
+	}
+	if highOk && maxOk && highConst.Cmp(maxConst) > 0 {
+		return DiagFromAST(expr, "Invalid slice indices: %s > %s.", highConst.String(), maxConst.String())
+	}
+	return nil
+}
+
+// reports a slice bound that is already known to be out of range at compile time.
+func checkConstBound(expr ast.Expr, bound TypedValue, max TypedValue) *GoDiag {
+	boundConst, boundOk := constIndex(bound)
+	maxConst, maxOk := constIndex(max)
+	if boundOk && maxOk && boundConst.Cmp(maxConst) > 0 {
+		return DiagFromAST(expr, "Index %s out of range for length %s.", boundConst.String(), maxConst.String())
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import "go/ast"
+import "go/token"
+import "llvm"
+import "sort"
+
+/*
+ * The targets of the break and continue statements in a loop. A switch only
+ * has a break target; a continue inside one belongs to the enclosing loop,
+ * `Outer`.
+ */
+type Loop struct {
+	Break    llvm.BasicBlock
+	Continue llvm.BasicBlock
+	IsSwitch bool
+	Outer    *Loop
+	// set once something breaks out, which makes the code after it reachable.
+	Broken bool
+}
+
+/*
+ * translateFor translates `for init; cond; post { ... }`, where any of the
+ * three may be missing. Without a condition, the loop only ends by breaking
+ * out of it (or returning).
+ */
+func (block *Block) translateFor(stmt *ast.ForStmt) *GoDiag {
+	// anything declared by the init statement is only visible inside the loop.
+	scoped := block.createChild()
+	if stmt.Init != nil {
+		if diag := scoped.translateStatement(stmt.Init); diag != nil {
+			return diag
+		}
+	}
+	condBB := scoped.appendBasicBlock("for.cond")
+	bodyBB := scoped.appendBasicBlock("for.body")
+	postBB := scoped.appendBasicBlock("for.post")
+	endBB := scoped.appendBasicBlock("for.end")
+	scoped.buildBr(condBB)
+
+	scoped.positionAtEnd(condBB)
+	if stmt.Cond != nil {
+		cond, diag := scoped.translateExprRHSTyped(stmt.Cond, nil)
+		if diag != nil {
+			return diag
+		}
+		if _, ok := cond.Type().Base().(*BoolType); !ok {
+			return DiagFromAST(stmt.Cond, "Non-boolean condition (type %s) in for statement.", cond.Type().String())
+		}
+		scoped.buildCondBr(cond.LLVM(), bodyBB, endBB)
+	} else {
+		scoped.buildBr(bodyBB)
+	}
+
+	loop := &Loop{Break: endBB, Continue: postBB}
+	scoped.positionAtEnd(bodyBB)
+	iteration := scoped.createChild()
+	copies := iteration.copyLoopVariables(scoped.Scope)
+	if diag := iteration.translateLoopBody(stmt.Body, loop, postBB); diag != nil {
+		return diag
+	}
+
+	scoped.positionAtEnd(postBB)
+	for _, copied := range copies {
+		buildStoreValue(scoped.Builder, copied.Ty, copied.Copy.LLVM(), copied.Var.Ptr)
+	}
+	if stmt.Post != nil {
+		if diag := scoped.translateStatement(stmt.Post); diag != nil {
+			return diag
+		}
+	}
+	scoped.buildBr(condBB)
+
+	block.finishLoop(endBB, stmt.Cond != nil || loop.Broken)
+	return nil
+}
+
+// a loop variable, and the copy of it that one iteration of the loop uses.
+type loopCopy struct {
+	Ty   Type
+	Var  *Variable
+	Copy *Variable
+}
+
+/*
+ * Each iteration of a three-clause loop has its own copy of the variables
+ * declared by the init statement, so closures created in different iterations
+ * don't share them. Only variables that closures capture need copies; they're
+ * bound in the current scope, copied from `loopScope` at the start of the
+ * iteration, and copied back before the post statement runs.
+ */
+func (block *Block) copyLoopVariables(loopScope *Scope) []loopCopy {
+	variables := make(map[string]*Variable)
+	names := make([]string, 0)
+	for name, bound := range *loopScope.Values {
+		if variable, ok := bound.Val.(*Variable); ok && block.Escaping[name] {
+			variables[name] = variable
+			names = append(names, name)
+		}
+	}
+	// sorted, so that the copies are made in the same order every time.
+	sort.Strings(names)
+	copies := make([]loopCopy, len(names))
+	for i, name := range names {
+		variable := variables[name]
+		copied := block.createHeapVariable(variable.Ty)
+		buildStoreValue(block.Builder, variable.Ty, variable.LLVM(), copied.Ptr)
+		block.Scope.addValue(name, copied)
+		copies[i] = loopCopy{variable.Ty, variable, copied}
+	}
+	return copies
+}
+
+// translates the body of a loop, which goes on to `next` when it's done.
+func (block *Block) translateLoopBody(body *ast.BlockStmt, loop *Loop, next llvm.BasicBlock) *GoDiag {
+	child := block.createChild()
+	child.Loop = loop
+	if diag := child.translateStatements(body.List); diag != nil {
+		return diag
+	}
+	if !child.Terminated {
+		child.buildBr(next)
+	}
+	return nil
+}
+
+// carries on after a loop, unless nothing can get there.
+func (block *Block) finishLoop(endBB llvm.BasicBlock, reachable bool) {
+	block.positionAtEnd(endBB)
+	if !reachable {
+		block.Builder.BuildUnreachable()
+		block.Terminated = true
+	}
+}
+
+func (block *Block) translateBranch(stmt *ast.BranchStmt) *GoDiag {
+	if stmt.Label != nil {
+		return DiagFromAST(stmt, "Labeled %s statements are not supported yet.", stmt.Tok)
+	}
+	switch stmt.Tok {
+	case token.BREAK:
+		if block.Loop == nil {
+			return DiagFromAST(stmt, "break is not in a loop or switch.")
+		}
+		block.Loop.Broken = true
+		block.buildBr(block.Loop.Break)
+	case token.CONTINUE:
+		loop := block.Loop
+		for loop != nil && loop.IsSwitch {
+			loop = loop.Outer
+		}
+		if loop == nil {
+			return DiagFromAST(stmt, "continue is not in a loop.")
+		}
+		block.buildBr(loop.Continue)
+	default:
+		return DiagFromAST(stmt, "%s statements are not supported yet.", stmt.Tok)
+	}
+	return nil
+}
+
+/*
+ * translateRange translates `for k, v := range x { ... }` (or `=`, to assign
+ * to existing variables). `x` is evaluated once, before the loop starts, and
+ * may be an integer, an array, a slice, a string or a map.
+ */
+func (block *Block) translateRange(stmt *ast.RangeStmt) *GoDiag {
+	scoped := block.createChild()
+	x, diag := scoped.translateOperand(stmt.X)
+	if diag != nil {
+		return diag
+	}
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	var typed TypedValue
+	var udiag *UDiag
+	if isUntyped(x) {
+		// `range 10` counts with ints.
+		typed, udiag = x.RValue(intTy)
+	} else {
+		typed, udiag = x.RValue(nil)
+	}
+	if udiag != nil {
+		return BindDiagToAST(stmt.X, *udiag)
+	}
+
+	switch base := typed.Type().Base().(type) {
+	case *IntType:
+		if stmt.Value != nil {
+			return DiagFromAST(stmt.Value, "Range over %s permits only one iteration variable.", typed.Type().String())
+		}
+		diag = scoped.buildCountingRange(stmt, typed.Type(), typed.LLVM(), nil)
+	case *ArrayType:
+		length := llvm.ConstInt(intTy.LLVM(), uint64(base.Len), false)
+		if stmt.Value == nil {
+			diag = scoped.buildCountingRange(stmt, intTy, length, nil)
+			break
+		}
+		// the loop ranges over a copy of the array.
+		arr := scoped.createVariable("range.arr", typed.Type())
+		buildStoreValue(scoped.Builder, typed.Type(), typed.LLVM(), arr.Ptr)
+		diag = scoped.buildCountingRange(stmt, intTy, length, func(idx llvm.Value) TypedValue {
+			zero := llvm.ConstInt(intTy.LLVM(), 0, false)
+			elemPtr := scoped.Builder.BuildInBoundsGEP(arr.Ptr, []llvm.Value{zero, idx}, "")
+			return &Register{base.Elem, buildLoadValue(scoped.Builder, base.Elem, elemPtr)}
+		})
+	case *SliceType:
+		ptr, length, _ := scoped.splitSlice(typed.LLVM())
+		diag = scoped.buildCountingRange(stmt, intTy, length, func(idx llvm.Value) TypedValue {
+			elemPtr := scoped.Builder.BuildInBoundsGEP(ptr, []llvm.Value{idx}, "")
+			return &Register{base.Elem, buildLoadValue(scoped.Builder, base.Elem, elemPtr)}
+		})
+	case *StringType:
+		diag = scoped.buildStringRange(stmt, typed.LLVM())
+	case *MapType:
+		diag = scoped.buildMapRange(stmt, typed.LLVM(), base)
+	default:
+		return DiagFromAST(stmt.X, "Cannot range over a value of type %s.", typed.Type().String())
+	}
+	if diag != nil {
+		return diag
+	}
+	block.continueFrom(scoped)
+	return nil
+}
+
+/*
+ * buildCountingRange builds a range loop whose key counts from 0 up to `n`,
+ * which has type `keyTy`. `elem` gives the value for each key, if there is one.
+ */
+func (block *Block) buildCountingRange(stmt *ast.RangeStmt, keyTy Type, n llvm.Value, elem func(llvm.Value) TypedValue) *GoDiag {
+	counter := block.createVariable("range.idx", keyTy)
+	buildStoreValue(block.Builder, keyTy, llvm.ConstInt(keyTy.LLVM(), 0, false), counter.Ptr)
+	condBB := block.appendBasicBlock("range.cond")
+	bodyBB := block.appendBasicBlock("range.body")
+	postBB := block.appendBasicBlock("range.post")
+	endBB := block.appendBasicBlock("range.end")
+	block.buildBr(condBB)
+
+	block.positionAtEnd(condBB)
+	idx := counter.LLVM()
+	signed := true
+	if intTy, ok := keyTy.Base().(*IntType); ok {
+		signed = intTy.Signed()
+	}
+	block.buildCondBr(block.Builder.BuildICmp(intPredicate(token.LSS, signed), idx, n, ""), bodyBB, endBB)
+
+	block.positionAtEnd(bodyBB)
+	var value TypedValue
+	if elem != nil && stmt.Value != nil {
+		value = elem(idx)
+	}
+	if diag := block.bindRangeVars(stmt, &Register{keyTy, idx}, value); diag != nil {
+		return diag
+	}
+	loop := &Loop{Break: endBB, Continue: postBB}
+	if diag := block.translateLoopBody(stmt.Body, loop, postBB); diag != nil {
+		return diag
+	}
+
+	block.positionAtEnd(postBB)
+	next := block.Builder.BuildAdd(counter.LLVM(), llvm.ConstInt(keyTy.LLVM(), 1, false), "")
+	buildStoreValue(block.Builder, keyTy, next, counter.Ptr)
+	block.buildBr(condBB)
+	block.finishLoop(endBB, true)
+	return nil
+}
+
+/*
+ * buildStringRange builds a range loop over the runes of the string `str`.
+ * The key is the index of the first byte of each rune, and the value the
+ * rune itself; invalid UTF-8 yields U+FFFD, one byte at a time.
+ */
+func (block *Block) buildStringRange(stmt *ast.RangeStmt, str llvm.Value) *GoDiag {
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	runeTy := global_type_factory.IntType(BLTN_TY_INT32)
+	ptr, length := block.splitString(str)
+	counter := block.createVariable("range.idx", intTy)
+	buildStoreValue(block.Builder, intTy, llvm.ConstInt(intTy.LLVM(), 0, false), counter.Ptr)
+	width := block.buildAlloca(intTy.LLVM(), "range.width")
+	condBB := block.appendBasicBlock("range.cond")
+	bodyBB := block.appendBasicBlock("range.body")
+	postBB := block.appendBasicBlock("range.post")
+	endBB := block.appendBasicBlock("range.end")
+	block.buildBr(condBB)
+
+	block.positionAtEnd(condBB)
+	idx := counter.LLVM()
+	block.buildCondBr(block.Builder.BuildICmp(llvm.IntSLT, idx, length, ""), bodyBB, endBB)
+
+	block.positionAtEnd(bodyBB)
+	r := block.buildRuntimeCall("gogo_string_decode_rune", ptr, length, idx, width)
+	var value TypedValue
+	if stmt.Value != nil {
+		value = &Register{runeTy, r}
+	}
+	if diag := block.bindRangeVars(stmt, &Register{intTy, idx}, value); diag != nil {
+		return diag
+	}
+	loop := &Loop{Break: endBB, Continue: postBB}
+	if diag := block.translateLoopBody(stmt.Body, loop, postBB); diag != nil {
+		return diag
+	}
+
+	block.positionAtEnd(postBB)
+	next := block.Builder.BuildAdd(counter.LLVM(), block.Builder.BuildLoad(width, ""), "")
+	buildStoreValue(block.Builder, intTy, next, counter.Ptr)
+	block.buildBr(condBB)
+	block.finishLoop(endBB, true)
+	return nil
+}
+
+// the number of words in the runtime's map iterators (see rt/common/map.c).
+const mapIterWords = 4
+
+// builds a range loop over the map `m`, in the runtime's (random) order.
+func (block *Block) buildMapRange(stmt *ast.RangeStmt, m llvm.Value, mapTy *MapType) *GoDiag {
+	iter := block.buildAlloca(llvm.ArrayType(bytePtrType(), mapIterWords), "range.iter")
+	iterPtr := block.buildBytePtr(iter)
+	block.buildRuntimeCall("gogo_map_iter_init", m, iterPtr)
+	nextBB := block.appendBasicBlock("range.next")
+	bodyBB := block.appendBasicBlock("range.body")
+	endBB := block.appendBasicBlock("range.end")
+	block.buildBr(nextBB)
+
+	block.positionAtEnd(nextBB)
+	pair := block.buildRuntimeCall("gogo_map_iter_next", iterPtr)
+	more := block.Builder.BuildICmp(llvm.IntNE, pair, llvm.ConstPointerNull(bytePtrType()), "")
+	block.buildCondBr(more, bodyBB, endBB)
+
+	block.positionAtEnd(bodyBB)
+	pair = block.Builder.BuildBitCast(pair, llvm.PointerType(mapPairType(mapTy), 0), "")
+	int32Ty := llvm.IntType(32)
+	zero := llvm.ConstInt(int32Ty, 0, false)
+	keyPtr := block.Builder.BuildGEP(pair, []llvm.Value{zero, zero}, "")
+	key := &Register{mapTy.Key, buildLoadValue(block.Builder, mapTy.Key, keyPtr)}
+	var value TypedValue
+	if stmt.Value != nil {
+		valuePtr := block.Builder.BuildGEP(pair, []llvm.Value{zero, llvm.ConstInt(int32Ty, 1, false)}, "")
+		value = &Register{mapTy.Elem, buildLoadValue(block.Builder, mapTy.Elem, valuePtr)}
+	}
+	if diag := block.bindRangeVars(stmt, key, value); diag != nil {
+		return diag
+	}
+	loop := &Loop{Break: endBB, Continue: nextBB}
+	if diag := block.translateLoopBody(stmt.Body, loop, nextBB); diag != nil {
+		return diag
+	}
+	block.finishLoop(endBB, true)
+	return nil
+}
+
+// declares, or assigns to, the key and value of a range loop's iteration.
+func (block *Block) bindRangeVars(stmt *ast.RangeStmt, key TypedValue, value TypedValue) *GoDiag {
+	exprs := []ast.Expr{stmt.Key, stmt.Value}
+	vals := []TypedValue{key, value}
+	for i, expr := range exprs {
+		if expr == nil {
+			continue
+		}
+		if stmt.Tok == token.DEFINE {
+			ident, ok := expr.(*ast.Ident)
+			if !ok {
+				return DiagFromAST(expr, "Expected an identifier on the left side of :=.")
+			}
+			if diag := block.declareVariable(ident, vals[i]); diag != nil {
+				return diag
+			}
+			continue
+		}
+		if ident, ok := expr.(*ast.Ident); ok && ident.Name == "_" {
+			continue
+		}
+		lValue, diag := block.translateExprLHS(expr)
+		if diag != nil {
+			return diag
+		}
+		val, diag := block.assignTo(expr, vals[i], lValue.Type())
+		if diag != nil {
+			return diag
+		}
+		if diag := lValue.BuildAssign(block, val); diag != nil {
+			return diag
+		}
+	}
+	return nil
+}
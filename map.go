@@ -0,0 +1,327 @@
+package main
+
+import "go/ast"
+import "llvm"
+
+func isMapType(ty Type) bool {
+	_, ok := ty.Base().(*MapType)
+	return ok
+}
+
+// reports whether values of `ty` can be compared with ==, as map keys must be.
+func isComparable(ty Type) bool {
+	switch base := ty.Base().(type) {
+	case *SliceType, *MapType, *FuncType:
+		return false
+	case *ArrayType:
+		return isComparable(base.Elem)
+	case *StructType:
+		for _, field := range base.Fields {
+			if !isComparable(field.Ty) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checks that `ty` can be the key type of a map.
+func checkMapKey(expr ast.Expr, ty Type) *GoDiag {
+	// a type that's still being declared gets checked when it's used.
+	if named, ok := ty.(*NamedType); ok && named.Underlying == nil {
+		return nil
+	}
+	if !isComparable(ty) {
+		return DiagFromAST(expr, "Invalid map key type %s: it isn't comparable.", ty.String())
+	}
+	return nil
+}
+
+/*
+ * How the runtime hashes and compares each part of a key. These must match
+ * the SEG_* constants in rt/common/map.c.
+ */
+const (
+	keySegMem = iota
+	keySegString
+	keySegFloat32
+	keySegFloat64
+	keySegIface
+)
+
+// a part of a key, at `Offset` bytes into it.
+type keySeg struct {
+	Offset uint64
+	Size   uint64
+	Kind   int
+}
+
+/*
+ * keySegments describes the parts of a key of type `ty` that take part in
+ * equality, i.e. everything but padding and blank fields. Adjacent plain
+ * memory is merged into one part.
+ */
+func (trans *Translator) keySegments(ty Type, offset uint64, segs []keySeg) []keySeg {
+	target := trans.Target
+	switch base := ty.Base().(type) {
+	case *StringType:
+		return append(segs, keySeg{offset, target.AllocSize(base.LLVM()), keySegString})
+	case *FloatType:
+		kind := keySegFloat64
+		if base.BitWidth() == 32 {
+			kind = keySegFloat32
+		}
+		return append(segs, keySeg{offset, target.AllocSize(base.LLVM()), kind})
+	case *InterfaceType:
+		// hashed and compared according to the dynamic type of its value.
+		return append(segs, keySeg{offset, target.AllocSize(base.LLVM()), keySegIface})
+	case *ComplexType:
+		partTy := base.PartType()
+		segs = trans.keySegments(partTy, offset, segs)
+		return trans.keySegments(partTy, offset+target.AllocSize(partTy.LLVM()), segs)
+	case *ArrayType:
+		size := target.AllocSize(MemLLVM(base.Elem))
+		for i := int64(0); i < base.Len; i++ {
+			segs = trans.keySegments(base.Elem, offset+uint64(i)*size, segs)
+		}
+		return segs
+	case *StructType:
+		llTy := MemLLVM(ty)
+		for i, field := range base.Fields {
+			if field.Name != "_" {
+				segs = trans.keySegments(field.Ty, offset+target.FieldOffset(llTy, i), segs)
+			}
+		}
+		return segs
+	}
+	size := target.AllocSize(MemLLVM(ty))
+	if n := len(segs); n > 0 && segs[n-1].Kind == keySegMem && segs[n-1].Offset+segs[n-1].Size == offset {
+		segs[n-1].Size += size
+		return segs
+	}
+	return append(segs, keySeg{offset, size, keySegMem})
+}
+
+// the layout of the runtime's key_seg_t (see rt/common/iface.h).
+func keySegType() llvm.Type {
+	intTy := global_type_factory.IntType(BLTN_TY_INT).LLVM()
+	return llvm.StructType([]llvm.Type{intTy, intTy, intTy}, false)
+}
+
+// emits `segs` as a global called `name`, returning a pointer to the first one.
+func (trans *Translator) keySegmentsGlobal(name string, segs []keySeg) llvm.Value {
+	segTy := keySegType()
+	if len(segs) == 0 {
+		return llvm.ConstPointerNull(llvm.PointerType(segTy, 0))
+	}
+	intTy := global_type_factory.IntType(BLTN_TY_INT).LLVM()
+	entries := make([]llvm.Value, len(segs))
+	for i, seg := range segs {
+		fields := []uint64{seg.Offset, seg.Size, uint64(seg.Kind)}
+		words := make([]llvm.Value, len(fields))
+		for j, field := range fields {
+			words[j] = llvm.ConstInt(intTy, field, false)
+		}
+		entries[i] = llvm.ConstStruct(words, false)
+	}
+	arr := trans.LLns.createAndSetGlobal(name, llvm.ArrayType(segTy, uint(len(entries))), llvm.ConstArray(segTy, entries))
+	zero := llvm.ConstInt(llvm.IntType(32), 0, false)
+	return llvm.ConstGEP(arr, []llvm.Value{zero, zero})
+}
+
+// the layout of the {key, value} pairs the runtime stores.
+func mapPairType(m *MapType) llvm.Type {
+	return llvm.StructType([]llvm.Type{MemLLVM(m.Key), MemLLVM(m.Elem)}, false)
+}
+
+/*
+ * mapDescriptor returns (as an i8*) the runtime's description of map type
+ * `m`: the layout of its pairs, and how to hash and compare its keys.
+ */
+func (trans *Translator) mapDescriptor(m *MapType) llvm.Value {
+	// function literals' translators share the file's descriptors.
+	trans = trans.root()
+	for _, desc := range trans.MapTypes {
+		if desc.Ty.Eq(m) {
+			return trans.constBytePtr(desc.Global)
+		}
+	}
+	intTy := global_type_factory.IntType(BLTN_TY_INT).LLVM()
+	word := func(n uint64) llvm.Value {
+		return llvm.ConstInt(intTy, n, false)
+	}
+	segs := trans.keySegments(m.Key, 0, nil)
+	segsPtr := trans.keySegmentsGlobal("map."+m.String()+".segs", segs)
+
+	pairTy := mapPairType(m)
+	keySize := trans.Target.AllocSize(MemLLVM(m.Key))
+	valOffset := trans.Target.FieldOffset(pairTy, 1)
+	pairSize := trans.Target.AllocSize(pairTy)
+	init := llvm.ConstStruct([]llvm.Value{word(keySize), word(valOffset), word(pairSize), word(uint64(len(segs))), segsPtr}, false)
+	global := trans.LLns.createAndSetGlobal("map."+m.String(), init.Type(), init)
+	trans.MapTypes = append(trans.MapTypes, typeGlobal{m, global})
+	return trans.constBytePtr(global)
+}
+
+/*
+ * An element of a map, `m[k]`. Reading it looks `k` up, giving the zero value
+ * if it isn't there; assigning to it adds `k` if need be. Either way, that
+ * happens when the element is used, like loading or storing a Variable. Map
+ * elements aren't addressable, though.
+ */
+type MapElem struct {
+	Map     *MapType
+	M       llvm.Value
+	Key     llvm.Value // points to the key
+	Trans   *Translator
+	Builder llvm.Builder
+}
+
+func (elem *MapElem) Type() Type {
+	return elem.Map.Elem
+}
+
+func (elem *MapElem) String() string {
+	return "<" + elem.Map.Elem.String() + " map element>"
+}
+
+func (elem *MapElem) args() []llvm.Value {
+	key := elem.Builder.BuildBitCast(elem.Key, bytePtrType(), "")
+	return []llvm.Value{elem.Trans.mapDescriptor(elem.Map), elem.M, key}
+}
+
+func (elem *MapElem) valuePtr(slot llvm.Value) llvm.Value {
+	return elem.Builder.BuildBitCast(slot, llvm.PointerType(MemLLVM(elem.Map.Elem), 0), "")
+}
+
+func (elem *MapElem) LLVM() llvm.Value {
+	lookup := elem.Trans.runtimeFunction("gogo_map_lookup")
+	slot := elem.Builder.BuildCall(lookup.LLVM(), elem.args(), "")
+	return buildLoadValue(elem.Builder, elem.Map.Elem, elem.valuePtr(slot))
+}
+
+func (elem *MapElem) LValue() bool {
+	return true
+}
+
+func (elem *MapElem) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil || expected_type.Eq(elem.Map.Elem) {
+		return &Register{elem.Map.Elem, elem.LLVM()}, nil
+	}
+	return nil, TypeMismatchDiag(expected_type, elem.Map.Elem)
+}
+
+// panics if the map is nil.
+func (elem *MapElem) BuildAssign(block *Block, val TypedValue) *GoDiag {
+	assign := elem.Trans.runtimeFunction("gogo_map_assign")
+	slot := elem.Builder.BuildCall(assign.LLVM(), elem.args(), "")
+	buildStoreValue(elem.Builder, elem.Map.Elem, val.LLVM(), elem.valuePtr(slot))
+	return nil
+}
+
+// returns the value for the key, and whether it was there: `v, ok := m[k]`.
+func (elem *MapElem) buildLookupOk() (TypedValue, TypedValue) {
+	builder := elem.Builder
+	slot := builder.BuildCall(elem.Trans.runtimeFunction("gogo_map_find").LLVM(), elem.args(), "")
+	ok := builder.BuildICmp(llvm.IntNE, slot, llvm.ConstPointerNull(bytePtrType()), "")
+	zero := builder.BuildCall(elem.Trans.runtimeFunction("gogo_map_zero").LLVM(), []llvm.Value{elem.Trans.mapDescriptor(elem.Map)}, "")
+	slot = builder.BuildSelect(ok, slot, zero, "")
+	val := buildLoadValue(builder, elem.Map.Elem, elem.valuePtr(slot))
+	return &Register{elem.Map.Elem, val}, &Register{global_type_factory.BoolType(), ok}
+}
+
+// stores a key in a temporary, since the runtime takes keys by reference.
+func (block *Block) buildMapKey(m *MapType, key TypedValue) llvm.Value {
+	ptr := block.buildAlloca(MemLLVM(m.Key), "map.key")
+	buildStoreValue(block.Builder, m.Key, key.LLVM(), ptr)
+	return ptr
+}
+
+// translates `m[k]`, once `m` has been translated.
+func (block *Block) translateMapIndex(expr *ast.IndexExpr, x TypedValue, m *MapType) (UntypedValue, *GoDiag) {
+	key, diag := block.translateExprRHSTyped(expr.Index, m.Key)
+	if diag != nil {
+		return nil, diag
+	}
+	return &MapElem{m, x.LLVM(), block.buildMapKey(m, key), block.Trans, block.Builder}, nil
+}
+
+// translates `make(map[K]V)` and `make(map[K]V, hint)`.
+func (block *Block) translateMakeMap(call *ast.CallExpr, ty Type, m *MapType) (UntypedValue, *GoDiag) {
+	if len(call.Args) > 2 {
+		return nil, DiagFromAST(call, "make(%s) expects at most a size hint.", ty.String())
+	}
+	hint := llvm.ConstInt(global_type_factory.IntType(BLTN_TY_INT).LLVM(), 0, false)
+	if len(call.Args) == 2 {
+		size, diag := block.translateIndex(call.Args[1])
+		if diag != nil {
+			return nil, diag
+		}
+		hint = size.LLVM()
+	}
+	return &Register{ty, block.buildRuntimeCall("gogo_map_make", block.Trans.mapDescriptor(m), hint)}, nil
+}
+
+// returns a constant key as a string, for finding duplicate keys in literals.
+func constKey(val TypedValue) (string, bool) {
+	switch val.(type) {
+	case *TypedConstInt, *TypedConstFloat, *TypedConstComplex, *TypedConstString, *TypedConstBool:
+		return val.String(), true
+	}
+	return "", false
+}
+
+/*
+ * translateMapLit builds a map literal, e.g. `map[string]int{"a": 1}`. Every
+ * element needs a key, and constant keys mustn't repeat.
+ */
+func (block *Block) translateMapLit(lit *ast.CompositeLit, ty Type, m *MapType) (UntypedValue, *GoDiag) {
+	size := llvm.ConstInt(global_type_factory.IntType(BLTN_TY_INT).LLVM(), uint64(len(lit.Elts)), false)
+	mapVal := block.buildRuntimeCall("gogo_map_make", block.Trans.mapDescriptor(m), size)
+	seen := make(map[string]bool)
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, DiagFromAST(elt, "Missing key in map literal.")
+		}
+		key, diag := block.translateElement(kv.Key, m.Key)
+		if diag != nil {
+			return nil, diag
+		}
+		if str, ok := constKey(key); ok {
+			if seen[str] {
+				return nil, DiagFromAST(kv.Key, "Duplicate key %s in map literal.", str)
+			}
+			seen[str] = true
+		}
+		val, diag := block.translateElement(kv.Value, m.Elem)
+		if diag != nil {
+			return nil, diag
+		}
+		elem := &MapElem{m, mapVal, block.buildMapKey(m, key), block.Trans, block.Builder}
+		elem.BuildAssign(block, val)
+	}
+	return &Register{ty, mapVal}, nil
+}
+
+// translates `delete(m, k)`, which does nothing if `k` isn't in `m`.
+func (block *Block) translateDeleteBuiltin(call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	if diag := checkArgCount(call, "delete", 2); diag != nil {
+		return nil, diag
+	}
+	arg, diag := block.translateExprRHSTyped(call.Args[0], nil)
+	if diag != nil {
+		return nil, diag
+	}
+	m, ok := arg.Type().Base().(*MapType)
+	if !ok {
+		return nil, DiagFromAST(call.Args[0], "First argument to delete must be a map, but found type %s.", arg.Type().String())
+	}
+	key, diag := block.translateExprRHSTyped(call.Args[1], m.Key)
+	if diag != nil {
+		return nil, diag
+	}
+	keyPtr := block.buildBytePtr(block.buildMapKey(m, key))
+	block.buildRuntimeCall("gogo_map_delete", block.Trans.mapDescriptor(m), arg.LLVM(), keyPtr)
+	return nil, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import "go/ast"
+import "llvm"
+
+/*
+ * A method of a defined type. Its function takes the receiver (either a `T`
+ * or a `*T`) as its first parameter.
+ */
+type Method struct {
+	Name    string
+	PtrRecv bool
+	Fn      *FuncValue
+}
+
+// the method's signature, without its receiver.
+func (method *Method) Signature() *FuncType {
+	return &FuncType{method.Fn.Ty.Params[1:], method.Fn.Ty.Result}
+}
+
+// returns the method of `named` called `name`, or nil if there isn't one.
+func (named *NamedType) Method(name string) *Method {
+	for _, method := range named.Methods {
+		if method.Name == name {
+			return method
+		}
+	}
+	return nil
+}
+
+/*
+ * MethodSet returns the methods that can be called on any value of type `ty`.
+ * That's the value receiver methods for a `T`, and all of them for a `*T`.
+ * (An addressable `T` can call the rest too, since `x.m()` means `(&x).m()`.)
+ */
+func MethodSet(ty Type) []*Method {
+	if ptr, ok := ty.(*PointerType); ok {
+		if named, ok := ptr.At.(*NamedType); ok {
+			return named.Methods
+		}
+		return nil
+	}
+	named, ok := ty.(*NamedType)
+	if !ok {
+		return nil
+	}
+	methods := make([]*Method, 0)
+	for _, method := range named.Methods {
+		if !method.PtrRecv {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// strips `recv` down to the type it's a method of, and reports whether it's a pointer.
+func receiverTypeExpr(recv ast.Expr) (ast.Expr, bool) {
+	if paren, ok := recv.(*ast.ParenExpr); ok {
+		recv = paren.X
+	}
+	if star, ok := recv.(*ast.StarExpr); ok {
+		return star.X, true
+	}
+	return recv, false
+}
+
+/*
+ * receiverType resolves the receiver of a method declaration, which has to be
+ * `T` or `*T` for a defined type `T` from this package. It also reports
+ * whether the receiver is a pointer.
+ */
+func (trans *Translator) receiverType(recv *ast.FieldList) (*NamedType, bool, *GoDiag) {
+	if len(recv.List) != 1 || len(recv.List[0].Names) > 1 {
+		return nil, false, DiagFromAST(recv, "A method must have exactly one receiver.")
+	}
+	tyExpr, isPtr := receiverTypeExpr(recv.List[0].Type)
+	ident, ok := tyExpr.(*ast.Ident)
+	if !ok {
+		return nil, false, DiagFromAST(recv, "Invalid receiver type.")
+	}
+	ty, diag := trans.translateType(trans.Scope, ident)
+	if diag != nil {
+		return nil, false, diag
+	}
+	named, ok := ty.(*NamedType)
+	if !ok {
+		return nil, false, DiagFromAST(ident, "Cannot define methods on type %s, which isn't declared in this package.", ty.String())
+	}
+	switch named.Underlying.(type) {
+	case *PointerType:
+		return nil, false, DiagFromAST(ident, "Invalid receiver type %s: it is a pointer type.", named.String())
+	case *InterfaceType:
+		return nil, false, DiagFromAST(ident, "Invalid receiver type %s: it is an interface type.", named.String())
+	}
+	return named, isPtr, nil
+}
+
+// the symbol name of a method: `T.m` or `(*T).m`.
+func methodSymbol(named *NamedType, isPtr bool, name string) string {
+	if isPtr {
+		return "(*" + named.Name + ")." + name
+	}
+	return named.Name + "." + name
+}
+
+// declares the method `decl`, adding it to its receiver type.
+func (trans *Translator) declareMethod(decl *ast.FuncDecl) *GoDiag {
+	if generic := trans.genericReceiver(decl.Recv); generic != nil {
+		if len(decl.Recv.List[0].Names) > 1 {
+			return DiagFromAST(decl.Recv, "A method must have exactly one receiver.")
+		}
+		return trans.addGenericMethod(generic, decl)
+	}
+	named, isPtr, diag := trans.receiverType(decl.Recv)
+	if diag != nil {
+		return diag
+	}
+	_, diag = trans.addMethod(trans.Scope, named, isPtr, decl)
+	return diag
+}
+
+/*
+ * addMethod adds the method `decl` to `named`, with its signature resolved in
+ * `scope`. Returns the method's function, or nil if it's named `_`.
+ */
+func (trans *Translator) addMethod(scope *Scope, named *NamedType, isPtr bool, decl *ast.FuncDecl) (*FuncValue, *GoDiag) {
+	sig, diag := trans.translateFuncType(scope, decl.Type)
+	if diag != nil {
+		return nil, diag
+	}
+	name := decl.Name.Name
+	if name == "_" {
+		return nil, nil
+	}
+	if named.Method(name) != nil {
+		return nil, DiagFromAST(decl.Name, "Method %s.%s is already declared.", named.Name, name)
+	}
+	if st, ok := named.Underlying.(*StructType); ok && st.FieldIndex(name) >= 0 {
+		return nil, DiagFromAST(decl.Name, "Type %s has both a field and a method named %s.", named.Name, name)
+	}
+
+	var recvTy Type = named
+	if isPtr {
+		recvTy = &PointerType{named}
+	}
+	fnTy := &FuncType{append([]Type{recvTy}, sig.Params...), sig.Result}
+	symbol := methodSymbol(named, isPtr, name)
+	fn := &FuncValue{symbol, fnTy, trans.mod.AddFunction(symbol, fnTy.LLVMSignature())}
+	named.Methods = append(named.Methods, &Method{name, isPtr, fn})
+	return fn, nil
+}
+
+// returns the function declared by `decl`, which may be a method.
+func (trans *Translator) declaredFunc(decl *ast.FuncDecl) *FuncValue {
+	if decl.Recv == nil {
+		bound := trans.Scope.lookupVar(decl.Name.Name)
+		fn, ok := bound.Val.(*FuncValue)
+		assert(ok, "Function was not declared before translation!")
+		return fn
+	}
+	named, _, diag := trans.receiverType(decl.Recv)
+	assert(diag == nil, "Method was not declared before translation!")
+	method := named.Method(decl.Name.Name)
+	assert(method != nil, "Method was not declared before translation!")
+	return method.Fn
+}
+
+/*
+ * selectMethod looks for a method `name` of `x`, and binds `x` to it as the
+ * receiver. Pointers are dereferenced, and addressable values have their
+ * address taken, as needed to match the method's receiver. Returns nil if `x`
+ * has no such method.
+ */
+func (block *Block) selectMethod(expr *ast.SelectorExpr, x UntypedValue) (*BoundMethod, *GoDiag) {
+	if isUntyped(x) {
+		return nil, nil
+	}
+	typed := x.(TypedValue)
+	if iface, ok := typed.Type().Base().(*InterfaceType); ok {
+		return block.selectIfaceMethod(expr, typed, iface), nil
+	}
+	var named *NamedType
+	isPtr := false
+	switch recvTy := typed.Type().(type) {
+	case *NamedType:
+		named = recvTy
+	case *PointerType:
+		named, _ = recvTy.At.(*NamedType)
+		isPtr = true
+	}
+	if named == nil {
+		return nil, nil
+	}
+	method := named.Method(expr.Sel.Name)
+	if method == nil {
+		return nil, nil
+	}
+
+	var recv llvm.Value
+	switch {
+	case method.PtrRecv && isPtr:
+		recv = typed.LLVM()
+	case method.PtrRecv:
+		variable, ok := x.(*Variable)
+		if !ok {
+			return nil, DiagFromAST(expr, "Cannot call pointer method %s on a value of type %s that isn't addressable.", method.Name, typed.Type().String())
+		}
+		recv = variable.Ptr
+	case isPtr:
+		block.buildNilCheck(typed.LLVM())
+		recv = buildLoadValue(block.Builder, named, typed.LLVM())
+	default:
+		recv = typed.LLVM()
+	}
+	return &BoundMethod{method, recv}, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import "go/ast"
+
+/*
+ * declareTypes binds the types declared by `specs` in `scope`. Every defined
+ * type's name is bound before any of them are resolved, so that they may
+ * refer to each other (and to themselves) regardless of order. Aliases only
+ * see the types declared before them, or at the same time.
+ */
+func (trans *Translator) declareTypes(scope *Scope, specs []*ast.TypeSpec) *GoDiag {
+	named := make([]*NamedType, len(specs))
+	for i, spec := range specs {
+		if spec.TypeParams != nil {
+			if spec.Assign.IsValid() {
+				return DiagFromAST(spec.Name, "Generic type aliases are not supported.")
+			}
+			generic := &GenericType{spec, scope, nil, make(map[string]*NamedType)}
+			if !scope.addType(spec.Name.Name, generic) {
+				return DiagFromAST(spec.Name, "Type \"%s\" is already declared.", spec.Name.Name)
+			}
+			continue
+		}
+		if spec.Assign.IsValid() {
+			continue
+		}
+		named[i] = CreateNamedType(spec.Name.Name)
+		if !scope.addType(spec.Name.Name, named[i]) {
+			return DiagFromAST(spec.Name, "Type \"%s\" is already declared.", spec.Name.Name)
+		}
+	}
+
+	for _, spec := range specs {
+		if !spec.Assign.IsValid() {
+			continue
+		}
+		ty, diag := trans.translateType(scope, spec.Type)
+		if diag != nil {
+			return diag
+		}
+		if !scope.addType(spec.Name.Name, ty) {
+			return DiagFromAST(spec.Name, "Type \"%s\" is already declared.", spec.Name.Name)
+		}
+	}
+
+	for i, spec := range specs {
+		if named[i] == nil {
+			continue
+		}
+		ty, diag := trans.translateType(scope, spec.Type)
+		if diag != nil {
+			return diag
+		}
+		named[i].Underlying = ty
+		if containsByValue(ty, named[i]) {
+			return DiagFromAST(spec.Name, "Invalid recursive type \"%s\".", spec.Name.Name)
+		}
+	}
+
+	// `type A B` has B's underlying type, not B itself.
+	for _, ty := range named {
+		if ty == nil {
+			continue
+		}
+		for {
+			inner, ok := ty.Underlying.(*NamedType)
+			if !ok {
+				break
+			}
+			ty.Underlying = inner.Underlying
+		}
+	}
+	return nil
+}
+
+/*
+ * containsByValue reports whether a value of type `ty` would contain a value
+ * of type `named`, i.e. other than through a pointer, slice or the like. A
+ * type that contains itself would be infinitely large.
+ */
+func containsByValue(ty Type, named *NamedType) bool {
+	switch inner := ty.(type) {
+	case *NamedType:
+		if inner == named {
+			return true
+		}
+		// types that haven't been resolved yet get checked when they are.
+		return inner.Underlying != nil && containsByValue(inner.Underlying, named)
+	case *ArrayType:
+		return containsByValue(inner.Elem, named)
+	case *StructType:
+		for _, field := range inner.Fields {
+			if containsByValue(field.Ty, named) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns the type specs of a `type` declaration.
+func typeSpecs(gen *ast.GenDecl) []*ast.TypeSpec {
+	specs := make([]*ast.TypeSpec, len(gen.Specs))
+	for i, spec := range gen.Specs {
+		typeSpec, ok := spec.(*ast.TypeSpec)
+		assert(ok, "Expected *ast.TypeSpec, but got different type!")
+		specs[i] = typeSpec
+	}
+	return specs
+}
+
+// translates a `type` declaration inside a function.
+func (block *Block) translateTypeDecl(gen *ast.GenDecl) *GoDiag {
+	specs := typeSpecs(gen)
+	for _, spec := range specs {
+		if spec.TypeParams != nil {
+			return DiagFromAST(spec.Name, "Generic types must be declared at package level.")
+		}
+	}
+	return block.Trans.declareTypes(block.Scope, specs)
+}
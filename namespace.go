@@ -6,11 +6,27 @@ import "llvm"
 type LLVMNamespace struct {
 	TypeCounter map[string]uint
 	Zero        map[string]TypedValue
+	Strings     map[string]llvm.Value
 	Mod         llvm.Module
 }
 
 func CreateNamespace(mod llvm.Module) *LLVMNamespace {
-	return &LLVMNamespace{make(map[string]uint, 0), make(map[string]TypedValue, 0), mod}
+	return &LLVMNamespace{make(map[string]uint, 0), make(map[string]TypedValue, 0), make(map[string]llvm.Value, 0), mod}
+}
+
+/*
+ * internCString returns a pointer to the bytes of `str`, followed by a NUL so
+ * that C functions can use them too. Each distinct string is only emitted once.
+ */
+func (ns *LLVMNamespace) internCString(str string) llvm.Value {
+	global, ok := ns.Strings[str]
+	if !ok {
+		arrTy := llvm.ArrayType(llvm.IntType(8), uint(len(str))+1)
+		global = ns.requestStaticConstAlloc(GetStringType(), arrTy, llvm.ConstString(str, false))
+		ns.Strings[str] = global
+	}
+	indices := []llvm.Value{llvm.ConstInt(llvm.IntType(64), 0, false), llvm.ConstInt(llvm.IntType(64), 0, false)}
+	return llvm.ConstGEP(global, indices)
 }
 
 func (ns *LLVMNamespace) createAndSetGlobal(id string, ty llvm.Type, ll llvm.Value) llvm.Value {
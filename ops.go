@@ -0,0 +1,976 @@
+package main
+
+import "go/ast"
+import "go/token"
+import "llvm"
+import "math/big"
+import "strings"
+
+// translates `expr`, failing if it doesn't produce a value (e.g. a void call).
+func (block *Block) translateOperand(expr ast.Expr) (UntypedValue, *GoDiag) {
+	val, diag := block.translateExprRHS(expr)
+	if diag != nil {
+		return nil, diag
+	}
+	if val == nil {
+		return nil, DiagFromAST(expr, "Expression does not produce a value.")
+	}
+	return val, nil
+}
+
+/*
+ * unifyOperands gives both operands of a binary operator the same type. An
+ * untyped operand takes the type of the other one; if both are untyped, they
+ * both take their default types. Typed operands must have identical types.
+ */
+func (block *Block) unifyOperands(expr *ast.BinaryExpr, x UntypedValue, y UntypedValue) (TypedValue, TypedValue, *GoDiag) {
+	var xTyped, yTyped TypedValue
+	var udiag *UDiag
+	if isUntyped(x) && !isUntyped(y) {
+		yTyped, udiag = y.RValue(nil)
+		if udiag != nil {
+			return nil, nil, BindDiagToAST(expr.Y, *udiag)
+		}
+		xTyped, udiag = x.RValue(yTyped.Type())
+		if udiag != nil {
+			return nil, nil, BindDiagToAST(expr.X, *udiag)
+		}
+		return xTyped, yTyped, nil
+	}
+
+	xTyped, udiag = x.RValue(nil)
+	if udiag != nil {
+		return nil, nil, BindDiagToAST(expr.X, *udiag)
+	}
+	if isUntyped(y) {
+		yTyped, udiag = y.RValue(xTyped.Type())
+	} else {
+		yTyped, udiag = y.RValue(nil)
+	}
+	if udiag != nil {
+		return nil, nil, BindDiagToAST(expr.Y, *udiag)
+	}
+	if !xTyped.Type().Eq(yTyped.Type()) {
+		return nil, nil, DiagFromAST(expr, "Mismatched types %s and %s.", xTyped.Type().String(), yTyped.Type().String())
+	}
+	return xTyped, yTyped, nil
+}
+
+func (block *Block) translateBinaryExpr(expr *ast.BinaryExpr) (UntypedValue, *GoDiag) {
+	switch expr.Op {
+	case token.LAND, token.LOR:
+		return block.translateLogicalExpr(expr)
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return block.translateComparison(expr)
+	case token.ADD, token.SUB, token.MUL, token.QUO, token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+		return block.translateArith(expr)
+	case token.SHL, token.SHR:
+		return block.translateShift(expr)
+	default:
+		return nil, DiagFromAST(expr, "Operator %s is not implemented yet.", expr.Op)
+	}
+}
+
+func (block *Block) translateUnaryExpr(expr *ast.UnaryExpr) (UntypedValue, *GoDiag) {
+	switch expr.Op {
+	case token.NOT:
+		x, diag := block.translateOperand(expr.X)
+		if diag != nil {
+			return nil, diag
+		}
+		switch cnst := x.(type) {
+		case *ConstBool:
+			return &ConstBool{!cnst.Bool}, nil
+		case *TypedConstBool:
+			return &TypedConstBool{ConstBool{!cnst.Inner.Bool}, cnst.Ty}, nil
+		}
+		typed, diag := block.requireBool(expr.X, x)
+		if diag != nil {
+			return nil, diag
+		}
+		return &Register{typed.Type(), block.Builder.BuildNot(typed.LLVM(), "")}, nil
+	case token.ADD, token.SUB:
+		x, diag := block.translateOperand(expr.X)
+		if diag != nil {
+			return nil, diag
+		}
+		negate := expr.Op == token.SUB
+		if inner, ty, ok := constParts(x); ok && negate {
+			if negated := negateConst(inner); negated != nil {
+				if ty == nil {
+					return negated, nil
+				}
+				typed, udiag := negated.RValue(ty)
+				if udiag != nil {
+					return nil, BindDiagToAST(expr, *udiag)
+				}
+				return typed, nil
+			}
+		}
+		switch x.(type) {
+		case *ConstInt, *ConstFloat, *ConstComplex:
+			return x, nil
+		}
+		typed, udiag := x.RValue(nil)
+		if udiag != nil {
+			return nil, BindDiagToAST(expr.X, *udiag)
+		}
+		switch typed.Type().Base().(type) {
+		case *IntType:
+			if negate {
+				return &Register{typed.Type(), block.Builder.BuildNeg(typed.LLVM(), "")}, nil
+			}
+			return typed, nil
+		case *FloatType:
+			if negate {
+				return &Register{typed.Type(), block.Builder.BuildFNeg(typed.LLVM(), "")}, nil
+			}
+			return typed, nil
+		case *ComplexType:
+			if negate {
+				return block.buildComplexNeg(typed), nil
+			}
+			return typed, nil
+		}
+		return nil, DiagFromAST(expr, "Operator %s is not defined on type %s.", expr.Op, typed.Type().String())
+	case token.XOR:
+		return block.translateComplement(expr)
+	case token.AND:
+		return block.translateAddressOf(expr)
+	default:
+		return nil, DiagFromAST(expr, "Operator %s is not implemented yet.", expr.Op)
+	}
+}
+
+/*
+ * translateComplement translates the bitwise complement `^x`. For an unsigned
+ * constant, that's the complement within the type's width; otherwise, it's
+ * -x-1, as if x had infinitely many sign bits.
+ */
+func (block *Block) translateComplement(expr *ast.UnaryExpr) (UntypedValue, *GoDiag) {
+	x, diag := block.translateOperand(expr.X)
+	if diag != nil {
+		return nil, diag
+	}
+	if inner, ty, ok := constParts(x); ok {
+		cnst, isInt := inner.(*ConstInt)
+		if !isInt {
+			return nil, DiagFromAST(expr, "Operator ^ is not defined on constant %s.", x.String())
+		}
+		result := new(big.Int).Not(cnst.Int)
+		if ty == nil {
+			return &ConstInt{result, true, cnst.Rune}, nil
+		}
+		if intTy, ok := ty.Base().(*IntType); ok && !intTy.Signed() {
+			mask := new(big.Int).Lsh(big.NewInt(1), intTy.BitWidth())
+			result.Xor(cnst.Int, mask.Sub(mask, big.NewInt(1)))
+		}
+		complement := &ConstInt{result, true, cnst.Rune}
+		typed, udiag := complement.RValue(ty)
+		if udiag != nil {
+			return nil, BindDiagToAST(expr, *udiag)
+		}
+		return typed, nil
+	}
+	typed, udiag := x.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr.X, *udiag)
+	}
+	if _, ok := typed.Type().Base().(*IntType); !ok {
+		return nil, DiagFromAST(expr, "Operator ^ is not defined on type %s.", typed.Type().String())
+	}
+	return &Register{typed.Type(), block.Builder.BuildNot(typed.LLVM(), "")}, nil
+}
+
+// returns the negation of the untyped numeric constant `val`, or nil if it isn't one.
+func negateConst(val UntypedValue) UntypedValue {
+	switch cnst := val.(type) {
+	case *ConstInt:
+		return &ConstInt{new(big.Int).Neg(cnst.Int), true, cnst.Rune}
+	case *ConstFloat:
+		return &ConstFloat{new(big.Rat).Neg(cnst.Rat)}
+	case *ConstComplex:
+		return &ConstComplex{new(big.Rat).Neg(cnst.Re), new(big.Rat).Neg(cnst.Im)}
+	}
+	return nil
+}
+
+// converts `val` to a typed value, which must have a boolean type.
+func (block *Block) requireBool(expr ast.Expr, val UntypedValue) (TypedValue, *GoDiag) {
+	typed, udiag := val.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr, *udiag)
+	}
+	if _, ok := typed.Type().Base().(*BoolType); !ok {
+		return nil, DiagFromAST(expr, "Expected a boolean value, but found type %s.", typed.Type().String())
+	}
+	return typed, nil
+}
+
+/*
+ * Translates `&&` and `||`. The right operand is only evaluated if the left
+ * one doesn't already decide the result, so it gets its own basic block, and
+ * the two paths are joined with a phi.
+ */
+func (block *Block) translateLogicalExpr(expr *ast.BinaryExpr) (UntypedValue, *GoDiag) {
+	isAnd := expr.Op == token.LAND
+
+	x, diag := block.translateOperand(expr.X)
+	if diag != nil {
+		return nil, diag
+	}
+
+	// with a constant left operand, there's nothing to decide at runtime.
+	if xConst, ok := x.(*ConstBool); ok {
+		if xConst.Bool != isAnd {
+			// false && y, true || y: y is never evaluated, but still has to
+			// be a boolean.
+			yTy, diag := block.typeOfOperand(expr.Y)
+			if diag != nil {
+				return nil, diag
+			}
+			if _, ok := yTy.Base().(*BoolType); !ok {
+				return nil, DiagFromAST(expr.Y, "Expected a boolean value, but found type %s.", yTy.String())
+			}
+			return xConst, nil
+		}
+		y, diag := block.translateOperand(expr.Y)
+		if diag != nil {
+			return nil, diag
+		}
+		if yConst, ok := y.(*ConstBool); ok {
+			return yConst, nil
+		}
+		return block.requireBool(expr.Y, y)
+	}
+
+	xTyped, diag := block.requireBool(expr.X, x)
+	if diag != nil {
+		return nil, diag
+	}
+	lhsEnd := block.Block
+	rhsBB := block.appendBasicBlock("logic.rhs")
+	mergeBB := block.appendBasicBlock("logic.end")
+	if isAnd {
+		block.buildCondBr(xTyped.LLVM(), rhsBB, mergeBB)
+	} else {
+		block.buildCondBr(xTyped.LLVM(), mergeBB, rhsBB)
+	}
+
+	block.positionAtEnd(rhsBB)
+	y, diag := block.translateOperand(expr.Y)
+	if diag != nil {
+		return nil, diag
+	}
+	yTyped, udiag := y.RValue(xTyped.Type())
+	if udiag != nil {
+		return nil, BindDiagToAST(expr.Y, *udiag)
+	}
+	yVal := yTyped.LLVM()
+	rhsEnd := block.Block
+	block.buildBr(mergeBB)
+
+	block.positionAtEnd(mergeBB)
+	phi := block.Builder.BuildPhi(xTyped.Type().LLVM(), "")
+	var shortCircuit uint64 = 0
+	if !isAnd {
+		shortCircuit = 1
+	}
+	llvm.AddIncoming(phi, []llvm.Value{llvm.ConstInt(xTyped.Type().LLVM(), shortCircuit, false), yVal}, []llvm.BasicBlock{lhsEnd, rhsEnd})
+	return &Register{xTyped.Type(), phi}, nil
+}
+
+func (block *Block) translateComparison(expr *ast.BinaryExpr) (UntypedValue, *GoDiag) {
+	x, diag := block.translateOperand(expr.X)
+	if diag != nil {
+		return nil, diag
+	}
+	y, diag := block.translateOperand(expr.Y)
+	if diag != nil {
+		return nil, diag
+	}
+	// an untyped shift takes its default type when compared with a constant.
+	if isUntyped(x) && isUntyped(y) && !isUntypedExpr(x) && !isUntypedExpr(y) {
+		return compareConsts(expr, x, y)
+	}
+	if isConst(x) && isConst(y) {
+		xInner, yInner, _, diag := unifyConsts(expr, x, y)
+		if diag != nil {
+			return nil, diag
+		}
+		// like any comparison, this gives an untyped bool.
+		return compareConsts(expr, xInner, yInner)
+	}
+	if _, ok := y.(*NilValue); ok {
+		return block.buildNilComparison(expr, expr.X, x)
+	}
+	if _, ok := x.(*NilValue); ok {
+		return block.buildNilComparison(expr, expr.Y, y)
+	}
+
+	xTyped, yTyped, diag := block.unifyOperands(expr, x, y)
+	if diag != nil {
+		return nil, diag
+	}
+	return block.buildComparison(expr, xTyped, yTyped)
+}
+
+/*
+ * builds `x == nil` or `x != nil`. Slices can only be compared with nil, and
+ * a slice is nil when its pointer is.
+ */
+func (block *Block) buildNilComparison(expr *ast.BinaryExpr, xExpr ast.Expr, x UntypedValue) (UntypedValue, *GoDiag) {
+	typed, diag := block.assignTo(xExpr, x, nil)
+	if diag != nil {
+		return nil, diag
+	}
+	if expr.Op != token.EQL && expr.Op != token.NEQ {
+		return nil, DiagFromAST(expr, "Operator %s is not defined on nil.", expr.Op)
+	}
+	var ptr llvm.Value
+	switch typed.Type().Base().(type) {
+	case *SliceType:
+		ptr, _, _ = block.splitSlice(typed.LLVM())
+	case *PointerType, *MapType, *UnsafePointerType:
+		ptr = typed.LLVM()
+	case *FuncType:
+		// a closure is nil when it has no code.
+		ptr = block.Builder.BuildExtractValue(typed.LLVM(), 0, "")
+	case *InterfaceType:
+		// an interface is nil when it has no itable.
+		ptr, _ = block.splitInterface(typed.LLVM())
+	default:
+		return nil, DiagFromAST(expr, "Cannot compare a value of type %s with nil.", typed.Type().String())
+	}
+	null := llvm.ConstPointerNull(ptr.Type())
+	cmp := block.Builder.BuildICmp(intPredicate(expr.Op, false), ptr, null, "")
+	return &Register{global_type_factory.BoolType(), cmp}, nil
+}
+
+// builds the comparison `x op y`, where both operands already have the same type.
+func (block *Block) buildComparison(expr *ast.BinaryExpr, x TypedValue, y TypedValue) (TypedValue, *GoDiag) {
+	boolTy := global_type_factory.BoolType()
+	switch ty := x.Type().Base().(type) {
+	case *IntType:
+		pred := intPredicate(expr.Op, ty.Signed())
+		return &Register{boolTy, block.Builder.BuildICmp(pred, x.LLVM(), y.LLVM(), "")}, nil
+	case *FloatType:
+		pred := floatPredicate(expr.Op)
+		return &Register{boolTy, block.Builder.BuildFCmp(pred, x.LLVM(), y.LLVM(), "")}, nil
+	case *ComplexType:
+		if expr.Op != token.EQL && expr.Op != token.NEQ {
+			break
+		}
+		return &Register{boolTy, block.buildComplexEq(expr.Op, x, y)}, nil
+	case *StringType:
+		return &Register{boolTy, block.buildStringCompare(expr.Op, x, y)}, nil
+	case *StructType:
+		if expr.Op != token.EQL && expr.Op != token.NEQ {
+			break
+		}
+		return block.buildStructEq(expr, ty, x, y)
+	case *BoolType, *PointerType, *UnsafePointerType:
+		// pointers are equal when they point to the same variable.
+		if expr.Op != token.EQL && expr.Op != token.NEQ {
+			break
+		}
+		pred := intPredicate(expr.Op, false)
+		return &Register{boolTy, block.Builder.BuildICmp(pred, x.LLVM(), y.LLVM(), "")}, nil
+	}
+	return nil, DiagFromAST(expr, "Operator %s is not defined on type %s.", expr.Op, x.Type().String())
+}
+
+func intPredicate(op token.Token, signed bool) llvm.IntPredicate {
+	switch op {
+	case token.EQL:
+		return llvm.IntEQ
+	case token.NEQ:
+		return llvm.IntNE
+	case token.LSS:
+		if signed {
+			return llvm.IntSLT
+		}
+		return llvm.IntULT
+	case token.LEQ:
+		if signed {
+			return llvm.IntSLE
+		}
+		return llvm.IntULE
+	case token.GTR:
+		if signed {
+			return llvm.IntSGT
+		}
+		return llvm.IntUGT
+	case token.GEQ:
+		if signed {
+			return llvm.IntSGE
+		}
+		return llvm.IntUGE
+	}
+	panic("Bad internal state! (Not a comparison operator!)")
+}
+
+/*
+ * Ordered comparisons are false if either operand is NaN, which leaves `!=`
+ * as the one unordered comparison: NaN != NaN.
+ */
+func floatPredicate(op token.Token) llvm.FloatPredicate {
+	switch op {
+	case token.EQL:
+		return llvm.FloatOEQ
+	case token.NEQ:
+		return llvm.FloatUNE
+	case token.LSS:
+		return llvm.FloatOLT
+	case token.LEQ:
+		return llvm.FloatOLE
+	case token.GTR:
+		return llvm.FloatOGT
+	case token.GEQ:
+		return llvm.FloatOGE
+	}
+	panic("Bad internal state! (Not a comparison operator!)")
+}
+
+// compares two untyped constants, giving an untyped boolean constant.
+func compareConsts(expr *ast.BinaryExpr, x UntypedValue, y UntypedValue) (UntypedValue, *GoDiag) {
+	if isComplexConst(x) || isComplexConst(y) {
+		return compareComplexConsts(expr, x, y)
+	}
+	if xStr, ok := x.(*ConstString); ok {
+		yStr, ok := y.(*ConstString)
+		if !ok {
+			return nil, DiagFromAST(expr, "Mismatched constants %s and %s.", x.String(), y.String())
+		}
+		return &ConstBool{cmpResult(expr.Op, strings.Compare(xStr.Str, yStr.Str))}, nil
+	}
+	switch xConst := x.(type) {
+	case *ConstInt, *ConstFloat:
+		xRat, _ := constRat(xConst)
+		yRat, ok := constRat(y)
+		if !ok {
+			break
+		}
+		return &ConstBool{cmpResult(expr.Op, xRat.Cmp(yRat))}, nil
+	case *ConstBool:
+		yConst, ok := y.(*ConstBool)
+		if !ok {
+			break
+		}
+		switch expr.Op {
+		case token.EQL:
+			return &ConstBool{xConst.Bool == yConst.Bool}, nil
+		case token.NEQ:
+			return &ConstBool{xConst.Bool != yConst.Bool}, nil
+		}
+		return nil, DiagFromAST(expr, "Operator %s is not defined on untyped bool.", expr.Op)
+	}
+	return nil, DiagFromAST(expr, "Mismatched constants %s and %s.", x.String(), y.String())
+}
+
+// turns the result of a three-way comparison (-1, 0, 1) into the result of `op`.
+func cmpResult(op token.Token, cmp int) bool {
+	switch op {
+	case token.EQL:
+		return cmp == 0
+	case token.NEQ:
+		return cmp != 0
+	case token.LSS:
+		return cmp < 0
+	case token.LEQ:
+		return cmp <= 0
+	case token.GTR:
+		return cmp > 0
+	case token.GEQ:
+		return cmp >= 0
+	}
+	panic("Bad internal state! (Not a comparison operator!)")
+}
+
+// returns the exact value of a numeric untyped constant.
+func constRat(val UntypedValue) (*big.Rat, bool) {
+	switch cnst := val.(type) {
+	case *ConstInt:
+		return new(big.Rat).SetInt(cnst.Int), true
+	case *ConstFloat:
+		return cnst.Rat, true
+	}
+	return nil, false
+}
+
+// returns the value of a constant that is an integer, even if it's an untyped float.
+func constInteger(val UntypedValue) (*big.Int, bool) {
+	switch cnst := val.(type) {
+	case *ConstInt:
+		return cnst.Int, true
+	case *ConstFloat:
+		if cnst.Rat.IsInt() {
+			return cnst.Rat.Num(), true
+		}
+	}
+	return nil, false
+}
+
+func (block *Block) translateArith(expr *ast.BinaryExpr) (UntypedValue, *GoDiag) {
+	x, diag := block.translateOperand(expr.X)
+	if diag != nil {
+		return nil, diag
+	}
+	y, diag := block.translateOperand(expr.Y)
+	if diag != nil {
+		return nil, diag
+	}
+	return block.applyArith(expr, x, y)
+}
+
+// applies the arithmetic operator of `expr` to its operands, already translated as `x` and `y`.
+func (block *Block) applyArith(expr *ast.BinaryExpr, x UntypedValue, y UntypedValue) (UntypedValue, *GoDiag) {
+	if isUntyped(x) && isUntyped(y) && (isUntypedExpr(x) || isUntypedExpr(y)) {
+		return block.deferArith(expr, x, y), nil
+	}
+	if isUntyped(x) && isUntyped(y) {
+		return foldArith(expr, x, y)
+	}
+	if isConst(x) && isConst(y) {
+		xInner, yInner, ty, diag := unifyConsts(expr, x, y)
+		if diag != nil {
+			return nil, diag
+		}
+		folded, diag := foldArith(expr, xInner, yInner)
+		if diag != nil {
+			return nil, diag
+		}
+		typed, udiag := folded.RValue(ty)
+		if udiag != nil {
+			return nil, BindDiagToAST(expr, *udiag)
+		}
+		return typed, nil
+	}
+
+	xTyped, yTyped, diag := block.unifyOperands(expr, x, y)
+	if diag != nil {
+		return nil, diag
+	}
+	return block.buildArith(expr, xTyped, yTyped)
+}
+
+// builds the arithmetic `x op y`, where both operands already have the same type.
+func (block *Block) buildArith(expr *ast.BinaryExpr, x TypedValue, y TypedValue) (TypedValue, *GoDiag) {
+	ty := x.Type()
+	builder := block.Builder
+	switch base := ty.Base().(type) {
+	case *IntType:
+		switch expr.Op {
+		case token.ADD:
+			return &Register{ty, builder.BuildAdd(x.LLVM(), y.LLVM(), "")}, nil
+		case token.SUB:
+			return &Register{ty, builder.BuildSub(x.LLVM(), y.LLVM(), "")}, nil
+		case token.MUL:
+			return &Register{ty, builder.BuildMul(x.LLVM(), y.LLVM(), "")}, nil
+		case token.QUO, token.REM:
+			divisor, isConst := y.(*TypedConstInt)
+			if isConst && divisor.Inner.Int.Sign() == 0 {
+				return nil, DiagFromAST(expr.Y, "Division by zero.")
+			}
+			return &Register{ty, block.buildIntDivide(expr.Op, base, x.LLVM(), y.LLVM(), !isConst)}, nil
+		case token.AND:
+			return &Register{ty, builder.BuildAnd(x.LLVM(), y.LLVM(), "")}, nil
+		case token.OR:
+			return &Register{ty, builder.BuildOr(x.LLVM(), y.LLVM(), "")}, nil
+		case token.XOR:
+			return &Register{ty, builder.BuildXor(x.LLVM(), y.LLVM(), "")}, nil
+		case token.AND_NOT:
+			return &Register{ty, builder.BuildAnd(x.LLVM(), builder.BuildNot(y.LLVM(), ""), "")}, nil
+		}
+	case *FloatType:
+		switch expr.Op {
+		case token.ADD:
+			return &Register{ty, builder.BuildFAdd(x.LLVM(), y.LLVM(), "")}, nil
+		case token.SUB:
+			return &Register{ty, builder.BuildFSub(x.LLVM(), y.LLVM(), "")}, nil
+		case token.MUL:
+			return &Register{ty, builder.BuildFMul(x.LLVM(), y.LLVM(), "")}, nil
+		case token.QUO:
+			// IEEE semantics: dividing by zero gives an infinity or NaN.
+			return &Register{ty, builder.BuildFDiv(x.LLVM(), y.LLVM(), "")}, nil
+		}
+	case *ComplexType:
+		return block.buildComplexArith(expr, ty, x, y)
+	case *StringType:
+		if expr.Op == token.ADD {
+			return block.buildStringConcat(x, y), nil
+		}
+	}
+	return nil, DiagFromAST(expr, "Operator %s is not defined on type %s.", expr.Op, ty.String())
+}
+
+/*
+ * Integer division in Go panics on a zero divisor, and defines MinInt / -1 to
+ * wrap around to MinInt. Both are undefined behavior for LLVM's division, so
+ * they're handled before dividing.
+ */
+func (block *Block) buildIntDivide(op token.Token, ty *IntType, x llvm.Value, y llvm.Value, checkZero bool) llvm.Value {
+	builder := block.Builder
+	llTy := ty.LLVM()
+	zero := llvm.ConstInt(llTy, 0, false)
+	if checkZero {
+		isZero := builder.BuildICmp(llvm.IntEQ, y, zero, "")
+		block.buildRuntimeCheck(isZero, block.Trans.runtimeFunction("gogo_panic_divide"))
+	}
+
+	if !ty.Signed() {
+		if op == token.QUO {
+			return builder.BuildUDiv(x, y, "")
+		}
+		return builder.BuildURem(x, y, "")
+	}
+
+	// x / -1 is just -x (which wraps for MinInt), and x % -1 is always 0.
+	isMinusOne := builder.BuildICmp(llvm.IntEQ, y, llvm.ConstAllOnes(llTy), "")
+	safeY := builder.BuildSelect(isMinusOne, llvm.ConstInt(llTy, 1, false), y, "")
+	if op == token.QUO {
+		quo := builder.BuildSDiv(x, safeY, "")
+		return builder.BuildSelect(isMinusOne, builder.BuildNeg(x, ""), quo, "")
+	}
+	rem := builder.BuildSRem(x, safeY, "")
+	return builder.BuildSelect(isMinusOne, zero, rem, "")
+}
+
+/*
+ * foldArith evaluates arithmetic on two untyped constants exactly. The result
+ * is an integer constant only if both operands are, and complex if either is;
+ * otherwise it's a float.
+ */
+func foldArith(expr *ast.BinaryExpr, x UntypedValue, y UntypedValue) (UntypedValue, *GoDiag) {
+	if isComplexConst(x) || isComplexConst(y) {
+		return foldComplexArith(expr, x, y)
+	}
+	if xStr, ok := x.(*ConstString); ok {
+		yStr, ok := y.(*ConstString)
+		if !ok || expr.Op != token.ADD {
+			return nil, DiagFromAST(expr, "Operator %s is not defined on constants %s and %s.", expr.Op, x.String(), y.String())
+		}
+		return &ConstString{xStr.Str + yStr.Str, xStr.Ns}, nil
+	}
+	xInt, xIsInt := x.(*ConstInt)
+	yInt, yIsInt := y.(*ConstInt)
+	if xIsInt && yIsInt {
+		result := new(big.Int)
+		switch expr.Op {
+		case token.ADD:
+			result.Add(xInt.Int, yInt.Int)
+		case token.SUB:
+			result.Sub(xInt.Int, yInt.Int)
+		case token.MUL:
+			result.Mul(xInt.Int, yInt.Int)
+		case token.QUO, token.REM:
+			if yInt.Int.Sign() == 0 {
+				return nil, DiagFromAST(expr.Y, "Division by zero.")
+			}
+			// Quo and Rem truncate towards zero, as Go does.
+			if expr.Op == token.QUO {
+				result.Quo(xInt.Int, yInt.Int)
+			} else {
+				result.Rem(xInt.Int, yInt.Int)
+			}
+		// big.Int's bitwise operations treat negative numbers as infinitely
+		// sign-extended two's complement, which is what Go's constants do.
+		case token.AND:
+			result.And(xInt.Int, yInt.Int)
+		case token.OR:
+			result.Or(xInt.Int, yInt.Int)
+		case token.XOR:
+			result.Xor(xInt.Int, yInt.Int)
+		case token.AND_NOT:
+			result.AndNot(xInt.Int, yInt.Int)
+		}
+		// a rune constant makes the result one too: 'a' + 1 is 'b'.
+		return &ConstInt{result, true, xInt.Rune || yInt.Rune}, nil
+	}
+
+	xRat, xOk := constRat(x)
+	yRat, yOk := constRat(y)
+	if !xOk || !yOk {
+		return nil, DiagFromAST(expr, "Operator %s is not defined on constants %s and %s.", expr.Op, x.String(), y.String())
+	}
+	result := new(big.Rat)
+	switch expr.Op {
+	case token.ADD:
+		result.Add(xRat, yRat)
+	case token.SUB:
+		result.Sub(xRat, yRat)
+	case token.MUL:
+		result.Mul(xRat, yRat)
+	case token.QUO:
+		if yRat.Sign() == 0 {
+			return nil, DiagFromAST(expr.Y, "Division by zero.")
+		}
+		result.Quo(xRat, yRat)
+	default:
+		return nil, DiagFromAST(expr, "Operator %s is not defined on untyped float constants.", expr.Op)
+	}
+	return &ConstFloat{result}, nil
+}
+
+// constant shifts are limited, so that folding them can't exhaust memory.
+const maxConstShift = 1 << 10
+
+/*
+ * translateShift translates `x << y` and `x >> y`. The result has the type of
+ * x; the count may have any integer type, and can't be negative.
+ */
+func (block *Block) translateShift(expr *ast.BinaryExpr) (UntypedValue, *GoDiag) {
+	x, diag := block.translateOperand(expr.X)
+	if diag != nil {
+		return nil, diag
+	}
+	y, diag := block.translateOperand(expr.Y)
+	if diag != nil {
+		return nil, diag
+	}
+	return block.applyShift(expr, x, y)
+}
+
+// applies the shift `expr` to its operands, already translated as `x` and `y`.
+func (block *Block) applyShift(expr *ast.BinaryExpr, x UntypedValue, y UntypedValue) (UntypedValue, *GoDiag) {
+	if isConst(x) && isConst(y) {
+		return foldShift(expr, x, y)
+	}
+
+	var count TypedValue
+	var udiag *UDiag
+	if isConst(y) {
+		if _, diag := constShiftCount(expr, y); diag != nil {
+			return nil, diag
+		}
+	}
+	if isUntyped(y) {
+		count, udiag = y.RValue(global_type_factory.IntType(BLTN_TY_UINT))
+	} else {
+		count, udiag = y.RValue(nil)
+	}
+	if udiag != nil {
+		return nil, BindDiagToAST(expr.Y, *udiag)
+	}
+	countTy, ok := count.Type().Base().(*IntType)
+	if !ok {
+		return nil, DiagFromAST(expr.Y, "Shift count must be an integer, but found type %s.", count.Type().String())
+	}
+
+	build := func(xTyped TypedValue) (TypedValue, *UDiag) {
+		ty, ok := xTyped.Type().Base().(*IntType)
+		if !ok {
+			udiag := UDiag("Operator " + expr.Op.String() + " is not defined on type " + xTyped.Type().String() + ".")
+			return nil, &udiag
+		}
+		return &Register{xTyped.Type(), block.buildShift(expr.Op, ty, xTyped.LLVM(), countTy, count.LLVM())}, nil
+	}
+
+	// an untyped constant shifted by a variable amount takes the type it
+	// would have without the shift, which depends on where it's used.
+	if isUntyped(x) {
+		return &UntypedExpr{untypedDefaultType(x), func(ty Type) (TypedValue, *UDiag) {
+			xTyped, udiag := x.RValue(ty)
+			if udiag != nil {
+				return nil, udiag
+			}
+			return build(xTyped)
+		}}, nil
+	}
+	xTyped, udiag := x.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr.X, *udiag)
+	}
+	shifted, udiag := build(xTyped)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr, *udiag)
+	}
+	return shifted, nil
+}
+
+/*
+ * An untyped expression that isn't constant, like `1 << n`. As with an
+ * untyped constant, its type comes from where it's used: `var x int64 = 1 << n`
+ * shifts an int64. So its code is only built once that type is known, by
+ * RValue, falling back to `Default` when nothing decides the type.
+ */
+type UntypedExpr struct {
+	Default Type
+	Build   func(ty Type) (TypedValue, *UDiag)
+}
+
+func (val *UntypedExpr) String() string {
+	if val.Default == nil {
+		return "<untyped value>"
+	}
+	return "<untyped " + val.Default.String() + " value>"
+}
+
+func (val *UntypedExpr) LValue() bool {
+	return false
+}
+
+func (val *UntypedExpr) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil {
+		return val.Build(val.Default)
+	}
+	return val.Build(expected_type)
+}
+
+func isUntypedExpr(val UntypedValue) bool {
+	_, ok := val.(*UntypedExpr)
+	return ok
+}
+
+// the type the untyped value `val` takes when nothing else decides it, if it's known.
+func untypedDefaultType(val UntypedValue) Type {
+	factory := global_type_factory
+	switch cnst := val.(type) {
+	case *ConstInt:
+		if cnst.Rune {
+			return factory.IntType(BLTN_TY_INT32)
+		}
+		return factory.IntType(BLTN_TY_INT)
+	case *ConstFloat:
+		return factory.FloatType(BLTN_TY_FLOAT64)
+	case *ConstComplex:
+		return factory.ComplexType(BLTN_TY_COMPLEX128)
+	case *UntypedExpr:
+		return cnst.Default
+	}
+	return nil
+}
+
+/*
+ * deferArith applies the arithmetic `expr` to the untyped operands `x` and
+ * `y`, at least one of which isn't constant, once the type is known. Like
+ * constant arithmetic, the default type is the later of int, rune, float64
+ * and complex128 among the operands'.
+ */
+func (block *Block) deferArith(expr *ast.BinaryExpr, x UntypedValue, y UntypedValue) *UntypedExpr {
+	dflt := untypedDefaultType(x)
+	if yDefault := untypedDefaultType(y); dflt == nil || (yDefault != nil && untypedKindRank(yDefault) > untypedKindRank(dflt)) {
+		dflt = yDefault
+	}
+	return &UntypedExpr{dflt, func(ty Type) (TypedValue, *UDiag) {
+		xTyped, udiag := x.RValue(ty)
+		if udiag != nil {
+			return nil, udiag
+		}
+		yTyped, udiag := y.RValue(ty)
+		if udiag != nil {
+			return nil, udiag
+		}
+		result, diag := block.buildArith(expr, xTyped, yTyped)
+		if diag != nil {
+			udiag := UDiag(diag.Msg())
+			return nil, &udiag
+		}
+		return result, nil
+	}}
+}
+
+func untypedKindRank(ty Type) int {
+	switch ty.Base().(type) {
+	case *IntType:
+		if ty.Eq(global_type_factory.IntType(BLTN_TY_INT32)) {
+			return 1
+		}
+		return 0
+	case *FloatType:
+		return 2
+	}
+	return 3
+}
+
+/*
+ * buildShift shifts `x` by `count`. Go defines shifts by at least the width
+ * (to give 0, or only sign bits for a signed `>>`), which LLVM doesn't, and a
+ * negative count panics.
+ */
+func (block *Block) buildShift(op token.Token, ty *IntType, x llvm.Value, countTy *IntType, count llvm.Value) llvm.Value {
+	builder := block.Builder
+	if countTy.Signed() {
+		negative := builder.BuildICmp(llvm.IntSLT, count, llvm.ConstInt(countTy.LLVM(), 0, false), "")
+		block.buildRuntimeCheck(negative, block.Trans.runtimeFunction("gogo_panic_shift"))
+	}
+
+	// compare the count with the width in whichever of the two types is wider.
+	wide := countTy.LLVM()
+	if countTy.BitWidth() < ty.BitWidth() {
+		wide = ty.LLVM()
+		count = builder.BuildZExt(count, wide, "")
+	}
+	tooBig := builder.BuildICmp(llvm.IntUGE, count, llvm.ConstInt(wide, uint64(ty.BitWidth()), false), "")
+	clamped := builder.BuildSelect(tooBig, llvm.ConstInt(wide, uint64(ty.BitWidth()-1), false), count, "")
+	if countTy.BitWidth() > ty.BitWidth() {
+		clamped = builder.BuildTrunc(clamped, ty.LLVM(), "")
+	}
+
+	zero := llvm.ConstInt(ty.LLVM(), 0, false)
+	if op == token.SHL {
+		return builder.BuildSelect(tooBig, zero, builder.BuildShl(x, clamped, ""), "")
+	}
+	if ty.Signed() {
+		// shifting by width-1 already leaves nothing but sign bits.
+		return builder.BuildAShr(x, clamped, "")
+	}
+	return builder.BuildSelect(tooBig, zero, builder.BuildLShr(x, clamped, ""), "")
+}
+
+// returns the value of the constant shift count `y`, which must be a non-negative integer.
+func constShiftCount(expr *ast.BinaryExpr, y UntypedValue) (*big.Int, *GoDiag) {
+	inner, _, _ := constParts(y)
+	count, ok := constInteger(inner)
+	if !ok {
+		return nil, DiagFromAST(expr.Y, "Shift count %s must be an integer.", y.String())
+	}
+	if count.Sign() < 0 {
+		return nil, DiagFromAST(expr.Y, "Invalid negative shift count %s.", y.String())
+	}
+	return count, nil
+}
+
+/*
+ * foldShift shifts the constant `x` by the constant `y`. A typed `x` must be
+ * an integer, and the result keeps its type; an untyped one may be any
+ * constant with an integer value, and the result is an untyped integer.
+ */
+func foldShift(expr *ast.BinaryExpr, x UntypedValue, y UntypedValue) (UntypedValue, *GoDiag) {
+	count, diag := constShiftCount(expr, y)
+	if diag != nil {
+		return nil, diag
+	}
+	if count.Cmp(big.NewInt(maxConstShift)) > 0 {
+		return nil, DiagFromAST(expr.Y, "Shift count %s is too large.", y.String())
+	}
+	inner, ty, _ := constParts(x)
+	n, ok := constInteger(inner)
+	if ty != nil {
+		_, ok = ty.Base().(*IntType)
+	}
+	if !ok {
+		return nil, DiagFromAST(expr, "Operator %s is not defined on constant %s.", expr.Op, x.String())
+	}
+
+	result := new(big.Int)
+	if expr.Op == token.SHL {
+		result.Lsh(n, uint(count.Uint64()))
+	} else {
+		// like Go's >>, Rsh rounds towards negative infinity.
+		result.Rsh(n, uint(count.Uint64()))
+	}
+	isRune := false
+	if cnst, ok := inner.(*ConstInt); ok {
+		isRune = cnst.Rune
+	}
+	shifted := &ConstInt{result, true, isRune}
+	if ty == nil {
+		return shifted, nil
+	}
+	typed, udiag := shifted.RValue(ty)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr, *udiag)
+	}
+	return typed, nil
+}
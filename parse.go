@@ -1,6 +1,8 @@
 package main
 
 import "math/big"
+import "strconv"
+import "strings"
 
 func parseInt(lit string) *ConstInt {
 	Int := big.NewInt(0)
@@ -28,5 +30,53 @@ func parseInt(lit string) *ConstInt {
 		return nil
 	}
 
-	return &ConstInt{Int, true}
+	return &ConstInt{Int, true, false}
+}
+
+/*
+ * parseRune reads a rune literal, like 'a', '\n', '\x7f', '\u00e9' or '\377',
+ * as an integer constant that defaults to type rune.
+ */
+func parseRune(lit string) *ConstInt {
+	if len(lit) < 3 || lit[0] != '\'' || lit[len(lit)-1] != '\'' {
+		return nil
+	}
+	value, _, tail, err := strconv.UnquoteChar(lit[1:len(lit)-1], '\'')
+	if err != nil || tail != "" {
+		return nil
+	}
+	return &ConstInt{big.NewInt(int64(value)), true, true}
+}
+
+/*
+ * parseFloat reads a decimal or hexadecimal floating-point literal exactly,
+ * e.g. 1.5, .5e-3 or 0x1p-2.
+ */
+func parseFloat(lit string) *ConstFloat {
+	assert(len(lit) > 0, "Got an empty floating-point literal!")
+	Rat, ok := new(big.Rat).SetString(lit)
+	if !ok {
+		return nil
+	}
+	return &ConstFloat{Rat}
+}
+
+/*
+ * parseImag reads an imaginary literal like 2i, 1.5i or 0x1p-2i. As in Go, a
+ * decimal literal with leading zeros (0123i) is not octal.
+ */
+func parseImag(lit string) *ConstComplex {
+	assert(len(lit) > 1 && lit[len(lit)-1] == 'i', "Malformed imaginary literal!")
+	digits := lit[:len(lit)-1]
+	if strings.Trim(digits, "0123456789_") == "" {
+		digits = strings.TrimLeft(digits, "0")
+		if digits == "" {
+			digits = "0"
+		}
+	}
+	imag := parseFloat(strings.Replace(digits, "_", "", -1))
+	if imag == nil {
+		return nil
+	}
+	return &ConstComplex{new(big.Rat), imag.Rat}
 }
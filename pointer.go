@@ -0,0 +1,101 @@
+package main
+
+import "go/ast"
+
+// the pointer type of values of type `ty`, or nil if they aren't pointers.
+func pointerTypeOf(ty Type) *PointerType {
+	if named, ok := ty.(*NamedType); ok {
+		ty = named.Underlying
+	}
+	ptrTy, _ := ty.(*PointerType)
+	return ptrTy
+}
+
+/*
+ * translateAddressOf translates `&x`. `x` must be addressable: a variable, or
+ * a field or element of something addressable, or `*p`. As a special case,
+ * `&T{...}` puts a new T on the heap.
+ */
+func (block *Block) translateAddressOf(expr *ast.UnaryExpr) (UntypedValue, *GoDiag) {
+	target := expr.X
+	for {
+		paren, ok := target.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		target = paren.X
+	}
+	if lit, ok := target.(*ast.CompositeLit); ok {
+		val, diag := block.translateCompositeLit(lit, nil)
+		if diag != nil {
+			return nil, diag
+		}
+		typed, udiag := val.RValue(nil)
+		if udiag != nil {
+			return nil, BindDiagToAST(lit, *udiag)
+		}
+		variable := block.createHeapVariable(typed.Type())
+		buildStoreValue(block.Builder, typed.Type(), typed.LLVM(), variable.Ptr)
+		return &Register{&PointerType{typed.Type()}, variable.Ptr}, nil
+	}
+
+	x, diag := block.translateOperand(target)
+	if diag != nil {
+		return nil, diag
+	}
+	// everything addressable is a Variable: it has somewhere in memory to live.
+	variable, ok := x.(*Variable)
+	if !ok {
+		return nil, DiagFromAST(expr.X, "Cannot take the address of a value that isn't addressable.")
+	}
+	return &Register{&PointerType{variable.Ty}, variable.Ptr}, nil
+}
+
+// translates `*p`, which is addressable, since it's wherever `p` points.
+func (block *Block) translateDeref(expr *ast.StarExpr) (UntypedValue, *GoDiag) {
+	x, diag := block.translateOperand(expr.X)
+	if diag != nil {
+		return nil, diag
+	}
+	typed, udiag := x.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr.X, *udiag)
+	}
+	ptrTy := pointerTypeOf(typed.Type())
+	if ptrTy == nil {
+		return nil, DiagFromAST(expr, "Cannot dereference a value of type %s.", typed.Type().String())
+	}
+	block.buildNilCheck(typed.LLVM())
+	return &Variable{ptrTy.At, typed.LLVM(), block.Builder}, nil
+}
+
+/*
+ * derefArray returns `*x` if `x` is a pointer to an array, which can be
+ * indexed and sliced like the array itself. Otherwise, it returns `x`.
+ */
+func (block *Block) derefArray(x UntypedValue) UntypedValue {
+	if isUntyped(x) {
+		return x
+	}
+	ptrTy := pointerTypeOf(x.(TypedValue).Type())
+	if ptrTy == nil || !isArrayType(ptrTy.At) {
+		return x
+	}
+	typed, _ := x.RValue(nil)
+	block.buildNilCheck(typed.LLVM())
+	return &Variable{ptrTy.At, typed.LLVM(), block.Builder}
+}
+
+// translates `new(T)`, which returns a pointer to a new, zero T on the heap.
+func (block *Block) translateNewBuiltin(call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	if diag := checkArgCount(call, "new", 1); diag != nil {
+		return nil, diag
+	}
+	ty, diag := block.translateType(call.Args[0])
+	if diag != nil {
+		return nil, diag
+	}
+	// the runtime's memory is already zeroed.
+	variable := block.createHeapVariable(ty)
+	return &Register{&PointerType{ty}, variable.Ptr}, nil
+}
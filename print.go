@@ -1,6 +1,24 @@
 package main
 
+/*
+ * The print_* functions may be called directly by gogo programs, and also
+ * back the print and println builtins.
+ */
 func (trans *Translator) initPrint() {
-	trans.addExternFunction("print_int", nil, trans.Scope.lookupType("int64"))
-	trans.addExternFunction("print_uint", nil, trans.Scope.lookupType("uint64"))
+	trans.addPrintFunction("print_int", trans.Scope.lookupType("int64"))
+	trans.addPrintFunction("print_uint", trans.Scope.lookupType("uint64"))
+	trans.addPrintFunction("print_float", trans.Scope.lookupType("float64"))
+
+	// only for the builtins: they take their arguments in C-friendly pieces.
+	float64Ty := trans.Scope.lookupType("float64")
+	trans.declareRuntimeFunction("print_complex", nil, float64Ty, float64Ty)
+	trans.declareRuntimeFunction("print_string", nil, &PointerType{trans.Scope.lookupType("uint8")}, trans.Scope.lookupType("int"))
+	trans.declareRuntimeFunction("print_bool", nil, trans.Scope.lookupType("uint8"))
+	trans.declareRuntimeFunction("print_space", nil)
+	trans.declareRuntimeFunction("print_newline", nil)
+}
+
+func (trans *Translator) addPrintFunction(name string, param Type) {
+	fn, _ := trans.addExternFunction(name, nil, param).(*FuncValue)
+	trans.Runtime[name] = fn
 }
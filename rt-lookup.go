@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+import "os"
+import "path/filepath"
+
+const RT_DIR = "rt"
+
+/*
+ * FindRuntime locates the runtime object to link against for `target`.
+ *
+ * Runtimes built with `make -C rt TRIPLE=<triple>` live in rt/<triple>/rt.o.
+ * The plain `make -C rt` build in rt/c/rt.o is only used for the host, since
+ * it was compiled for whatever machine built it.
+ */
+func FindRuntime(target Target) (string, Diag) {
+	candidates := []string{filepath.Join(RT_DIR, target.Triple, "rt.o")}
+	host, diag := HostTriple()
+	if diag == nil && host == target.Triple {
+		candidates = append(candidates, filepath.Join(RT_DIR, "c", "rt.o"))
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	err := GenError(fmt.Sprintf("No runtime found for target \"%s\"; build one with `make -C %s TRIPLE=%s`.", target.Triple, RT_DIR, target.Triple))
+	return "", &err
+}
@@ -1,9 +1,30 @@
+#include <inttypes.h>
 #include <stdio.h>
+#include <stdlib.h>
 
-void print_int(long i) {
-  printf("%ld", i);
+#include "rt.h"
+
+// gogo passes int64/uint64 here on every target, so the widths must be exact;
+// `long` is only 32 bits on i686 and armv7.
+void print_int(int64_t i) {
+  printf("%" PRId64, i);
+}
+
+void print_uint(uint64_t u) {
+  printf("%" PRIu64, u);
+}
+
+void rt_write(const char *buf, size_t len) {
+  fwrite(buf, 1, len, stdout);
+}
+
+void *rt_alloc(size_t size) {
+  // calloc may return NULL for a zero-sized request.
+  return calloc(1, size > 0 ? size : 1);
 }
 
-void print_uint(unsigned long u) {
-  printf("%lu", u);
+void rt_panic(const char *msg) {
+  fflush(stdout);
+  fprintf(stderr, "panic: %s\n", msg);
+  exit(2);
 }
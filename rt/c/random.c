@@ -0,0 +1,12 @@
+#include <stdint.h>
+#include <time.h>
+
+#include "rt.h"
+
+uint64_t rt_random_seed(void) {
+  // the time, and wherever the stack happens to be.
+  uint64_t seed = (uint64_t)time(NULL);
+  seed ^= (uint64_t)clock() << 32;
+  seed ^= (uint64_t)(uintptr_t)&seed;
+  return seed;
+}
@@ -0,0 +1,9 @@
+#include "rt.h"
+
+void *gogo_alloc(intptr_t size) {
+  void *mem = rt_alloc((size_t)size);
+  if (mem == NULL) {
+    rt_panic("runtime error: out of memory");
+  }
+  return mem;
+}
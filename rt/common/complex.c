@@ -0,0 +1,58 @@
+#include "rt.h"
+
+// A port of the Go runtime's complex128div, which generated code calls for
+// every complex division. The quotient is returned through re and im.
+
+static int is_nan(double f) { return f != f; }
+
+static int is_inf(double f) { return !is_nan(f) && is_nan(f - f); }
+
+static int is_finite(double f) { return !is_nan(f - f); }
+
+static double inf(void) { return __builtin_inf(); }
+
+static double copy_sign(double x, double y) { return __builtin_copysign(x, y); }
+
+static double fabs_(double x) { return __builtin_fabs(x); }
+
+void gogo_complex128_div(double a, double b, double c, double d, double *re,
+                         double *im) {
+  double e, f; // e + fi = (a + bi) / (c + di)
+
+  // Algorithm for robust complex division as described in
+  // Robert L. Smith: Algorithm 116: Complex division. Commun. ACM 5(8): 435
+  // (1962).
+  if (fabs_(c) >= fabs_(d)) {
+    double ratio = d / c;
+    double denom = c + ratio * d;
+    e = (a + b * ratio) / denom;
+    f = (b - a * ratio) / denom;
+  } else {
+    double ratio = c / d;
+    double denom = d + ratio * c;
+    e = (a * ratio + b) / denom;
+    f = (b * ratio - a) / denom;
+  }
+
+  if (is_nan(e) && is_nan(f)) {
+    // Correct final result to infinities and zeros if applicable.
+    // Matches C99: ISO/IEC 9899:1999 - G.5.1  Multiplicative operators.
+    if (c == 0 && d == 0 && (!is_nan(a) || !is_nan(b))) {
+      e = copy_sign(inf(), c) * a;
+      f = copy_sign(inf(), c) * b;
+    } else if ((is_inf(a) || is_inf(b)) && is_finite(c) && is_finite(d)) {
+      a = copy_sign(is_inf(a) ? 1 : 0, a);
+      b = copy_sign(is_inf(b) ? 1 : 0, b);
+      e = inf() * (a * c + b * d);
+      f = inf() * (b * c - a * d);
+    } else if ((is_inf(c) || is_inf(d)) && is_finite(a) && is_finite(b)) {
+      c = copy_sign(is_inf(c) ? 1 : 0, c);
+      d = copy_sign(is_inf(d) ? 1 : 0, d);
+      e = 0 * (a * c + b * d);
+      f = 0 * (b * c - a * d);
+    }
+  }
+
+  *re = e;
+  *im = f;
+}
@@ -0,0 +1,76 @@
+#include "rt.h"
+
+// A port of the Go runtime's printfloat, so floats print the way Go's builtin
+// print prints them (e.g. +1.500000e+000), without needing libc.
+void print_float(double v) {
+  if (v != v) {
+    rt_write("NaN", 3);
+    return;
+  }
+  if (v + v == v && v > 0) {
+    rt_write("+Inf", 4);
+    return;
+  }
+  if (v + v == v && v < 0) {
+    rt_write("-Inf", 4);
+    return;
+  }
+
+  enum { N = 7 }; // digits printed
+  char buf[N + 7];
+  buf[0] = '+';
+  int e = 0; // exponent
+  if (v == 0) {
+    if (1 / v < 0) {
+      buf[0] = '-';
+    }
+  } else {
+    if (v < 0) {
+      v = -v;
+      buf[0] = '-';
+    }
+
+    // normalize
+    while (v >= 10) {
+      e++;
+      v /= 10;
+    }
+    while (v < 1) {
+      e--;
+      v *= 10;
+    }
+
+    // round
+    double h = 5.0;
+    for (int i = 0; i < N; i++) {
+      h /= 10;
+    }
+    v += h;
+    if (v >= 10) {
+      e++;
+      v /= 10;
+    }
+  }
+
+  // format +d.dddd+edd
+  for (int i = 0; i < N; i++) {
+    int s = (int)v;
+    buf[i + 2] = (char)(s + '0');
+    v -= s;
+    v *= 10;
+  }
+  buf[1] = buf[2];
+  buf[2] = '.';
+
+  buf[N + 2] = 'e';
+  buf[N + 3] = '+';
+  if (e < 0) {
+    e = -e;
+    buf[N + 3] = '-';
+  }
+
+  buf[N + 4] = (char)(e / 100 + '0');
+  buf[N + 5] = (char)((e / 10) % 10 + '0');
+  buf[N + 6] = (char)(e % 10 + '0');
+  rt_write(buf, sizeof(buf));
+}
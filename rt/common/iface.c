@@ -0,0 +1,85 @@
+#include "iface.h"
+
+// Runtime support for interfaces: building itables for conversions the
+// compiler can't see, like type assertions to other interfaces.
+
+static int key_compare(const char *a, const char *b) {
+  while (*a != '\0' && *a == *b) {
+    a++;
+    b++;
+  }
+  return (unsigned char)*a - (unsigned char)*b;
+}
+
+const char *gogo_missing_method(const gogo_type_t *type,
+                                const gogo_iface_t *iface) {
+  // both lists are sorted, so one pass over each will do.
+  intptr_t j = 0;
+  for (intptr_t i = 0; i < iface->n; i++) {
+    while (j < type->n && key_compare(type->methods[j].key, iface->keys[i]) < 0) {
+      j++;
+    }
+    if (j == type->n || key_compare(type->methods[j].key, iface->keys[i]) != 0) {
+      return iface->keys[i];
+    }
+  }
+  return NULL;
+}
+
+// itables built so far, so that each pair of types only has one.
+typedef struct itab_entry {
+  const gogo_type_t *type;
+  const gogo_iface_t *iface;
+  gogo_itab_t *itab;
+  struct itab_entry *next;
+} itab_entry_t;
+
+static itab_entry_t *itabs = NULL;
+
+// returns the itable for type in iface, or NULL if type doesn't implement it.
+void *gogo_itab(void *type_desc, void *iface_desc) {
+  const gogo_type_t *type = type_desc;
+  const gogo_iface_t *iface = iface_desc;
+  for (itab_entry_t *e = itabs; e != NULL; e = e->next) {
+    if (e->type == type && e->iface == iface) {
+      return (void *)e->itab;
+    }
+  }
+  if (gogo_missing_method(type, iface) != NULL) {
+    return NULL;
+  }
+
+  void **itab = gogo_alloc((iface->n + 1) * (intptr_t)sizeof(void *));
+  itab[0] = type_desc;
+  intptr_t j = 0;
+  for (intptr_t i = 0; i < iface->n; i++) {
+    while (key_compare(type->methods[j].key, iface->keys[i]) != 0) {
+      j++;
+    }
+    itab[i + 1] = type->methods[j].fn;
+  }
+  itab_entry_t *e = gogo_alloc(sizeof(itab_entry_t));
+  e->type = type;
+  e->iface = iface;
+  e->itab = itab;
+  e->next = itabs;
+  itabs = e;
+  return itab;
+}
+
+// returns the itable for the value of an interface with itable itab in
+// iface, or NULL if it's nil or doesn't implement iface.
+void *gogo_itab_convert(void *itab, void *iface_desc) {
+  if (itab == NULL) {
+    return NULL;
+  }
+  return gogo_itab(((void **)itab)[0], iface_desc);
+}
+
+// returns the dynamic type of the value of an interface, or NULL if it's nil.
+void *gogo_type_of(void *itab) {
+  if (itab == NULL) {
+    return NULL;
+  }
+  return ((void **)itab)[0];
+}
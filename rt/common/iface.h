@@ -0,0 +1,59 @@
+#ifndef GOGO_IFACE_H
+#define GOGO_IFACE_H
+
+#include "rt.h"
+
+// The descriptors generated code emits for interfaces. Their layouts must
+// match the ones in iface.go.
+
+// one method of a dynamic type. The key is its name and signature, e.g.
+// "Area() float64", and fn takes the receiver as a pointer to its value.
+typedef struct {
+  const char *key;
+  void *fn;
+} gogo_method_t;
+
+// a part of a value that takes part in equality, at offset bytes into it.
+// The kinds are listed in map.c.
+typedef struct {
+  intptr_t offset;
+  intptr_t size;
+  intptr_t kind;
+} gogo_key_seg_t;
+
+// a type that values in interfaces may have. Its methods are sorted by key.
+typedef struct {
+  const char *name;
+  intptr_t n;
+  const gogo_method_t *methods;
+  // how values are hashed and compared; nsegs is -1 if they can't be.
+  intptr_t nsegs;
+  const gogo_key_seg_t *segs;
+  // whether values are held in an interface's data word itself, rather than
+  // pointed to by it.
+  intptr_t direct;
+} gogo_type_t;
+
+// an interface type. Its method keys are sorted.
+typedef struct {
+  const char *name;
+  intptr_t n;
+  const char *const *keys;
+} gogo_iface_t;
+
+/*
+ * An itable is an array of pointers: the dynamic type, followed by its
+ * implementation of each of the interface's methods, in order. A nil
+ * interface has a NULL itable.
+ */
+typedef void *const gogo_itab_t;
+
+// returns the key of a method of iface that type lacks, or NULL if it has
+// them all.
+const char *gogo_missing_method(const gogo_type_t *type,
+                                const gogo_iface_t *iface);
+
+// for hashing an interface holding a value of a type that isn't comparable.
+__attribute__((noreturn)) void gogo_panic_unhashable(const gogo_type_t *type);
+
+#endif
@@ -0,0 +1,449 @@
+#include "iface.h"
+
+/*
+ * The hash table behind gogo's maps. Keys and values are stored together in
+ * each entry as a {key, value} pair, laid out the way generated code expects;
+ * the compiler describes each map type with a map_type_t.
+ *
+ * Buckets are chained, so entries never move once they're inserted. Every
+ * entry is also on a list in insertion order, which is what iteration walks:
+ * that way, growing the table in the middle of a range loop doesn't disturb it.
+ */
+
+// how each part of a key is hashed and compared. Must match map.go.
+enum {
+  SEG_MEM = 0,     // plain bytes (integers, bools, pointers)
+  SEG_STRING = 1,  // a string header, compared by contents
+  SEG_FLOAT32 = 2, // compared as floats, so -0 == +0 and NaN != NaN
+  SEG_FLOAT64 = 3,
+  SEG_IFACE = 4, // by the dynamic type of its value; see gogo_type_t
+};
+
+typedef gogo_key_seg_t key_seg_t;
+
+// emitted by the compiler for each map type.
+typedef struct {
+  intptr_t key_size;
+  intptr_t val_offset; // of the value within a pair
+  intptr_t pair_size;
+  intptr_t nsegs;
+  const key_seg_t *segs; // the parts of the key that take part in equality
+} map_type_t;
+
+typedef struct entry {
+  struct entry *bucket_next;
+  struct entry *prev; // the insertion order list
+  struct entry *next;
+  uintptr_t hash;
+  uintptr_t seq; // increases along the insertion order list
+  uintptr_t deleted;
+  _Alignas(8) uint8_t pair[];
+} entry_t;
+
+typedef struct {
+  const map_type_t *type;
+  intptr_t len;
+  uintptr_t nbuckets; // always a power of two
+  entry_t **buckets;
+  entry_t *head;
+  entry_t *tail;
+  uintptr_t seq;
+  uint64_t seed;
+} map_t;
+
+typedef struct {
+  const uint8_t *ptr;
+  intptr_t len;
+} string_t;
+
+typedef struct {
+  gogo_itab_t *itab; // NULL for a nil interface
+  void *data;
+} iface_t;
+
+// splitmix64, seeded once by the port.
+static uint64_t random_state;
+static int random_ready = 0;
+
+static uint64_t next_random(void) {
+  if (!random_ready) {
+    random_state = rt_random_seed();
+    random_ready = 1;
+  }
+  uint64_t z = (random_state += 0x9e3779b97f4a7c15ULL);
+  z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9ULL;
+  z = (z ^ (z >> 27)) * 0x94d049bb133111ebULL;
+  return z ^ (z >> 31);
+}
+
+// FNV-1a.
+static uint64_t hash_bytes(uint64_t h, const uint8_t *p, intptr_t n) {
+  for (intptr_t i = 0; i < n; i++) {
+    h ^= p[i];
+    h *= 1099511628211ULL;
+  }
+  return h;
+}
+
+static uint64_t hash_iface(uint64_t h, const iface_t *v);
+
+static uint64_t hash_segs(uint64_t h, const key_seg_t *segs, intptr_t nsegs,
+                          const uint8_t *key) {
+  for (intptr_t i = 0; i < nsegs; i++) {
+    const key_seg_t *seg = &segs[i];
+    const uint8_t *p = key + seg->offset;
+    switch (seg->kind) {
+    case SEG_MEM:
+      h = hash_bytes(h, p, seg->size);
+      break;
+    case SEG_STRING: {
+      string_t s;
+      __builtin_memcpy(&s, p, sizeof(s));
+      h = hash_bytes(h, s.ptr, s.len);
+      h = hash_bytes(h, (const uint8_t *)&s.len, sizeof(s.len));
+      break;
+    }
+    case SEG_FLOAT32: {
+      float f;
+      __builtin_memcpy(&f, p, sizeof(f));
+      if (f != f) {
+        // NaN is never equal to anything, so it may as well go anywhere.
+        h ^= next_random();
+        break;
+      }
+      f = f == 0 ? 0 : f; // -0 == +0
+      h = hash_bytes(h, (const uint8_t *)&f, sizeof(f));
+      break;
+    }
+    case SEG_FLOAT64: {
+      double d;
+      __builtin_memcpy(&d, p, sizeof(d));
+      if (d != d) {
+        h ^= next_random();
+        break;
+      }
+      d = d == 0 ? 0 : d;
+      h = hash_bytes(h, (const uint8_t *)&d, sizeof(d));
+      break;
+    }
+    case SEG_IFACE: {
+      iface_t v;
+      __builtin_memcpy(&v, p, sizeof(v));
+      h = hash_iface(h, &v);
+      break;
+    }
+    }
+  }
+  return h;
+}
+
+// the dynamic type of a non-nil interface value.
+static const gogo_type_t *iface_type(const iface_t *v) {
+  return v->itab[0];
+}
+
+// where the value of a non-nil interface is.
+static const uint8_t *iface_value(const iface_t *v) {
+  if (iface_type(v)->direct) {
+    return (const uint8_t *)&v->data;
+  }
+  return v->data;
+}
+
+// panics if the value's type isn't comparable, as Go does.
+static uint64_t hash_iface(uint64_t h, const iface_t *v) {
+  if (v->itab == NULL) {
+    return h;
+  }
+  const gogo_type_t *type = iface_type(v);
+  if (type->nsegs < 0) {
+    gogo_panic_unhashable(type);
+  }
+  h = hash_bytes(h, (const uint8_t *)&type, sizeof(type));
+  return hash_segs(h, type->segs, type->nsegs, iface_value(v));
+}
+
+static uintptr_t hash_key(const map_t *m, const uint8_t *key) {
+  uint64_t h = 14695981039346656037ULL ^ m->seed;
+  h = hash_segs(h, m->type->segs, m->type->nsegs, key);
+  return (uintptr_t)(h ^ (h >> 32));
+}
+
+static int ifaces_equal(const iface_t *v, const iface_t *w);
+
+static int segs_equal(const key_seg_t *segs, intptr_t nsegs,
+                      const uint8_t *a, const uint8_t *b) {
+  for (intptr_t i = 0; i < nsegs; i++) {
+    const key_seg_t *seg = &segs[i];
+    const uint8_t *x = a + seg->offset;
+    const uint8_t *y = b + seg->offset;
+    switch (seg->kind) {
+    case SEG_MEM:
+      if (__builtin_memcmp(x, y, (size_t)seg->size) != 0) {
+        return 0;
+      }
+      break;
+    case SEG_STRING: {
+      string_t s, t;
+      __builtin_memcpy(&s, x, sizeof(s));
+      __builtin_memcpy(&t, y, sizeof(t));
+      if (s.len != t.len || __builtin_memcmp(s.ptr, t.ptr, (size_t)s.len) != 0) {
+        return 0;
+      }
+      break;
+    }
+    case SEG_FLOAT32: {
+      float f, g;
+      __builtin_memcpy(&f, x, sizeof(f));
+      __builtin_memcpy(&g, y, sizeof(g));
+      if (f != g) {
+        return 0;
+      }
+      break;
+    }
+    case SEG_FLOAT64: {
+      double d, e;
+      __builtin_memcpy(&d, x, sizeof(d));
+      __builtin_memcpy(&e, y, sizeof(e));
+      if (d != e) {
+        return 0;
+      }
+      break;
+    }
+    case SEG_IFACE: {
+      iface_t v, w;
+      __builtin_memcpy(&v, x, sizeof(v));
+      __builtin_memcpy(&w, y, sizeof(w));
+      if (!ifaces_equal(&v, &w)) {
+        return 0;
+      }
+      break;
+    }
+    }
+  }
+  return 1;
+}
+
+/*
+ * Keys are always hashed before they're compared, so by the time two values
+ * of the same dynamic type get here, hash_iface has checked it's comparable.
+ */
+static int ifaces_equal(const iface_t *v, const iface_t *w) {
+  if (v->itab == NULL || w->itab == NULL) {
+    return v->itab == w->itab;
+  }
+  const gogo_type_t *type = iface_type(v);
+  if (type != iface_type(w)) {
+    return 0;
+  }
+  return segs_equal(type->segs, type->nsegs, iface_value(v), iface_value(w));
+}
+
+static int keys_equal(const map_type_t *type, const uint8_t *a,
+                      const uint8_t *b) {
+  return segs_equal(type->segs, type->nsegs, a, b);
+}
+
+static entry_t *find(const map_t *m, const uint8_t *key, uintptr_t hash) {
+  entry_t *e = m->buckets[hash & (m->nbuckets - 1)];
+  for (; e != NULL; e = e->bucket_next) {
+    if (e->hash == hash && keys_equal(m->type, e->pair, key)) {
+      return e;
+    }
+  }
+  return NULL;
+}
+
+// what lookups of missing keys return. Nothing ever writes to it.
+static uint8_t zero_small[256];
+static uint8_t *zero_big = NULL;
+static intptr_t zero_big_size = 0;
+
+void *gogo_map_zero(void *type_desc) {
+  const map_type_t *type = type_desc;
+  intptr_t size = type->pair_size - type->val_offset;
+  if (size <= (intptr_t)sizeof(zero_small)) {
+    return zero_small;
+  }
+  if (size > zero_big_size) {
+    zero_big = gogo_alloc(size);
+    zero_big_size = size;
+  }
+  return zero_big;
+}
+
+static entry_t **alloc_buckets(uintptr_t n) {
+  return gogo_alloc((intptr_t)(n * sizeof(entry_t *)));
+}
+
+void *gogo_map_make(void *type_desc, intptr_t hint) {
+  if (hint < 0) {
+    rt_panic("runtime error: makemap: size out of range");
+  }
+  map_t *m = gogo_alloc(sizeof(map_t));
+  m->type = type_desc;
+  m->nbuckets = 8;
+  while (m->nbuckets < (uintptr_t)hint) {
+    m->nbuckets *= 2;
+  }
+  m->buckets = alloc_buckets(m->nbuckets);
+  m->seed = next_random();
+  return m;
+}
+
+intptr_t gogo_map_len(void *map) {
+  return map == NULL ? 0 : ((map_t *)map)->len;
+}
+
+// returns a pointer to the value for key, or NULL if there isn't one.
+void *gogo_map_find(void *type_desc, void *map, void *key) {
+  const map_type_t *type = type_desc;
+  map_t *m = map;
+  if (m == NULL || m->len == 0) {
+    return NULL;
+  }
+  entry_t *e = find(m, key, hash_key(m, key));
+  return e == NULL ? NULL : e->pair + type->val_offset;
+}
+
+// like gogo_map_find, but returns the zero value for a missing key.
+void *gogo_map_lookup(void *type_desc, void *map, void *key) {
+  void *val = gogo_map_find(type_desc, map, key);
+  return val == NULL ? gogo_map_zero(type_desc) : val;
+}
+
+static void grow(map_t *m) {
+  m->nbuckets *= 2;
+  m->buckets = alloc_buckets(m->nbuckets);
+  for (entry_t *e = m->head; e != NULL; e = e->next) {
+    entry_t **bucket = &m->buckets[e->hash & (m->nbuckets - 1)];
+    e->bucket_next = *bucket;
+    *bucket = e;
+  }
+}
+
+// returns a pointer to the value for key, adding a zero one if there isn't one.
+void *gogo_map_assign(void *type_desc, void *map, void *key) {
+  const map_type_t *type = type_desc;
+  map_t *m = map;
+  if (m == NULL) {
+    rt_panic("assignment to entry in nil map");
+  }
+  uintptr_t hash = hash_key(m, key);
+  entry_t *e = find(m, key, hash);
+  if (e != NULL) {
+    return e->pair + type->val_offset;
+  }
+
+  if ((uintptr_t)m->len >= m->nbuckets) {
+    grow(m);
+  }
+  e = gogo_alloc((intptr_t)sizeof(entry_t) + type->pair_size);
+  __builtin_memcpy(e->pair, key, (size_t)type->key_size);
+  e->hash = hash;
+  e->seq = m->seq++;
+  entry_t **bucket = &m->buckets[hash & (m->nbuckets - 1)];
+  e->bucket_next = *bucket;
+  *bucket = e;
+  e->prev = m->tail;
+  if (m->tail != NULL) {
+    m->tail->next = e;
+  } else {
+    m->head = e;
+  }
+  m->tail = e;
+  m->len++;
+  return e->pair + type->val_offset;
+}
+
+void gogo_map_delete(void *type_desc, void *map, void *key) {
+  (void)type_desc;
+  map_t *m = map;
+  if (m == NULL || m->len == 0) {
+    return;
+  }
+  uintptr_t hash = hash_key(m, key);
+  entry_t **link = &m->buckets[hash & (m->nbuckets - 1)];
+  for (; *link != NULL; link = &(*link)->bucket_next) {
+    entry_t *e = *link;
+    if (e->hash != hash || !keys_equal(m->type, e->pair, key)) {
+      continue;
+    }
+    *link = e->bucket_next;
+    if (e->prev != NULL) {
+      e->prev->next = e->next;
+    } else {
+      m->head = e->next;
+    }
+    if (e->next != NULL) {
+      e->next->prev = e->prev;
+    } else {
+      m->tail = e->prev;
+    }
+    // an iterator may still be on e; its next pointer leads it back onto the
+    // list, and the flag stops it producing e.
+    e->deleted = 1;
+    m->len--;
+    return;
+  }
+}
+
+/*
+ * Iteration starts at a random entry and goes to the end of the insertion
+ * order list, then wraps around to the head and stops on reaching the entries
+ * it started with (which have the higher sequence numbers). Entries deleted
+ * before they're reached aren't produced; entries added during iteration may
+ * or may not be, as the language allows.
+ */
+typedef struct {
+  map_t *m;
+  entry_t *cur; // the next entry to look at
+  uintptr_t start_seq;
+  uintptr_t wrapped;
+} map_iter_t;
+
+// generated code allocates iterators itself; see mapIterWords in map.go.
+_Static_assert(sizeof(map_iter_t) == 4 * sizeof(void *),
+               "map_iter_t must be 4 words");
+
+void gogo_map_iter_init(void *map, void *iter) {
+  map_t *m = map;
+  map_iter_t *it = iter;
+  it->m = m;
+  it->cur = NULL;
+  it->wrapped = 1;
+  if (m == NULL || m->len == 0) {
+    return;
+  }
+  uint64_t skip = next_random() % (uint64_t)m->len;
+  entry_t *start = m->head;
+  for (uint64_t i = 0; i < skip; i++) {
+    start = start->next;
+  }
+  it->cur = start;
+  it->start_seq = start->seq;
+  it->wrapped = 0;
+}
+
+// returns the next {key, value} pair, or NULL once they've all been produced.
+void *gogo_map_iter_next(void *iter) {
+  map_iter_t *it = iter;
+  for (;;) {
+    entry_t *e = it->cur;
+    if (e == NULL) {
+      if (it->wrapped) {
+        return NULL;
+      }
+      it->wrapped = 1;
+      it->cur = it->m->head;
+      continue;
+    }
+    if (it->wrapped && e->seq >= it->start_seq) {
+      return NULL;
+    }
+    it->cur = e->next;
+    if (!e->deleted) {
+      return e->pair;
+    }
+  }
+}
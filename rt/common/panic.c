@@ -0,0 +1,195 @@
+#include "iface.h"
+
+// Entry points for the runtime checks gogo inserts into generated code.
+
+void gogo_panic_divide(void) {
+  rt_panic("runtime error: integer divide by zero");
+}
+
+void gogo_panic_shift(void) {
+  rt_panic("runtime error: negative shift amount");
+}
+
+// A tiny string builder for panic messages, which need numbers in them.
+typedef struct {
+  char buf[256];
+  size_t len;
+} msg_t;
+
+static void msg_str(msg_t *m, const char *s) {
+  while (*s != '\0' && m->len < sizeof(m->buf) - 1) {
+    m->buf[m->len++] = *s++;
+  }
+  m->buf[m->len] = '\0';
+}
+
+static void msg_int(msg_t *m, intptr_t v) {
+  char digits[24];
+  size_t pos = sizeof(digits) - 1;
+  // negate in unsigned arithmetic so INTPTR_MIN doesn't overflow.
+  uintptr_t u = v < 0 ? -(uintptr_t)v : (uintptr_t)v;
+  digits[pos] = '\0';
+  do {
+    digits[--pos] = '0' + (u % 10);
+    u /= 10;
+  } while (u != 0);
+  if (v < 0) {
+    digits[--pos] = '-';
+  }
+  msg_str(m, digits + pos);
+}
+
+void gogo_panic_index(intptr_t index, intptr_t len) {
+  msg_t m = {{0}, 0};
+  msg_str(&m, "runtime error: index out of range [");
+  msg_int(&m, index);
+  if (index >= 0) {
+    msg_str(&m, "] with length ");
+    msg_int(&m, len);
+  } else {
+    msg_str(&m, "]");
+  }
+  rt_panic(m.buf);
+}
+
+static void panic_slice(intptr_t low, intptr_t high, intptr_t max,
+                        const char *what) {
+  msg_t m = {{0}, 0};
+  msg_str(&m, "runtime error: slice bounds out of range [");
+  if (high < 0 || high > max) {
+    msg_str(&m, ":");
+    msg_int(&m, high);
+    msg_str(&m, "] with ");
+    msg_str(&m, what);
+    msg_str(&m, " ");
+    msg_int(&m, max);
+  } else {
+    msg_int(&m, low);
+    msg_str(&m, ":");
+    msg_int(&m, high);
+    msg_str(&m, "]");
+  }
+  rt_panic(m.buf);
+}
+
+// for s[low:high] on a string or array, which requires 0 <= low <= high <= len.
+void gogo_panic_slice(intptr_t low, intptr_t high, intptr_t len) {
+  panic_slice(low, high, len, "length");
+}
+
+// for s[low:high] on a slice, which requires 0 <= low <= high <= cap.
+void gogo_panic_slice_cap(intptr_t low, intptr_t high, intptr_t cap) {
+  panic_slice(low, high, cap, "capacity");
+}
+
+// for s[low:high:max], which requires 0 <= low <= high <= max <= cap.
+void gogo_panic_slice3(intptr_t low, intptr_t high, intptr_t max,
+                       intptr_t cap) {
+  msg_t m = {{0}, 0};
+  msg_str(&m, "runtime error: slice bounds out of range [");
+  if (max < 0 || max > cap) {
+    msg_str(&m, "::");
+    msg_int(&m, max);
+    msg_str(&m, "] with capacity ");
+    msg_int(&m, cap);
+  } else if (high < 0 || high > max) {
+    msg_str(&m, ":");
+    msg_int(&m, high);
+    msg_str(&m, ":");
+    msg_int(&m, max);
+    msg_str(&m, "]");
+  } else {
+    msg_int(&m, low);
+    msg_str(&m, ":");
+    msg_int(&m, high);
+    msg_str(&m, ":]");
+  }
+  rt_panic(m.buf);
+}
+
+// for converting a slice to an array, or a pointer to one, of length n.
+void gogo_panic_slice_convert(intptr_t len, intptr_t n) {
+  msg_t m = {{0}, 0};
+  msg_str(&m, "runtime error: cannot convert slice with length ");
+  msg_int(&m, len);
+  msg_str(&m, " to array or pointer to array with length ");
+  msg_int(&m, n);
+  rt_panic(m.buf);
+}
+
+/*
+ * Checks the arguments of unsafe.Slice or unsafe.String, which fn names:
+ * len elements of elem_size bytes each, starting at ptr.
+ */
+void gogo_unsafe_slice_check(const char *fn, const void *ptr, intptr_t len,
+                             intptr_t elem_size) {
+  intptr_t max = elem_size > 0 ? INTPTR_MAX / elem_size : INTPTR_MAX;
+  const char *problem = NULL;
+  if (len < 0 || len > max) {
+    problem = ": len out of range";
+  } else if (ptr == NULL && len > 0) {
+    problem = ": ptr is nil and len is not zero";
+  }
+  if (problem != NULL) {
+    msg_t m = {{0}, 0};
+    msg_str(&m, "runtime error: ");
+    msg_str(&m, fn);
+    msg_str(&m, problem);
+    rt_panic(m.buf);
+  }
+}
+
+void gogo_panic_nil(void) {
+  rt_panic("runtime error: invalid memory address or nil pointer dereference");
+}
+
+// writes the name of a method, given its key (which has its signature too).
+static void msg_method(msg_t *m, const char *key) {
+  while (*key != '\0' && *key != '(' && m->len < sizeof(m->buf) - 1) {
+    m->buf[m->len++] = *key++;
+  }
+  m->buf[m->len] = '\0';
+}
+
+// for x.(T) on an interface x of type iface that doesn't hold a T.
+void gogo_panic_assert(void *itab, const char *iface, const char *want) {
+  msg_t m = {{0}, 0};
+  msg_str(&m, "interface conversion: ");
+  msg_str(&m, iface);
+  msg_str(&m, " is ");
+  if (itab == NULL) {
+    msg_str(&m, "nil");
+  } else {
+    msg_str(&m, ((const gogo_type_t *)((void **)itab)[0])->name);
+  }
+  msg_str(&m, ", not ");
+  msg_str(&m, want);
+  rt_panic(m.buf);
+}
+
+// for x.(I) on an interface x whose value doesn't implement the interface I.
+void gogo_panic_assert_iface(void *itab, const char *iface, void *want) {
+  const gogo_iface_t *want_iface = want;
+  msg_t m = {{0}, 0};
+  msg_str(&m, "interface conversion: ");
+  if (itab == NULL) {
+    msg_str(&m, iface);
+    msg_str(&m, " is nil, not ");
+    msg_str(&m, want_iface->name);
+    rt_panic(m.buf);
+  }
+  const gogo_type_t *type = ((void **)itab)[0];
+  msg_str(&m, type->name);
+  msg_str(&m, " is not ");
+  msg_str(&m, want_iface->name);
+  msg_str(&m, ": missing method ");
+  msg_method(&m, gogo_missing_method(type, want_iface));
+  rt_panic(m.buf);
+}
+
+void gogo_panic_unhashable(const gogo_type_t *type) {
+  msg_t m = {{0}, 0};
+  msg_str(&m, "runtime error: hash of unhashable type ");
+  msg_str(&m, type->name);
+  rt_panic(m.buf);
+}
@@ -0,0 +1,30 @@
+#include "rt.h"
+
+void print_float(double v);
+
+// Helpers for gogo's print and println builtins, matching the Go runtime's
+// formatting. Integers and floats are printed by print_int, print_uint and
+// print_float.
+
+void print_complex(double re, double im) {
+  rt_write("(", 1);
+  print_float(re);
+  print_float(im);
+  rt_write("i)", 2);
+}
+
+void print_string(const uint8_t *s, intptr_t len) {
+  rt_write((const char *)s, (size_t)len);
+}
+
+void print_bool(uint8_t b) {
+  if (b) {
+    rt_write("true", 4);
+  } else {
+    rt_write("false", 5);
+  }
+}
+
+void print_space(void) { rt_write(" ", 1); }
+
+void print_newline(void) { rt_write("\n", 1); }
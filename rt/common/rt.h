@@ -0,0 +1,29 @@
+#ifndef GOGO_RT_H
+#define GOGO_RT_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+// Shared between every port of the runtime. Code in common/ mustn't use libc,
+// so that it builds for freestanding targets; each port supplies these instead.
+
+// writes len bytes of buf to standard output.
+void rt_write(const char *buf, size_t len);
+
+// returns size bytes of zeroed memory, or NULL if there is none left. Memory
+// is never freed; gogo has no garbage collector yet.
+void *rt_alloc(size_t size);
+
+// returns a random seed, which should differ between runs. It's for hash
+// seeds and map iteration order, so it needn't be suitable for cryptography.
+uint64_t rt_random_seed(void);
+
+// prints "panic: <msg>" to standard error and exits with status 2.
+__attribute__((noreturn)) void rt_panic(const char *msg);
+
+// Provided by common/ for other runtime code.
+
+// like rt_alloc, but panics instead of returning NULL.
+void *gogo_alloc(intptr_t size);
+
+#endif
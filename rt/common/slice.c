@@ -0,0 +1,65 @@
+#include "rt.h"
+
+// Runtime support for slices. Generated code passes element sizes explicitly,
+// so these work for slices of any type.
+
+void *gogo_make_slice(intptr_t elem_size, intptr_t len, intptr_t cap) {
+  intptr_t max = elem_size > 0 ? INTPTR_MAX / elem_size : INTPTR_MAX;
+  if (len < 0 || len > max) {
+    rt_panic("runtime error: makeslice: len out of range");
+  }
+  if (cap < len || cap > max) {
+    rt_panic("runtime error: makeslice: cap out of range");
+  }
+  return gogo_alloc(cap * elem_size);
+}
+
+/*
+ * Makes room for new_len elements in a slice, for append. If the capacity
+ * isn't enough, the elements move to a new, larger backing array, using the
+ * same growth policy as Go: double small slices, and grow large ones by
+ * about 1.25x, so that appending is amortized constant time.
+ */
+void *gogo_slice_grow(void *ptr, intptr_t len, intptr_t cap, intptr_t new_len,
+                      intptr_t elem_size, intptr_t *new_cap) {
+  if (new_len <= cap) {
+    *new_cap = cap;
+    return ptr;
+  }
+  if (new_len < 0) {
+    rt_panic("runtime error: growslice: len out of range");
+  }
+
+  enum { THRESHOLD = 256 };
+  intptr_t c = cap;
+  if (new_len > c + c) {
+    c = new_len;
+  } else if (cap < THRESHOLD) {
+    c = c + c;
+  } else {
+    while (c > 0 && c < new_len) {
+      c += (c + 3 * THRESHOLD) / 4;
+    }
+    if (c <= 0) {
+      c = new_len;
+    }
+  }
+
+  intptr_t max = elem_size > 0 ? INTPTR_MAX / elem_size : INTPTR_MAX;
+  if (c > max) {
+    rt_panic("runtime error: growslice: len out of range");
+  }
+  void *out = gogo_alloc(c * elem_size);
+  if (len > 0) {
+    __builtin_memcpy(out, ptr, (size_t)(len * elem_size));
+  }
+  *new_cap = c;
+  return out;
+}
+
+// copies n bytes, which may overlap, for copy and append.
+void gogo_memmove(void *dst, const void *src, intptr_t n) {
+  if (n > 0) {
+    __builtin_memmove(dst, src, (size_t)n);
+  }
+}
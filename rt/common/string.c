@@ -0,0 +1,166 @@
+#include "rt.h"
+
+// Runtime support for strings. A gogo string is a pointer and a length; the
+// bytes are never modified once the string has been built, and needn't be
+// NUL-terminated.
+
+uint8_t *gogo_bytes_dup(const uint8_t *s, intptr_t len) {
+  uint8_t *out = gogo_alloc(len);
+  if (len > 0) {
+    __builtin_memcpy(out, s, (size_t)len);
+  }
+  return out;
+}
+
+uint8_t *gogo_string_concat(const uint8_t *a, intptr_t alen, const uint8_t *b,
+                            intptr_t blen) {
+  uint8_t *out = gogo_alloc(alen + blen);
+  if (alen > 0) {
+    __builtin_memcpy(out, a, (size_t)alen);
+  }
+  if (blen > 0) {
+    __builtin_memcpy(out + alen, b, (size_t)blen);
+  }
+  return out;
+}
+
+// compares two strings bytewise, returning -1, 0 or 1.
+intptr_t gogo_string_compare(const uint8_t *a, intptr_t alen, const uint8_t *b,
+                             intptr_t blen) {
+  intptr_t n = alen < blen ? alen : blen;
+  for (intptr_t i = 0; i < n; i++) {
+    if (a[i] != b[i]) {
+      return a[i] < b[i] ? -1 : 1;
+    }
+  }
+  if (alen == blen) {
+    return 0;
+  }
+  return alen < blen ? -1 : 1;
+}
+
+#define RUNE_ERROR 0xFFFD
+
+/*
+ * Decodes the rune at the start of s, the way Go's utf8.DecodeRune does:
+ * invalid encodings (including overlong forms and surrogates) decode as
+ * U+FFFD with a width of one byte.
+ */
+static int32_t decode_rune(const uint8_t *s, intptr_t len, intptr_t *width) {
+  uint8_t b0 = s[0];
+  if (b0 < 0x80) {
+    *width = 1;
+    return b0;
+  }
+  intptr_t n;
+  int32_t r, min;
+  if ((b0 & 0xE0) == 0xC0) {
+    n = 2, r = b0 & 0x1F, min = 0x80;
+  } else if ((b0 & 0xF0) == 0xE0) {
+    n = 3, r = b0 & 0x0F, min = 0x800;
+  } else if ((b0 & 0xF8) == 0xF0) {
+    n = 4, r = b0 & 0x07, min = 0x10000;
+  } else {
+    *width = 1;
+    return RUNE_ERROR;
+  }
+  if (len < n) {
+    *width = 1;
+    return RUNE_ERROR;
+  }
+  for (intptr_t i = 1; i < n; i++) {
+    if ((s[i] & 0xC0) != 0x80) {
+      *width = 1;
+      return RUNE_ERROR;
+    }
+    r = (r << 6) | (s[i] & 0x3F);
+  }
+  if (r < min || r > 0x10FFFF || (r >= 0xD800 && r <= 0xDFFF)) {
+    *width = 1;
+    return RUNE_ERROR;
+  }
+  *width = n;
+  return r;
+}
+
+// encodes r as UTF-8 into buf (if not NULL), returning the number of bytes.
+static intptr_t encode_rune(int32_t r, uint8_t *buf) {
+  if (r < 0 || r > 0x10FFFF || (r >= 0xD800 && r <= 0xDFFF)) {
+    r = RUNE_ERROR;
+  }
+  if (r < 0x80) {
+    if (buf) {
+      buf[0] = (uint8_t)r;
+    }
+    return 1;
+  }
+  if (r < 0x800) {
+    if (buf) {
+      buf[0] = 0xC0 | (r >> 6);
+      buf[1] = 0x80 | (r & 0x3F);
+    }
+    return 2;
+  }
+  if (r < 0x10000) {
+    if (buf) {
+      buf[0] = 0xE0 | (r >> 12);
+      buf[1] = 0x80 | ((r >> 6) & 0x3F);
+      buf[2] = 0x80 | (r & 0x3F);
+    }
+    return 3;
+  }
+  if (buf) {
+    buf[0] = 0xF0 | (r >> 18);
+    buf[1] = 0x80 | ((r >> 12) & 0x3F);
+    buf[2] = 0x80 | ((r >> 6) & 0x3F);
+    buf[3] = 0x80 | (r & 0x3F);
+  }
+  return 4;
+}
+
+// decodes s into a new array of runes, storing how many there are in *count.
+int32_t *gogo_string_to_runes(const uint8_t *s, intptr_t len, intptr_t *count) {
+  intptr_t n = 0, width;
+  for (intptr_t i = 0; i < len; i += width) {
+    decode_rune(s + i, len - i, &width);
+    n++;
+  }
+  int32_t *out = gogo_alloc(n * (intptr_t)sizeof(int32_t));
+  n = 0;
+  for (intptr_t i = 0; i < len; i += width) {
+    out[n++] = decode_rune(s + i, len - i, &width);
+  }
+  *count = n;
+  return out;
+}
+
+// encodes n runes as a new UTF-8 string, storing its length in *len.
+uint8_t *gogo_runes_to_string(const int32_t *runes, intptr_t n, intptr_t *len) {
+  intptr_t size = 0;
+  for (intptr_t i = 0; i < n; i++) {
+    size += encode_rune(runes[i], NULL);
+  }
+  uint8_t *out = gogo_alloc(size);
+  intptr_t pos = 0;
+  for (intptr_t i = 0; i < n; i++) {
+    pos += encode_rune(runes[i], out + pos);
+  }
+  *len = size;
+  return out;
+}
+
+// encodes r as a new UTF-8 string, storing its length in *len.
+uint8_t *gogo_rune_to_string(int32_t r, intptr_t *len) {
+  uint8_t *out = gogo_alloc(4);
+  *len = encode_rune(r, out);
+  return out;
+}
+
+/*
+ * Decodes the rune starting at byte i of s, for ranging over a string, and
+ * stores the number of bytes it takes up in *width.
+ */
+int32_t gogo_string_decode_rune(const uint8_t *s, intptr_t len, intptr_t i,
+                                intptr_t *width) {
+  return decode_rune(s + i, len - i, width);
+}
@@ -0,0 +1,31 @@
+#include "rt.h"
+
+// A bump allocator over the wasm linear memory, growing it as needed. Nothing
+// is ever freed, so fresh memory from memory.grow is already zeroed.
+
+#define WASM_PAGE_SIZE 65536
+
+// the end of the data segment, defined by wasm-ld.
+extern uint8_t __heap_base;
+
+static uintptr_t heap_top = 0;
+
+void *rt_alloc(size_t size) {
+  if (heap_top == 0) {
+    heap_top = (uintptr_t)&__heap_base;
+  }
+  uintptr_t start = (heap_top + 7) & ~(uintptr_t)7;
+  uintptr_t end = start + size;
+  if (end < start) {
+    return NULL;
+  }
+  uintptr_t limit = __builtin_wasm_memory_size(0) * WASM_PAGE_SIZE;
+  if (end > limit) {
+    uintptr_t pages = (end - limit + WASM_PAGE_SIZE - 1) / WASM_PAGE_SIZE;
+    if (__builtin_wasm_memory_grow(0, pages) == (size_t)-1) {
+      return NULL;
+    }
+  }
+  heap_top = end;
+  return (void *)start;
+}
@@ -0,0 +1,47 @@
+#include "rt.h"
+
+// Even freestanding, clang may emit calls to these, and there's no libc to
+// provide them.
+
+void *memcpy(void *dst, const void *src, size_t n) {
+  uint8_t *d = dst;
+  const uint8_t *s = src;
+  while (n-- > 0) {
+    *d++ = *s++;
+  }
+  return dst;
+}
+
+void *memmove(void *dst, const void *src, size_t n) {
+  uint8_t *d = dst;
+  const uint8_t *s = src;
+  if (d < s) {
+    while (n-- > 0) {
+      *d++ = *s++;
+    }
+  } else {
+    while (n-- > 0) {
+      d[n] = s[n];
+    }
+  }
+  return dst;
+}
+
+void *memset(void *dst, int c, size_t n) {
+  uint8_t *d = dst;
+  while (n-- > 0) {
+    *d++ = (uint8_t)c;
+  }
+  return dst;
+}
+
+int memcmp(const void *a, const void *b, size_t n) {
+  const uint8_t *x = a;
+  const uint8_t *y = b;
+  for (size_t i = 0; i < n; i++) {
+    if (x[i] != y[i]) {
+      return x[i] < y[i] ? -1 : 1;
+    }
+  }
+  return 0;
+}
@@ -0,0 +1,57 @@
+#include "rt.h"
+#include "wasi.h"
+
+// There's no libc here, so integers are formatted by hand.
+
+static void print_digits(uint64_t u, int negative) {
+  uint8_t buf[21];
+  size_t pos = sizeof(buf);
+  do {
+    buf[--pos] = '0' + (u % 10);
+    u /= 10;
+  } while (u != 0);
+  if (negative) {
+    buf[--pos] = '-';
+  }
+  wasi_write_all(WASI_STDOUT, buf + pos, sizeof(buf) - pos);
+}
+
+void print_int(int64_t i) {
+  if (i < 0) {
+    // negate in unsigned arithmetic so INT64_MIN doesn't overflow.
+    print_digits(-(uint64_t)i, 1);
+  } else {
+    print_digits((uint64_t)i, 0);
+  }
+}
+
+void print_uint(uint64_t u) {
+  print_digits(u, 0);
+}
+
+// gogo programs may still call libc's puts directly.
+int puts(const char *s) {
+  size_t len = 0;
+  while (s[len] != '\0') {
+    len++;
+  }
+  if (wasi_write_all(WASI_STDOUT, (const uint8_t *)s, len) != 0) {
+    return -1;
+  }
+  return wasi_write_all(WASI_STDOUT, (const uint8_t *)"\n", 1);
+}
+
+void rt_write(const char *buf, size_t len) {
+  wasi_write_all(WASI_STDOUT, (const uint8_t *)buf, len);
+}
+
+void rt_panic(const char *msg) {
+  size_t len = 0;
+  while (msg[len] != '\0') {
+    len++;
+  }
+  wasi_write_all(WASI_STDERR, (const uint8_t *)"panic: ", 7);
+  wasi_write_all(WASI_STDERR, (const uint8_t *)msg, len);
+  wasi_write_all(WASI_STDERR, (const uint8_t *)"\n", 1);
+  wasi_proc_exit(2);
+}
@@ -0,0 +1,8 @@
+#include "rt.h"
+#include "wasi.h"
+
+uint64_t rt_random_seed(void) {
+  uint64_t seed = 0;
+  wasi_random_get((uint8_t *)&seed, sizeof(seed));
+  return seed;
+}
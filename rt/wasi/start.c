@@ -0,0 +1,23 @@
+#include "wasi.h"
+
+// gogo emits the program's entry point as a plain `main` symbol; bind to it by
+// name so clang doesn't apply its C-specific handling of main.
+extern void gogo_main(void) __asm__("main");
+
+void _start(void) {
+  gogo_main();
+  wasi_proc_exit(0);
+}
+
+int wasi_write_all(int32_t fd, const uint8_t *buf, size_t len) {
+  while (len > 0) {
+    wasi_ciovec_t iov = {buf, len};
+    size_t written = 0;
+    if (wasi_fd_write(fd, &iov, 1, &written) != 0) {
+      return -1;
+    }
+    buf += written;
+    len -= written;
+  }
+  return 0;
+}
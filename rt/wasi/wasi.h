@@ -0,0 +1,29 @@
+#ifndef GOGO_WASI_H
+#define GOGO_WASI_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+// The handful of WASI (snapshot preview1) imports the runtime needs.
+
+typedef struct {
+  const uint8_t *buf;
+  size_t len;
+} wasi_ciovec_t;
+
+__attribute__((import_module("wasi_snapshot_preview1"), import_name("fd_write")))
+int32_t wasi_fd_write(int32_t fd, const wasi_ciovec_t *iovs, size_t iovs_len, size_t *nwritten);
+
+__attribute__((import_module("wasi_snapshot_preview1"), import_name("proc_exit"), noreturn))
+void wasi_proc_exit(int32_t code);
+
+__attribute__((import_module("wasi_snapshot_preview1"), import_name("random_get")))
+int32_t wasi_random_get(uint8_t *buf, size_t len);
+
+#define WASI_STDOUT 1
+#define WASI_STDERR 2
+
+// writes all of buf to fd, retrying on short writes. Returns 0 on success.
+int wasi_write_all(int32_t fd, const uint8_t *buf, size_t len);
+
+#endif
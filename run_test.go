@@ -0,0 +1,454 @@
+package main
+
+import "bytes"
+import "os"
+import "os/exec"
+import "path/filepath"
+import "strings"
+import "testing"
+
+/*
+ * runProgram compiles `src` for the host, links it against the runtime, and
+ * runs it. It returns what the program wrote to stdout and stderr, and its exit
+ * status. The test is skipped if llc or clang aren't installed, or if the
+ * runtime hasn't been built with `make -C rt`.
+ */
+func runProgram(t *testing.T, src string) (string, string, int) {
+	for _, tool := range []string{"llc", "clang"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+	target, diag := CreateNativeTarget()
+	if diag != nil {
+		t.Fatalf("CreateNativeTarget: %s", diag.Msg())
+	}
+	defer target.DisposeTarget()
+	runtimeObj, diag := FindRuntime(target)
+	if diag != nil {
+		t.Skip(diag.Msg())
+	}
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.go")
+	bitcode := filepath.Join(dir, "test.bc")
+	object := filepath.Join(dir, "test.o")
+	exe := filepath.Join(dir, target.ExecutableName("test"))
+	if err := os.WriteFile(input, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pipe := CreatePipeline()
+	pipe.AddStage(CreateGocStage(input, bitcode, target))
+	pipe.AddStage(CreateLLCStage(bitcode, object, target))
+	pipe.AddStage(CreateLinkStage([]string{runtimeObj, object}, exe, target))
+	if diag := pipe.Execute(false); diag != nil {
+		if cmdErr, ok := diag.(*CmdErr); ok {
+			t.Fatalf("%s: %s\n%s", cmdErr.Stage.Name(), diag.Msg(), cmdErr.Output)
+		}
+		t.Fatalf("compiling: %s", diag.Msg())
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(exe)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	status := 0
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Fatalf("running %s: %s", exe, err)
+		}
+		status = exitErr.ExitCode()
+	}
+	return stdout.String(), stderr.String(), status
+}
+
+// a program to run, and what it should print (or panic with).
+type runCase struct {
+	name string
+	src  string
+	want string
+}
+
+// runs each program, and checks it exits normally after printing `want`.
+func expectOutputs(t *testing.T, cases []runCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stdout, stderr, status := runProgram(t, c.src)
+			if status != 0 {
+				t.Fatalf("exited with status %d:\n%s", status, stderr)
+			}
+			if stdout != c.want {
+				t.Errorf("printed %q, want %q", stdout, c.want)
+			}
+		})
+	}
+}
+
+// runs each program, and checks it panics with the message `want`.
+func expectPanics(t *testing.T, cases []runCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, stderr, status := runProgram(t, c.src)
+			if status != 2 || !strings.Contains(stderr, "panic: "+c.want+"\n") {
+				t.Errorf("exited with status %d and %q, want a panic with %q", status, stderr, c.want)
+			}
+		})
+	}
+}
+
+func TestPrintFloat(t *testing.T) {
+	expectOutputs(t, []runCase{
+		{"PrintFloat", `package main
+
+func main() {
+	print_float(1.5)
+}
+`, "+1.500000e+000"},
+		{"PrintlnFloats", `package main
+
+func main() {
+	var f float32 = 0.1
+	zero := 0.0
+	println(1.5, -0.25, zero, 1e21, f)
+	println(1/zero, -1/zero, zero/zero)
+}
+`, "+1.500000e+000 -2.500000e-001 +0.000000e+000 +1.000000e+021 +1.000000e-001\n+Inf -Inf NaN\n"},
+	})
+}
+
+func TestPrintComplex(t *testing.T) {
+	expectOutputs(t, []runCase{
+		{"PrintComplex", `package main
+
+func main() {
+	var c complex64 = 0.5i
+	println(1-2i, c, true)
+}
+`, "(+1.000000e+000-2.000000e+000i) (+0.000000e+000+5.000000e-001i) true\n"},
+	})
+}
+
+func TestPrintString(t *testing.T) {
+	expectOutputs(t, []runCase{
+		{"PrintString", `package main
+
+func main() {
+	s := "hello"
+	println(s, 42)
+	print(s[1:3], "", "!")
+}
+`, "hello 42\nel!"},
+	})
+}
+
+func TestStringPanics(t *testing.T) {
+	expectPanics(t, []runCase{
+		{"IndexOutOfRange", `package main
+
+func main() {
+	s := "abc"
+	i := 5
+	x := s[i]
+}
+`, "runtime error: index out of range [5] with length 3"},
+		{"NegativeIndex", `package main
+
+func main() {
+	s := "abc"
+	i := -1
+	x := s[i]
+}
+`, "runtime error: index out of range [-1]"},
+		{"SliceOutOfRange", `package main
+
+func main() {
+	s := "abc"
+	i := 5
+	t := s[1:i]
+}
+`, "runtime error: slice bounds out of range [:5] with length 3"},
+	})
+}
+
+func TestArrayPanics(t *testing.T) {
+	expectPanics(t, []runCase{
+		{"IndexOutOfRange", `package main
+
+func main() {
+	var a [3]int
+	i := 3
+	a[i] = 1
+}
+`, "runtime error: index out of range [3] with length 3"},
+		{"NegativeIndex", `package main
+
+func main() {
+	a := [3]int{1, 2, 3}
+	i := -2
+	x := a[i]
+}
+`, "runtime error: index out of range [-2]"},
+	})
+}
+
+func TestSlicePanics(t *testing.T) {
+	expectPanics(t, []runCase{
+		{"IndexOutOfRange", `package main
+
+func main() {
+	s := make([]int, 2, 3)
+	i := 2
+	x := s[i]
+}
+`, "runtime error: index out of range [2] with length 2"},
+		{"SliceBeyondCapacity", `package main
+
+func main() {
+	s := make([]int, 2, 3)
+	i := 5
+	t := s[:i]
+}
+`, "runtime error: slice bounds out of range [:5] with capacity 3"},
+		{"InvertedSlice", `package main
+
+func main() {
+	s := make([]int, 2, 3)
+	i := 2
+	t := s[i:1]
+}
+`, "runtime error: slice bounds out of range [2:1]"},
+		{"MakeNegativeLength", `package main
+
+func main() {
+	n := -1
+	s := make([]int, n)
+}
+`, "runtime error: makeslice: len out of range"},
+		{"MakeCapacityBelowLength", `package main
+
+func main() {
+	n := 1
+	s := make([]int, 2, n)
+}
+`, "runtime error: makeslice: cap out of range"},
+	})
+}
+
+func TestInterfacePanics(t *testing.T) {
+	expectPanics(t, []runCase{
+		{"FailedAssertion", `package main
+
+func main() {
+	var x any = 1
+	s := x.(string)
+}
+`, "interface conversion: interface {} is int, not string"},
+		{"NilAssertion", `package main
+
+func main() {
+	var x any
+	s := x.(string)
+}
+`, "interface conversion: interface {} is nil, not string"},
+		{"MissingMethod", `package main
+
+type Stringer interface {
+	String() string
+}
+
+type T int
+
+func main() {
+	var x any = T(1)
+	s := x.(Stringer)
+}
+`, "interface conversion: T is not Stringer: missing method String"},
+		{"NilMethodCall", `package main
+
+func main() {
+	var e error
+	s := e.Error()
+}
+`, "runtime error: invalid memory address or nil pointer dereference"},
+	})
+}
+
+func TestMapPanics(t *testing.T) {
+	expectPanics(t, []runCase{
+		{"NilMapWrite", `package main
+
+func main() {
+	var m map[string]int
+	m["x"] = 1
+}
+`, "assignment to entry in nil map"},
+		{"NilMapIncrement", `package main
+
+func main() {
+	var m map[string]int
+	m["x"]++
+}
+`, "assignment to entry in nil map"},
+		{"UnhashableKeyWrite", `package main
+
+func main() {
+	m := map[any]int{}
+	m[[]int{1}] = 1
+}
+`, "runtime error: hash of unhashable type []int"},
+		{"UnhashableKeyLookup", `package main
+
+func main() {
+	m := map[any]int{1: 1}
+	var k any = map[string]int{}
+	n := m[k]
+}
+`, "runtime error: hash of unhashable type map[string]int"},
+		{"UnhashableNestedKey", `package main
+
+type pair struct {
+	a, b any
+}
+
+func main() {
+	m := map[pair]int{}
+	m[pair{1, []string{}}] = 1
+}
+`, "runtime error: hash of unhashable type []string"},
+	})
+}
+
+func TestClosurePanics(t *testing.T) {
+	expectPanics(t, []runCase{
+		{"CallingNil", `package main
+
+func main() {
+	var f func() int
+	n := f()
+}
+`, "runtime error: invalid memory address or nil pointer dereference"},
+		{"CallingNilArgument", `package main
+
+func apply(f func(int) int, x int) int {
+	return f(x)
+}
+
+func main() {
+	n := apply(nil, 1)
+}
+`, "runtime error: invalid memory address or nil pointer dereference"},
+	})
+}
+
+func TestPointerPanics(t *testing.T) {
+	expectPanics(t, []runCase{
+		{"NilDereference", `package main
+
+func main() {
+	var p *int
+	n := *p
+}
+`, "runtime error: invalid memory address or nil pointer dereference"},
+		{"NilStore", `package main
+
+func main() {
+	var p *int
+	*p = 1
+}
+`, "runtime error: invalid memory address or nil pointer dereference"},
+		{"NilFieldAccess", `package main
+
+type point struct {
+	x, y int
+}
+
+func main() {
+	var p *point
+	n := p.y
+}
+`, "runtime error: invalid memory address or nil pointer dereference"},
+	})
+}
+
+func TestUnsafePanics(t *testing.T) {
+	expectPanics(t, []runCase{
+		{"SliceNegativeLength", `package main
+
+import "unsafe"
+
+func main() {
+	x := 1
+	n := -1
+	s := unsafe.Slice(&x, n)
+}
+`, "runtime error: unsafe.Slice: len out of range"},
+		{"SliceNilPointer", `package main
+
+import "unsafe"
+
+func main() {
+	var p *int
+	s := unsafe.Slice(p, 2)
+}
+`, "runtime error: unsafe.Slice: ptr is nil and len is not zero"},
+		{"StringNilPointer", `package main
+
+import "unsafe"
+
+func main() {
+	var p *byte
+	s := unsafe.String(p, 3)
+}
+`, "runtime error: unsafe.String: ptr is nil and len is not zero"},
+		{"StringNegativeLength", `package main
+
+import "unsafe"
+
+func main() {
+	b := byte('a')
+	n := -1
+	s := unsafe.String(&b, n)
+}
+`, "runtime error: unsafe.String: len out of range"},
+	})
+}
+
+func TestConversionPanics(t *testing.T) {
+	expectPanics(t, []runCase{
+		{"SliceToArrayTooShort", `package main
+
+func main() {
+	s := []int{1, 2}
+	a := [3]int(s)
+}
+`, "runtime error: cannot convert slice with length 2 to array or pointer to array with length 3"},
+		{"SliceToArrayPointerTooShort", `package main
+
+func main() {
+	var s []int
+	p := (*[1]int)(s)
+}
+`, "runtime error: cannot convert slice with length 0 to array or pointer to array with length 1"},
+	})
+}
+
+func TestShiftPanics(t *testing.T) {
+	expectPanics(t, []runCase{
+		{"NegativeShiftCount", `package main
+
+func main() {
+	n := -1
+	x := 1 << n
+}
+`, "runtime error: negative shift amount"},
+		{"NegativeRightShiftCount", `package main
+
+func main() {
+	var x int64 = 8
+	var n int8 = -3
+	y := x >> n
+}
+`, "runtime error: negative shift amount"},
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+/*
+ * The runtime support functions that generated code calls into. Unlike the
+ * functions in initPrint, these aren't visible to gogo programs.
+ */
+func (trans *Translator) initRuntime() {
+	trans.Runtime = make(map[string]*FuncValue)
+	intTy := trans.Scope.lookupType("int")
+	trans.declareRuntimeFunction("gogo_panic_divide", nil)
+	trans.declareRuntimeFunction("gogo_panic_shift", nil)
+	trans.declareRuntimeFunction("gogo_panic_index", nil, intTy, intTy)
+	trans.declareRuntimeFunction("gogo_panic_slice", nil, intTy, intTy, intTy)
+	trans.declareRuntimeFunction("gogo_panic_slice_cap", nil, intTy, intTy, intTy)
+	trans.declareRuntimeFunction("gogo_panic_slice3", nil, intTy, intTy, intTy, intTy)
+	trans.declareRuntimeFunction("gogo_panic_slice_convert", nil, intTy, intTy)
+
+	float64Ty := trans.Scope.lookupType("float64")
+	float64Ptr := &PointerType{float64Ty}
+	trans.declareRuntimeFunction("gogo_complex128_div", nil, float64Ty, float64Ty, float64Ty, float64Ty, float64Ptr, float64Ptr)
+
+	bytePtr := &PointerType{trans.Scope.lookupType("uint8")}
+	runePtr := &PointerType{trans.Scope.lookupType("int32")}
+	intPtr := &PointerType{intTy}
+	trans.declareRuntimeFunction("gogo_bytes_dup", bytePtr, bytePtr, intTy)
+	trans.declareRuntimeFunction("gogo_string_concat", bytePtr, bytePtr, intTy, bytePtr, intTy)
+	trans.declareRuntimeFunction("gogo_string_compare", intTy, bytePtr, intTy, bytePtr, intTy)
+	trans.declareRuntimeFunction("gogo_string_to_runes", runePtr, bytePtr, intTy, intPtr)
+	trans.declareRuntimeFunction("gogo_runes_to_string", bytePtr, runePtr, intTy, intPtr)
+	trans.declareRuntimeFunction("gogo_rune_to_string", bytePtr, trans.Scope.lookupType("int32"), intPtr)
+	trans.declareRuntimeFunction("gogo_string_decode_rune", trans.Scope.lookupType("int32"), bytePtr, intTy, intTy, intPtr)
+
+	trans.declareRuntimeFunction("gogo_make_slice", bytePtr, intTy, intTy, intTy)
+	trans.declareRuntimeFunction("gogo_slice_grow", bytePtr, bytePtr, intTy, intTy, intTy, intTy, intPtr)
+	trans.declareRuntimeFunction("gogo_memmove", nil, bytePtr, bytePtr, intTy)
+	trans.declareRuntimeFunction("gogo_unsafe_slice_check", nil, bytePtr, bytePtr, intTy, intTy)
+
+	// interfaces. Descriptors and itables are passed as plain pointers.
+	trans.declareRuntimeFunction("gogo_alloc", bytePtr, intTy)
+	trans.declareRuntimeFunction("gogo_itab_convert", bytePtr, bytePtr, bytePtr)
+	trans.declareRuntimeFunction("gogo_type_of", bytePtr, bytePtr)
+	trans.declareRuntimeFunction("gogo_panic_nil", nil)
+	trans.declareRuntimeFunction("gogo_panic_assert", nil, bytePtr, bytePtr, bytePtr)
+	trans.declareRuntimeFunction("gogo_panic_assert_iface", nil, bytePtr, bytePtr, bytePtr)
+
+	// maps. Keys are passed by reference, and values are returned that way.
+	trans.declareRuntimeFunction("gogo_map_make", bytePtr, bytePtr, intTy)
+	trans.declareRuntimeFunction("gogo_map_len", intTy, bytePtr)
+	trans.declareRuntimeFunction("gogo_map_lookup", bytePtr, bytePtr, bytePtr, bytePtr)
+	trans.declareRuntimeFunction("gogo_map_find", bytePtr, bytePtr, bytePtr, bytePtr)
+	trans.declareRuntimeFunction("gogo_map_zero", bytePtr, bytePtr)
+	trans.declareRuntimeFunction("gogo_map_assign", bytePtr, bytePtr, bytePtr, bytePtr)
+	trans.declareRuntimeFunction("gogo_map_delete", nil, bytePtr, bytePtr, bytePtr)
+	trans.declareRuntimeFunction("gogo_map_iter_init", nil, bytePtr, bytePtr)
+	trans.declareRuntimeFunction("gogo_map_iter_next", bytePtr, bytePtr)
+}
+
+func (trans *Translator) declareRuntimeFunction(name string, result Type, params ...Type) *FuncValue {
+	ty := &FuncType{params, result}
+	llvmVal := trans.mod.AddFunction(name, ty.LLVMSignature())
+	fn := &FuncValue{name, ty, llvmVal}
+	trans.Runtime[name] = fn
+	return fn
+}
+
+func (trans *Translator) runtimeFunction(name string) *FuncValue {
+	fn, ok := trans.Runtime[name]
+	assert(ok, "Unknown runtime function!")
+	return fn
+}
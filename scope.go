@@ -34,12 +34,12 @@ func (scope *Scope) lookupType(ident string) Type {
 }
 
 /*
- * addType adds type `ty` to scope iff `ident` is not bound to a type already. Returns `true` on success.
- *
+ * addType adds type `ty` to scope iff `ident` is not bound to a type in this
+ * scope already. Types in enclosing scopes may be shadowed. Returns `true` on
+ * success.
  */
 func (scope *Scope) addType(ident string, ty Type) bool {
-	existing := scope.lookupType(ident)
-	if existing != nil {
+	if _, exists := (*scope.Types)[ident]; exists {
 		return false
 	}
 
@@ -50,8 +50,8 @@ func (scope *Scope) addType(ident string, ty Type) bool {
 
 /*
  * addTypeAlias first looks up type at identifier `rTypeID`.
- * Then, it adds an alias at `lTypeID` which references the rvalue type.
- * In short, types[lTypeID] = Alias{types[rTypeID]}
+ * Then, it binds `lTypeID` to that very type, so the two are identical.
+ * In short, types[lTypeID] = types[rTypeID]
  *
  * returns `nil` on success.
  *
@@ -65,8 +65,7 @@ func (scope *Scope) addTypeAlias(lTypeID string, rTypeID string) *UDiag {
 		udiag := UDiag(fmt.Sprintf("Type \"%s\" not found.", rTypeID))
 		return &udiag
 	}
-	lType := &AliasType{lTypeID, rType}
-	if !scope.addType(lTypeID, lType) {
+	if !scope.addType(lTypeID, rType) {
 		udiag := UDiag(fmt.Sprintf("Type \"%s\" already exists.", lTypeID))
 		return &udiag
 	}
@@ -77,27 +76,56 @@ func (scope *Scope) addTypeAlias(lTypeID string, rTypeID string) *UDiag {
  * Looks up the value bound to `ident` in the Value map.
  */
 func (scope *Scope) lookupVar(ident string) *BoundVar {
+	v, _ := scope.lookupVarScope(ident)
+	return v
+}
+
+// like lookupVar, but also returns the scope that `ident` is bound in.
+func (scope *Scope) lookupVarScope(ident string) (*BoundVar, *Scope) {
 	targetScope := scope
 	for targetScope != nil {
 		v, ok := (*targetScope.Values)[ident]
 		if ok {
 			assert(v != nil, "Found a nil binding!")
-			return v
+			return v, targetScope
 		}
 		targetScope = targetScope.Parent
 	}
-	return nil
+	return nil, nil
+}
+
+// reports whether `scope` is `outer`, or nested inside of it.
+func (scope *Scope) within(outer *Scope) bool {
+	for targetScope := scope; targetScope != nil; targetScope = targetScope.Parent {
+		if targetScope == outer {
+			return true
+		}
+	}
+	return false
 }
 
+/*
+ * addValue binds `ident` to `val` in this scope. Names from enclosing scopes
+ * may be shadowed, but a name can only be bound once per scope.
+ */
 func (scope *Scope) addValue(ident string, val UntypedValue) bool {
-	existing := scope.lookupVar(ident)
-	if existing == nil {
+	_, exists := (*scope.Values)[ident]
+	if !exists {
 		(*scope.Values)[ident] = &BoundVar{ident, false, val}
 		return true
 	}
 	return false
 }
 
+// like addValue, but the binding is a constant, which can't be assigned to.
+func (scope *Scope) addConst(ident string, val UntypedValue) bool {
+	if !scope.addValue(ident, val) {
+		return false
+	}
+	(*scope.Values)[ident].Const = true
+	return true
+}
+
 func (scope *Scope) dump() {
 	fmt.Printf("Types:\n")
 	for name, ty := range *scope.Types {
@@ -0,0 +1,244 @@
+package main
+
+import "go/ast"
+import "llvm"
+
+func isSliceType(ty Type) bool {
+	_, ok := ty.Base().(*SliceType)
+	return ok
+}
+
+func isArrayType(ty Type) bool {
+	_, ok := ty.Base().(*ArrayType)
+	return ok
+}
+
+// builds the slice header { ptr, len, cap } of type `ty`.
+func (block *Block) buildSlice(ty Type, ptr llvm.Value, length llvm.Value, capacity llvm.Value) llvm.Value {
+	agg := llvm.Undef(ty.LLVM())
+	agg = block.Builder.BuildInsertValue(agg, ptr, 0, "")
+	agg = block.Builder.BuildInsertValue(agg, length, 1, "")
+	return block.Builder.BuildInsertValue(agg, capacity, 2, "")
+}
+
+// splits a slice header into its pointer, length and capacity.
+func (block *Block) splitSlice(val llvm.Value) (llvm.Value, llvm.Value, llvm.Value) {
+	ptr := block.Builder.BuildExtractValue(val, 0, "")
+	length := block.Builder.BuildExtractValue(val, 1, "")
+	capacity := block.Builder.BuildExtractValue(val, 2, "")
+	return ptr, length, capacity
+}
+
+// the size in bytes of one element of `slice`, as an int constant.
+func (block *Block) elemSize(slice *SliceType) llvm.Value {
+	size := block.Trans.Target.AllocSize(MemLLVM(slice.Elem))
+	return llvm.ConstInt(global_type_factory.IntType(BLTN_TY_INT).LLVM(), size, false)
+}
+
+func (block *Block) buildBytePtr(ptr llvm.Value) llvm.Value {
+	bytePtr := llvm.PointerType(llvm.IntType(8), 0)
+	return block.Builder.BuildBitCast(ptr, bytePtr, "")
+}
+
+// translates `make([]T, len)` and `make([]T, len, cap)`.
+func (block *Block) translateMakeSlice(call *ast.CallExpr, ty Type, slice *SliceType) (UntypedValue, *GoDiag) {
+	if len(call.Args) < 2 || len(call.Args) > 3 {
+		return nil, DiagFromAST(call, "make(%s) expects a length and an optional capacity.", ty.String())
+	}
+	length, diag := block.translateIndex(call.Args[1])
+	if diag != nil {
+		return nil, diag
+	}
+	capacity := length
+	if len(call.Args) == 3 {
+		capacity, diag = block.translateIndex(call.Args[2])
+		if diag != nil {
+			return nil, diag
+		}
+		lenConst, lenOk := constIndex(length)
+		capConst, capOk := constIndex(capacity)
+		if lenOk && capOk && lenConst.Cmp(capConst) > 0 {
+			return nil, DiagFromAST(call, "Length %s is larger than capacity %s.", lenConst.String(), capConst.String())
+		}
+	}
+	mem := block.buildRuntimeCall("gogo_make_slice", block.elemSize(slice), length.LLVM(), capacity.LLVM())
+	ptr := block.Builder.BuildBitCast(mem, llvm.PointerType(MemLLVM(slice.Elem), 0), "")
+	return &Register{ty, block.buildSlice(ty, ptr, length.LLVM(), capacity.LLVM())}, nil
+}
+
+/*
+ * translateAppendBuiltin translates `append(s, x, y, ...)` and `append(s, t...)`.
+ * The runtime makes room for the new elements first, moving them to a bigger
+ * backing array if need be, and then they're stored after the old ones.
+ */
+func (block *Block) translateAppendBuiltin(call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	if len(call.Args) == 0 {
+		return nil, DiagFromAST(call, "Built-in function append expects at least one argument.")
+	}
+	s, diag := block.translateOperand(call.Args[0])
+	if diag != nil {
+		return nil, diag
+	}
+	typed, udiag := s.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(call.Args[0], *udiag)
+	}
+	ty := typed.Type()
+	slice, ok := ty.Base().(*SliceType)
+	if !ok {
+		return nil, DiagFromAST(call.Args[0], "First argument to append must be a slice, but found type %s.", ty.String())
+	}
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	ptr, length, capacity := block.splitSlice(typed.LLVM())
+
+	// the arguments are all evaluated before anything is appended.
+	var spreadPtr, spreadLen llvm.Value
+	elems := make([]TypedValue, 0)
+	if call.Ellipsis.IsValid() {
+		if len(call.Args) != 2 {
+			return nil, DiagFromAST(call, "Can only use ... with a single slice to append.")
+		}
+		spreadPtr, spreadLen, diag = block.translateSpread(call.Args[1], slice)
+		if diag != nil {
+			return nil, diag
+		}
+	} else {
+		for _, arg := range call.Args[1:] {
+			elem, diag := block.translateElement(arg, slice.Elem)
+			if diag != nil {
+				return nil, diag
+			}
+			elems = append(elems, elem)
+		}
+		spreadLen = llvm.ConstInt(intTy.LLVM(), uint64(len(elems)), false)
+	}
+
+	newLen := block.Builder.BuildAdd(length, spreadLen, "")
+	newCapPtr := block.buildAlloca(intTy.LLVM(), "append.cap")
+	mem := block.buildRuntimeCall("gogo_slice_grow", block.buildBytePtr(ptr), length, capacity, newLen, block.elemSize(slice), newCapPtr)
+	newPtr := block.Builder.BuildBitCast(mem, ptr.Type(), "")
+	newCap := block.Builder.BuildLoad(newCapPtr, "")
+
+	dst := block.Builder.BuildGEP(newPtr, []llvm.Value{length}, "")
+	if call.Ellipsis.IsValid() {
+		size := block.Builder.BuildMul(spreadLen, block.elemSize(slice), "")
+		block.buildRuntimeCall("gogo_memmove", block.buildBytePtr(dst), block.buildBytePtr(spreadPtr), size)
+	}
+	for i, elem := range elems {
+		offset := llvm.ConstInt(intTy.LLVM(), uint64(i), false)
+		elemPtr := block.Builder.BuildGEP(dst, []llvm.Value{offset}, "")
+		buildStoreValue(block.Builder, slice.Elem, elem.LLVM(), elemPtr)
+	}
+	return &Register{ty, block.buildSlice(ty, newPtr, newLen, newCap)}, nil
+}
+
+/*
+ * translateSpread translates the source of `append(s, t...)` or `copy(s, t)`,
+ * returning a pointer to its elements and how many there are. As in Go, a
+ * string can stand in for a []byte.
+ */
+func (block *Block) translateSpread(expr ast.Expr, dst *SliceType) (llvm.Value, llvm.Value, *GoDiag) {
+	val, diag := block.translateOperand(expr)
+	if diag != nil {
+		return llvm.Value{}, llvm.Value{}, diag
+	}
+	typed, udiag := val.RValue(nil)
+	if udiag != nil {
+		return llvm.Value{}, llvm.Value{}, BindDiagToAST(expr, *udiag)
+	}
+	switch src := typed.Type().Base().(type) {
+	case *SliceType:
+		if src.Elem.Eq(dst.Elem) {
+			ptr, length, _ := block.splitSlice(typed.LLVM())
+			return ptr, length, nil
+		}
+	case *StringType:
+		if elemTy, ok := dst.Elem.Base().(*IntType); ok && elemTy.Type == BLTN_TY_UINT8 {
+			ptr, length := block.splitString(typed.LLVM())
+			return ptr, length, nil
+		}
+	}
+	return llvm.Value{}, llvm.Value{}, DiagFromAST(expr, "Cannot use a value of type %s as %s.", typed.Type().String(), dst.String())
+}
+
+// translates `copy(dst, src)`, which copies as many elements as both have.
+func (block *Block) translateCopyBuiltin(call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	if diag := checkArgCount(call, "copy", 2); diag != nil {
+		return nil, diag
+	}
+	d, diag := block.translateOperand(call.Args[0])
+	if diag != nil {
+		return nil, diag
+	}
+	dst, udiag := d.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(call.Args[0], *udiag)
+	}
+	slice, ok := dst.Type().Base().(*SliceType)
+	if !ok {
+		return nil, DiagFromAST(call.Args[0], "First argument to copy must be a slice, but found type %s.", dst.Type().String())
+	}
+	srcPtr, srcLen, diag := block.translateSpread(call.Args[1], slice)
+	if diag != nil {
+		return nil, diag
+	}
+
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	dstPtr, dstLen, _ := block.splitSlice(dst.LLVM())
+	shorter := block.Builder.BuildICmp(llvm.IntSLT, dstLen, srcLen, "")
+	n := block.Builder.BuildSelect(shorter, dstLen, srcLen, "")
+	size := block.Builder.BuildMul(n, block.elemSize(slice), "")
+	block.buildRuntimeCall("gogo_memmove", block.buildBytePtr(dstPtr), block.buildBytePtr(srcPtr), size)
+	return &Register{intTy, n}, nil
+}
+
+/*
+ * A slice literal is an array literal whose elements are put on the heap,
+ * with the slice referring to all of them.
+ */
+func (block *Block) translateSliceLit(lit *ast.CompositeLit, ty Type, slice *SliceType) (UntypedValue, *GoDiag) {
+	arr, diag := block.translateArrayLit(lit, nil, slice.Elem, -1)
+	if diag != nil {
+		return nil, diag
+	}
+	arrTy := arr.(*Register).Ty
+	arrLen := llvm.ConstInt(global_type_factory.IntType(BLTN_TY_INT).LLVM(), uint64(arrTy.(*ArrayType).Len), false)
+	mem := block.buildRuntimeCall("gogo_make_slice", block.elemSize(slice), arrLen, arrLen)
+	arrPtr := block.Builder.BuildBitCast(mem, llvm.PointerType(arrTy.LLVM(), 0), "")
+	block.Builder.BuildStore(arr.(*Register).Val, arrPtr)
+	ptr := block.Builder.BuildBitCast(mem, llvm.PointerType(MemLLVM(slice.Elem), 0), "")
+	return &Register{ty, block.buildSlice(ty, ptr, arrLen, arrLen)}, nil
+}
+
+/*
+ * buildSliceToArray converts the slice `val` to `ty`, an array or a pointer to
+ * an array with the same element type, or returns nil if `ty` is neither. The
+ * slice must have at least as many elements as the array; the pointer refers
+ * to them, while the array is a copy.
+ */
+func (block *Block) buildSliceToArray(val TypedValue, ty Type) TypedValue {
+	slice := underlying(val.Type()).(*SliceType)
+	arrTy := ty
+	ptrTy, isPtr := underlying(ty).(*PointerType)
+	if isPtr {
+		arrTy = ptrTy.At
+	}
+	arr, ok := underlying(arrTy).(*ArrayType)
+	if !ok || !arr.Elem.Eq(slice.Elem) {
+		return nil
+	}
+
+	ptr, length, _ := block.splitSlice(val.LLVM())
+	arrLen := llvm.ConstInt(global_type_factory.IntType(BLTN_TY_INT).LLVM(), uint64(arr.Len), false)
+	short := block.Builder.BuildICmp(llvm.IntSLT, length, arrLen, "")
+	block.buildRuntimeCheck(short, block.Trans.runtimeFunction("gogo_panic_slice_convert"), length, arrLen)
+	if isPtr {
+		return &Register{ty, block.Builder.BuildBitCast(ptr, ty.LLVM(), "")}
+	}
+	if arr.Len == 0 {
+		// a nil slice has no elements to load.
+		return ty.Zero(block.Trans.LLns)
+	}
+	arrPtr := block.Builder.BuildBitCast(ptr, llvm.PointerType(MemLLVM(ty), 0), "")
+	return &Register{ty, buildLoadValue(block.Builder, ty, arrPtr)}
+}
@@ -0,0 +1,112 @@
+package main
+
+import "go/token"
+import "llvm"
+import "math/big"
+import "unicode"
+
+// builds the string { ptr, len } of type `ty`.
+func (block *Block) buildString(ty Type, ptr llvm.Value, length llvm.Value) llvm.Value {
+	agg := llvm.Undef(ty.LLVM())
+	agg = block.Builder.BuildInsertValue(agg, ptr, 0, "")
+	return block.Builder.BuildInsertValue(agg, length, 1, "")
+}
+
+// splits a string into the pointer to its bytes and its length.
+func (block *Block) splitString(val llvm.Value) (llvm.Value, llvm.Value) {
+	ptr := block.Builder.BuildExtractValue(val, 0, "")
+	length := block.Builder.BuildExtractValue(val, 1, "")
+	return ptr, length
+}
+
+// builds `x + y` on strings, which always makes a new string.
+func (block *Block) buildStringConcat(x TypedValue, y TypedValue) TypedValue {
+	xPtr, xLen := block.splitString(x.LLVM())
+	yPtr, yLen := block.splitString(y.LLVM())
+	ptr := block.buildRuntimeCall("gogo_string_concat", xPtr, xLen, yPtr, yLen)
+	length := block.Builder.BuildAdd(xLen, yLen, "")
+	return &Register{x.Type(), block.buildString(x.Type(), ptr, length)}
+}
+
+// builds the comparison `x op y` on strings, which compare bytewise.
+func (block *Block) buildStringCompare(op token.Token, x TypedValue, y TypedValue) llvm.Value {
+	xPtr, xLen := block.splitString(x.LLVM())
+	yPtr, yLen := block.splitString(y.LLVM())
+	cmp := block.buildRuntimeCall("gogo_string_compare", xPtr, xLen, yPtr, yLen)
+	zero := llvm.ConstInt(global_type_factory.IntType(BLTN_TY_INT).LLVM(), 0, false)
+	return block.Builder.BuildICmp(intPredicate(op, true), cmp, zero, "")
+}
+
+func isStringType(ty Type) bool {
+	_, ok := ty.Base().(*StringType)
+	return ok
+}
+
+// the UTF-8 encoding of the rune `r`, or of U+FFFD if it isn't a valid one.
+func runeString(r *big.Int) string {
+	if !r.IsInt64() || r.Int64() < 0 || r.Int64() > unicode.MaxRune {
+		return string(unicode.ReplacementChar)
+	}
+	return string(rune(r.Int64()))
+}
+
+/*
+ * buildRuneToString converts the integer `val`, of type `src`, to the string
+ * holding its UTF-8 encoding. Integers that aren't valid runes, including
+ * those too big for a rune, become "\uFFFD".
+ */
+func (block *Block) buildRuneToString(val TypedValue, src *IntType, ty Type) TypedValue {
+	builder := block.Builder
+	int64Ty := global_type_factory.IntType(BLTN_TY_INT64).(*IntType)
+	runeTy := global_type_factory.IntType(BLTN_TY_INT32)
+	wide := block.buildIntResize(val.LLVM(), src, int64Ty)
+	// negative values look huge, unsigned, so one comparison catches them too.
+	valid := builder.BuildICmp(llvm.IntULE, wide, llvm.ConstInt(int64Ty.LLVM(), unicode.MaxRune, false), "")
+	r := builder.BuildSelect(valid, builder.BuildTrunc(wide, runeTy.LLVM(), ""), llvm.ConstInt(runeTy.LLVM(), unicode.ReplacementChar, false), "")
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	lenPtr := block.buildAlloca(intTy.LLVM(), "str.len")
+	bytes := block.buildRuntimeCall("gogo_rune_to_string", r, lenPtr)
+	return &Register{ty, block.buildString(ty, bytes, builder.BuildLoad(lenPtr, ""))}
+}
+
+/*
+ * Converting a string to []byte or []int32 (i.e. []rune) always makes a copy,
+ * since strings are immutable and slices aren't.
+ */
+func (block *Block) buildStringToSlice(val TypedValue, dst *SliceType, ty Type) (TypedValue, *UDiag) {
+	ptr, length := block.splitString(val.LLVM())
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	if elemTy, ok := dst.Elem.Base().(*IntType); ok {
+		switch elemTy.Type {
+		case BLTN_TY_UINT8:
+			bytes := block.buildRuntimeCall("gogo_bytes_dup", ptr, length)
+			return &Register{ty, block.buildSlice(ty, bytes, length, length)}, nil
+		case BLTN_TY_INT32:
+			countPtr := block.buildAlloca(intTy.LLVM(), "runes.len")
+			runes := block.buildRuntimeCall("gogo_string_to_runes", ptr, length, countPtr)
+			count := block.Builder.BuildLoad(countPtr, "")
+			return &Register{ty, block.buildSlice(ty, runes, count, count)}, nil
+		}
+	}
+	udiag := UDiag("Cannot convert a value of type " + val.Type().String() + " to type " + ty.String() + ".")
+	return nil, &udiag
+}
+
+// converts []byte or []int32 (i.e. []rune) to a string, copying the contents.
+func (block *Block) buildSliceToString(val TypedValue, src *SliceType, ty Type) (TypedValue, *UDiag) {
+	ptr, length, _ := block.splitSlice(val.LLVM())
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	if elemTy, ok := src.Elem.Base().(*IntType); ok {
+		switch elemTy.Type {
+		case BLTN_TY_UINT8:
+			bytes := block.buildRuntimeCall("gogo_bytes_dup", ptr, length)
+			return &Register{ty, block.buildString(ty, bytes, length)}, nil
+		case BLTN_TY_INT32:
+			lenPtr := block.buildAlloca(intTy.LLVM(), "str.len")
+			bytes := block.buildRuntimeCall("gogo_runes_to_string", ptr, length, lenPtr)
+			return &Register{ty, block.buildString(ty, bytes, block.Builder.BuildLoad(lenPtr, ""))}, nil
+		}
+	}
+	udiag := UDiag("Cannot convert a value of type " + val.Type().String() + " to type " + ty.String() + ".")
+	return nil, &udiag
+}
@@ -0,0 +1,170 @@
+package main
+
+import "go/ast"
+import "go/token"
+import "llvm"
+
+// translates a struct type expression, e.g. `struct { x, y int }`.
+func (trans *Translator) translateStructType(scope *Scope, expr *ast.StructType) (Type, *GoDiag) {
+	fields := make([]StructField, 0)
+	seen := make(map[string]bool)
+	for _, field := range expr.Fields.List {
+		if len(field.Names) == 0 {
+			return nil, DiagFromAST(field, "Embedded fields are not supported yet.")
+		}
+		ty, diag := trans.translateType(scope, field.Type)
+		if diag != nil {
+			return nil, diag
+		}
+		for _, name := range field.Names {
+			if seen[name.Name] {
+				return nil, DiagFromAST(name, "Duplicate field \"%s\".", name.Name)
+			}
+			if name.Name != "_" {
+				seen[name.Name] = true
+			}
+			fields = append(fields, StructField{name.Name, ty})
+		}
+	}
+	return &StructType{fields}, nil
+}
+
+/*
+ * translateSelectorExpr translates `x.f`. Fields of addressable structs, and
+ * of structs reached through a pointer, are themselves addressable, so those
+ * are returned as Variables.
+ */
+func (block *Block) translateSelectorExpr(expr *ast.SelectorExpr) (UntypedValue, *GoDiag) {
+	if pkg := packageOf(block.Scope, expr.X); pkg != nil {
+		return pkg.selectMember(expr)
+	}
+	x, diag := block.translateOperand(expr.X)
+	if diag != nil {
+		return nil, diag
+	}
+	method, diag := block.selectMethod(expr, x)
+	if method != nil || diag != nil {
+		return method, diag
+	}
+	if variable, ok := x.(*Variable); ok {
+		if st, ok := variable.Ty.Base().(*StructType); ok {
+			return block.buildFieldPtr(expr, variable.Ptr, variable.Ty, st)
+		}
+	}
+
+	typed, udiag := x.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr.X, *udiag)
+	}
+	switch base := typed.Type().Base().(type) {
+	case *StructType:
+		idx, diag := fieldIndex(expr, typed.Type(), base)
+		if diag != nil {
+			return nil, diag
+		}
+		fieldTy := base.Fields[idx].Ty
+		field := block.Builder.BuildExtractValue(typed.LLVM(), uint(idx), "")
+		return &Register{fieldTy, buildFromMem(block.Builder, fieldTy, field)}, nil
+	case *PointerType:
+		// `p.f` is shorthand for `(*p).f`.
+		if st, ok := base.At.Base().(*StructType); ok {
+			block.buildNilCheck(typed.LLVM())
+			return block.buildFieldPtr(expr, typed.LLVM(), typed.Type(), st)
+		}
+	}
+	return nil, DiagFromAST(expr, "A value of type %s has no field or method %s.", typed.Type().String(), expr.Sel.Name)
+}
+
+// returns the field of the struct at `ptr` that `expr` selects, as a Variable.
+func (block *Block) buildFieldPtr(expr *ast.SelectorExpr, ptr llvm.Value, ty Type, st *StructType) (*Variable, *GoDiag) {
+	idx, diag := fieldIndex(expr, ty, st)
+	if diag != nil {
+		return nil, diag
+	}
+	int32Ty := llvm.IntType(32)
+	indices := []llvm.Value{llvm.ConstInt(int32Ty, 0, false), llvm.ConstInt(int32Ty, uint64(idx), false)}
+	fieldPtr := block.Builder.BuildInBoundsGEP(ptr, indices, "")
+	return &Variable{st.Fields[idx].Ty, fieldPtr, block.Builder}, nil
+}
+
+func fieldIndex(expr *ast.SelectorExpr, ty Type, st *StructType) (int, *GoDiag) {
+	idx := st.FieldIndex(expr.Sel.Name)
+	if idx < 0 {
+		return -1, DiagFromAST(expr.Sel, "Type %s has no field %s.", ty.String(), expr.Sel.Name)
+	}
+	return idx, nil
+}
+
+/*
+ * translateStructLit builds a struct literal. Either every field is given in
+ * order, as in `Point{1, 2}`, or fields are named, as in `Point{y: 2}`, and
+ * the ones left out are zero.
+ */
+func (block *Block) translateStructLit(lit *ast.CompositeLit, ty Type, st *StructType) (UntypedValue, *GoDiag) {
+	agg := llvm.ConstNull(ty.LLVM())
+	if len(lit.Elts) == 0 {
+		return &Register{ty, agg}, nil
+	}
+	_, keyed := lit.Elts[0].(*ast.KeyValueExpr)
+	if !keyed && len(lit.Elts) != len(st.Fields) {
+		return nil, DiagFromAST(lit, "Struct literal of type %s needs %d values, but has %d.", ty.String(), len(st.Fields), len(lit.Elts))
+	}
+
+	seen := make(map[int]bool)
+	for i, elt := range lit.Elts {
+		kv, isKV := elt.(*ast.KeyValueExpr)
+		if isKV != keyed {
+			return nil, DiagFromAST(elt, "Cannot mix field names and positional values in a struct literal.")
+		}
+		idx := i
+		valueExpr := elt
+		if keyed {
+			name, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				return nil, DiagFromAST(kv.Key, "Expected a field name in struct literal.")
+			}
+			idx = st.FieldIndex(name.Name)
+			if idx < 0 {
+				return nil, DiagFromAST(kv.Key, "Type %s has no field %s.", ty.String(), name.Name)
+			}
+			if seen[idx] {
+				return nil, DiagFromAST(kv.Key, "Duplicate field %s in struct literal.", name.Name)
+			}
+			seen[idx] = true
+			valueExpr = kv.Value
+		}
+		fieldTy := st.Fields[idx].Ty
+		val, diag := block.translateElement(valueExpr, fieldTy)
+		if diag != nil {
+			return nil, diag
+		}
+		agg = block.Builder.BuildInsertValue(agg, buildToMem(block.Builder, fieldTy, val.LLVM()), uint(idx), "")
+	}
+	return &Register{ty, agg}, nil
+}
+
+/*
+ * builds `x == y` or `x != y` on structs, which are equal when all of their
+ * fields (other than blank ones) are.
+ */
+func (block *Block) buildStructEq(expr *ast.BinaryExpr, st *StructType, x TypedValue, y TypedValue) (TypedValue, *GoDiag) {
+	boolTy := global_type_factory.BoolType()
+	equal := llvm.ConstInt(boolTy.LLVM(), 1, false)
+	fieldExpr := &ast.BinaryExpr{X: expr.X, OpPos: expr.OpPos, Op: token.EQL, Y: expr.Y}
+	for i, field := range st.Fields {
+		if field.Name == "_" {
+			continue
+		}
+		xField := buildFromMem(block.Builder, field.Ty, block.Builder.BuildExtractValue(x.LLVM(), uint(i), ""))
+		yField := buildFromMem(block.Builder, field.Ty, block.Builder.BuildExtractValue(y.LLVM(), uint(i), ""))
+		cmp, diag := block.buildComparison(fieldExpr, &Register{field.Ty, xField}, &Register{field.Ty, yField})
+		if diag != nil {
+			return nil, DiagFromAST(expr, "Cannot compare values of type %s: field %s has type %s.", x.Type().String(), field.Name, field.Ty.String())
+		}
+		equal = block.Builder.BuildAnd(equal, cmp.LLVM(), "")
+	}
+	if expr.Op == token.NEQ {
+		equal = block.Builder.BuildNot(equal, "")
+	}
+	return &Register{boolTy, equal}, nil
+}
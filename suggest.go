@@ -0,0 +1,148 @@
+package main
+
+import "fmt"
+import "sort"
+import "strings"
+import "unicode"
+import "unicode/utf8"
+
+/*
+ * editDistance computes the Levenshtein distance between `a` and `b`, counted
+ * in runes.
+ */
+func editDistance(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func isExported(name string) bool {
+	first, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(first)
+}
+
+/*
+ * closestName picks the candidate closest to `name`, or "" if nothing is close
+ * enough to be worth suggesting. A candidate differing only in case always
+ * wins; otherwise we allow roughly one edit per three characters.
+ */
+func closestName(name string, candidates []string) string {
+	// sort first, so that ties are broken the same way on every run.
+	sort.Strings(candidates)
+
+	best := ""
+	bestDist := utf8.RuneCountInString(name)/3 + 1
+	for _, cand := range candidates {
+		if cand == name || cand == "_" {
+			continue
+		}
+		if strings.EqualFold(cand, name) {
+			return cand
+		}
+		dist := editDistance(name, cand)
+		if dist < bestDist {
+			best = cand
+			bestDist = dist
+		}
+	}
+	return best
+}
+
+func suggestionHint(name string, cand string) string {
+	if cand == "" {
+		return ""
+	}
+	if strings.EqualFold(cand, name) && isExported(name) && !isExported(cand) {
+		return fmt.Sprintf("Did you mean \"%s\"? Identifiers are case-sensitive, and \"%s\" is unexported.", cand, cand)
+	}
+	if strings.EqualFold(cand, name) {
+		return fmt.Sprintf("Did you mean \"%s\"? Identifiers are case-sensitive.", cand)
+	}
+	return fmt.Sprintf("Did you mean \"%s\"?", cand)
+}
+
+// collects every value name visible from `scope`, predeclared names included.
+func (scope *Scope) valueNames() []string {
+	names := make([]string, 0)
+	for targetScope := scope; targetScope != nil; targetScope = targetScope.Parent {
+		for name := range *targetScope.Values {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// collects every type name visible from `scope`, predeclared names included.
+func (scope *Scope) typeNames() []string {
+	names := make([]string, 0)
+	for targetScope := scope; targetScope != nil; targetScope = targetScope.Parent {
+		for name := range *targetScope.Types {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+/*
+ * Returns a "did you mean" hint for the unknown value `name`, or "" if there is
+ * no plausible candidate.
+ */
+func (scope *Scope) suggestValue(name string) string {
+	return suggestionHint(name, closestName(name, scope.valueNames()))
+}
+
+/*
+ * Returns a "did you mean" hint for the unknown type `name`, or "" if there is
+ * no plausible candidate.
+ */
+func (scope *Scope) suggestType(name string) string {
+	return suggestionHint(name, closestName(name, scope.typeNames()))
+}
+
+/*
+ * Returns a "did you mean" hint for `pkg.name`, which isn't a member of the
+ * package, or "" if there is no plausible candidate. Functions and types are
+ * both candidates: either may be misspelled where the other was expected.
+ */
+func (pkg *Package) suggestMember(name string) string {
+	names := make([]string, 0, len(pkg.Funcs)+len(pkg.Types))
+	for member := range pkg.Funcs {
+		names = append(names, member)
+	}
+	for member := range pkg.Types {
+		names = append(names, member)
+	}
+	return suggestionHint(name, closestName(name, names))
+}
+
+// like suggestMember, but for a name used as a type.
+func (pkg *Package) suggestType(name string) string {
+	names := make([]string, 0, len(pkg.Types))
+	for member := range pkg.Types {
+		names = append(names, member)
+	}
+	return suggestionHint(name, closestName(name, names))
+}
@@ -0,0 +1,99 @@
+package main
+
+import "testing"
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		dist int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"count", "count", 0},
+		{"cout", "count", 1},
+		{"Pont", "Point", 1},
+		{"kitten", "sitting", 3},
+		// a transposition is two edits, not one.
+		{"flaot64", "float64", 2},
+		// distances are counted in runes, not bytes.
+		{"héllo", "hello", 1},
+		{"日本", "日本語", 1},
+	}
+	for _, c := range cases {
+		if dist := editDistance(c.a, c.b); dist != c.dist {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", c.a, c.b, dist, c.dist)
+		}
+	}
+}
+
+func TestClosestName(t *testing.T) {
+	cases := []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		// one edit is within the threshold for a four-letter name.
+		{"cout", []string{"count", "main"}, "count"},
+		// a case-only difference wins over a closer spelling.
+		{"total", []string{"atotal", "toTAL"}, "toTAL"},
+		{"SizeOf", []string{"Sizeof", "Alignof"}, "Sizeof"},
+		// len/3+1: six letters allow at most two edits...
+		{"abcdef", []string{"abcdxy"}, "abcdxy"},
+		// ...but not three.
+		{"abcdef", []string{"abcxyz"}, ""},
+		// ...and a two-letter name allows none.
+		{"ab", []string{"ax"}, ""},
+		// the name itself and the blank identifier are never suggested.
+		{"count", []string{"count", "_"}, ""},
+		{"__", []string{"_"}, ""},
+		// nothing close.
+		{"zzz", []string{"count", "Point", "float64"}, ""},
+		{"count", []string{}, ""},
+		// ties are broken alphabetically, whatever order we were given.
+		{"cat", []string{"cut", "bat"}, "bat"},
+		{"cat", []string{"bat", "cut"}, "bat"},
+	}
+	for _, c := range cases {
+		if got := closestName(c.name, c.candidates); got != c.want {
+			t.Errorf("closestName(%q, %v) = %q, want %q", c.name, c.candidates, got, c.want)
+		}
+	}
+}
+
+func TestSuggestionHint(t *testing.T) {
+	cases := []struct {
+		name, cand, want string
+	}{
+		{"cout", "", ""},
+		{"cout", "count", "Did you mean \"count\"?"},
+		{"total", "Total", "Did you mean \"Total\"? Identifiers are case-sensitive."},
+		{"Total", "total", "Did you mean \"total\"? Identifiers are case-sensitive, and \"total\" is unexported."},
+	}
+	for _, c := range cases {
+		if got := suggestionHint(c.name, c.cand); got != c.want {
+			t.Errorf("suggestionHint(%q, %q) = %q, want %q", c.name, c.cand, got, c.want)
+		}
+	}
+}
+
+func TestSuggestPackageMember(t *testing.T) {
+	pkg := createUnsafePackage()
+	cases := []struct {
+		name, member, typ string
+	}{
+		{"SizeOf", "Did you mean \"Sizeof\"? Identifiers are case-sensitive.", ""},
+		{"Ponter", "Did you mean \"Pointer\"?", "Did you mean \"Pointer\"?"},
+		// a function is no help where a type was expected.
+		{"Slise", "Did you mean \"Slice\"?", ""},
+		{"Frobnicate", "", ""},
+	}
+	for _, c := range cases {
+		if got := pkg.suggestMember(c.name); got != c.member {
+			t.Errorf("suggestMember(%q) = %q, want %q", c.name, got, c.member)
+		}
+		if got := pkg.suggestType(c.name); got != c.typ {
+			t.Errorf("suggestType(%q) = %q, want %q", c.name, got, c.typ)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
+import "fmt"
 import "llvm"
+import "runtime"
+import "strings"
+import "sync"
 
 type Target struct {
 	DataLayout string
@@ -8,32 +12,127 @@ type Target struct {
 	Data       llvm.TargetData
 }
 
-func CreateNativeTarget() Target {
-	targets := map[string]map[string]Target{
-		"Darwin": {
-			"i686": Target{
-				"e-p:32:32:32-i1:8:8-i8:8:8-i16:16:16-i32:32:32-i64:32:64-f32:32:32-f64:32:64-v64:64:64-v128:128:128-a0:0:64-f80:128:128-n8:16:32-S128",
-				"i686-apple-darwin",
-				llvm.TargetData{nil},
-			},
-			"x86_64": Target{
-				"e-p:64:64:64-i1:8:8-i8:8:8-i16:16:16-i32:32:32-i64:64:64-f32:32:32-f64:64:64-v64:64:64-v128:128:128-a0:0:64-s0:64:64-f80:128:128-n8:16:32:64-S128",
-				"x86_64-apple-darwin",
-				llvm.TargetData{nil},
-			},
-		},
+// maps Go's GOOS/GOARCH names onto the LLVM triples we know how to target.
+var goTriples = map[string]map[string]string{
+	"darwin": {
+		"386":   "i686-apple-darwin",
+		"amd64": "x86_64-apple-darwin",
+		"arm64": "arm64-apple-darwin",
+	},
+	"linux": {
+		"386":     "i686-unknown-linux-gnu",
+		"amd64":   "x86_64-unknown-linux-gnu",
+		"arm":     "armv7-unknown-linux-gnueabihf",
+		"arm64":   "aarch64-unknown-linux-gnu",
+		"ppc64le": "powerpc64le-unknown-linux-gnu",
+		"riscv64": "riscv64-unknown-linux-gnu",
+	},
+	"wasip1": {
+		"wasm": "wasm32-wasi",
+	},
+}
+
+var initTargetsOnce sync.Once
+
+func initTargets() {
+	initTargetsOnce.Do(func() {
+		llvm.InitializeAllTargetInfos()
+		llvm.InitializeAllTargets()
+		llvm.InitializeAllTargetMCs()
+	})
+}
+
+/*
+ * Maps a GOOS/GOARCH pair onto an LLVM triple. Empty strings stand for the
+ * host's own OS or architecture, as they do for the go tool.
+ */
+func TripleForGo(goos string, goarch string) (string, Diag) {
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+	triple, ok := goTriples[goos][goarch]
+	if !ok {
+		diag := GenError(fmt.Sprintf("Unsupported GOOS/GOARCH pair %s/%s.", goos, goarch))
+		return "", &diag
 	}
+	return triple, nil
+}
+
+/*
+ * Returns the triple for the machine gogo is running on. This comes from the
+ * Go runtime rather than `uname`, so it doesn't depend on external commands.
+ */
+func HostTriple() (string, Diag) {
+	return TripleForGo(runtime.GOOS, runtime.GOARCH)
+}
+
+/*
+ * CreateTarget asks LLVM for a target machine matching `triple`, and uses it
+ * to derive the data layout, so that we never disagree with the code generator
+ * about type sizes and alignment.
+ */
+func CreateTarget(triple string) (Target, Diag) {
+	initTargets()
+	llTarget, err := llvm.GetTargetFromTriple(triple)
+	if err != nil {
+		diag := GenError(fmt.Sprintf("Unable to find target \"%s\": %s", triple, err.Error()))
+		return Target{}, &diag
+	}
+	machine := llTarget.CreateTargetMachine(triple, "", "", llvm.CodeGenLevelDefault, llvm.RelocDefault, llvm.CodeModelDefault)
+	data := machine.CreateTargetData()
+	machine.Dispose()
+	return Target{data.String(), triple, data}, nil
+}
 
-	os, _, arch := Uname()
-	tar := targets[os][arch]
-	tar.Data = llvm.CreateTargetData(tar.DataLayout)
-	return tar
+func CreateNativeTarget() (Target, Diag) {
+	triple, diag := HostTriple()
+	if diag != nil {
+		return Target{}, diag
+	}
+	return CreateTarget(triple)
 }
 
 func (tar Target) DisposeTarget() {
 	tar.Data.Dispose()
 }
 
+// the size of a pointer (and so of int, uint and uintptr) in bits.
 func (tar Target) WordSize() uint {
-	return tar.Data.PointerSize()
+	return tar.Data.PointerSize() * 8
+}
+
+// the number of bytes a value of type `ty` takes up in memory, padding included.
+func (tar Target) AllocSize(ty llvm.Type) uint64 {
+	return tar.Data.TypeAllocSize(ty)
+}
+
+// the offset in bytes of element `i` of the LLVM struct type `ty`.
+func (tar Target) FieldOffset(ty llvm.Type, i int) uint64 {
+	return tar.Data.ElementOffset(ty, i)
+}
+
+func (tar Target) IsWasm() bool {
+	return strings.HasPrefix(tar.Triple, "wasm32") || strings.HasPrefix(tar.Triple, "wasm64")
+}
+
+/*
+ * The relocation model objects are built with. Native toolchains default to
+ * position-independent executables nowadays; wasm-ld wants static objects.
+ */
+func (tar Target) RelocModel() string {
+	if tar.IsWasm() {
+		return "static"
+	}
+	return "pic"
+}
+
+// the file name the linker should produce for an executable called `base`.
+func (tar Target) ExecutableName(base string) string {
+	if tar.IsWasm() {
+		return base + ".wasm"
+	}
+	return base
 }
@@ -0,0 +1,197 @@
+package main
+
+import "os"
+import "os/exec"
+import "path/filepath"
+import "strings"
+import "testing"
+
+/*
+ * compileToIR runs `src` through the goc stage for `triple`, and returns the
+ * textual IR it produced. The bitcode is disassembled with llvm-dis; the test
+ * is skipped if that isn't installed.
+ */
+func compileToIR(t *testing.T, triple string, src string) string {
+	disasm, err := exec.LookPath("llvm-dis")
+	if err != nil {
+		t.Skip("llvm-dis not found")
+	}
+	target, diag := CreateTarget(triple)
+	if diag != nil {
+		t.Fatalf("CreateTarget(%q): %s", triple, diag.Msg())
+	}
+	defer target.DisposeTarget()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.go")
+	output := filepath.Join(dir, "test.bc")
+	if err := os.WriteFile(input, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if diag := CreateGocStage(input, output, target).Run(); diag != nil {
+		t.Fatalf("compiling for %s: %s", triple, diag.Msg())
+	}
+	ir, err := exec.Command(disasm, "-o", "-", output).Output()
+	if err != nil {
+		t.Fatalf("llvm-dis: %s", err)
+	}
+	return string(ir)
+}
+
+// the line of `ir` defining the function `name`.
+func definition(t *testing.T, ir string, name string) string {
+	for _, line := range strings.Split(ir, "\n") {
+		if strings.HasPrefix(line, "define ") && strings.Contains(line, "@"+name+"(") {
+			return line
+		}
+	}
+	t.Fatalf("no definition of @%s in:\n%s", name, ir)
+	return ""
+}
+
+const wordSizeSrc = `package main
+
+import "unsafe"
+
+func words(a int, b uint, c uintptr) int {
+	return a + int(b) + int(c)
+}
+
+func size() uintptr {
+	var x int
+	return unsafe.Sizeof(x)
+}
+
+func main() {
+}
+`
+
+func TestWordSizedTypes(t *testing.T) {
+	cases := []struct {
+		goos, goarch string
+		word         string
+		size         string
+	}{
+		{"linux", "386", "i32", "4"},
+		{"linux", "arm", "i32", "4"},
+		{"wasip1", "wasm", "i32", "4"},
+		{"linux", "amd64", "i64", "8"},
+	}
+	for _, c := range cases {
+		triple, diag := TripleForGo(c.goos, c.goarch)
+		if diag != nil {
+			t.Fatalf("TripleForGo(%q, %q): %s", c.goos, c.goarch, diag.Msg())
+		}
+		ir := compileToIR(t, triple, wordSizeSrc)
+		if !strings.Contains(ir, "target triple = \""+triple+"\"") {
+			t.Errorf("%s: module isn't targeting %s", triple, triple)
+		}
+		// int, uint and uintptr all take the target's word size.
+		words := definition(t, ir, "words")
+		want := c.word + " @words(" + c.word
+		if !strings.Contains(words, want) || strings.Count(words, c.word) != 4 {
+			t.Errorf("%s: want int, uint and uintptr as %s, got %q", triple, c.word, words)
+		}
+		// and so does the data layout the sizes are folded with.
+		size := definition(t, ir, "size")
+		if !strings.HasPrefix(size, "define "+c.word+" @size(") {
+			t.Errorf("%s: want uintptr as %s, got %q", triple, c.word, size)
+		}
+		if !strings.Contains(ir, "ret "+c.word+" "+c.size) {
+			t.Errorf("%s: want unsafe.Sizeof(int) to be %s in:\n%s", triple, c.size, ir)
+		}
+	}
+}
+
+func TestSelectTriple(t *testing.T) {
+	t.Setenv("GOOS", "linux")
+	t.Setenv("GOARCH", "386")
+	// an explicit -target wins over the environment.
+	if triple, diag := selectTriple("armv7-unknown-linux-gnueabihf"); diag != nil || triple != "armv7-unknown-linux-gnueabihf" {
+		t.Errorf("selectTriple with -target: got %q", triple)
+	}
+	if triple, diag := selectTriple(""); diag != nil || triple != "i686-unknown-linux-gnu" {
+		t.Errorf("selectTriple with GOOS/GOARCH: got %q", triple)
+	}
+	t.Setenv("GOARCH", "mips")
+	if _, diag := selectTriple(""); diag == nil {
+		t.Errorf("selectTriple accepted linux/mips")
+	}
+}
+
+func TestWasmTarget(t *testing.T) {
+	triple, diag := TripleForGo("wasip1", "wasm")
+	if diag != nil || triple != "wasm32-wasi" {
+		t.Fatalf("TripleForGo(wasip1, wasm) = %q", triple)
+	}
+	if _, diag := TripleForGo("wasip1", "amd64"); diag == nil {
+		t.Errorf("TripleForGo accepted wasip1/amd64")
+	}
+
+	cases := []struct {
+		triple string
+		wasm   bool
+		reloc  string
+		exe    string
+		linker string
+	}{
+		{"wasm32-wasi", true, "static", "test.wasm", "wasm-ld"},
+		{"x86_64-unknown-linux-gnu", false, "pic", "test", "clang"},
+	}
+	for _, c := range cases {
+		target := Target{Triple: c.triple}
+		if target.IsWasm() != c.wasm {
+			t.Errorf("%s: IsWasm() = %v", c.triple, target.IsWasm())
+		}
+		if reloc := target.RelocModel(); reloc != c.reloc {
+			t.Errorf("%s: RelocModel() = %q, want %q", c.triple, reloc, c.reloc)
+		}
+		if exe := target.ExecutableName("test"); exe != c.exe {
+			t.Errorf("%s: ExecutableName(test) = %q, want %q", c.triple, exe, c.exe)
+		}
+		llc := CreateLLCStage("test.bc", "test.o", target)
+		args := strings.Join(llc.Args, " ")
+		if !strings.Contains(args, "-mtriple="+c.triple) || !strings.Contains(args, "-relocation-model="+c.reloc) {
+			t.Errorf("%s: llc %s", c.triple, args)
+		}
+		link := CreateLinkStage([]string{"rt.o", "test.o"}, c.exe, target)
+		if link.Cmd != c.linker || link.Args[len(link.Args)-1] != c.exe {
+			t.Errorf("%s: link with %s %v", c.triple, link.Cmd, link.Args)
+		}
+	}
+}
+
+// the commands `make -C rt` would run for `triple`, without running them.
+func runtimeBuild(t *testing.T, triple string) string {
+	makeCmd, err := exec.LookPath("make")
+	if err != nil {
+		t.Skip("make not found")
+	}
+	out, err := exec.Command(makeCmd, "-n", "-C", RT_DIR, "TRIPLE="+triple).CombinedOutput()
+	if err != nil {
+		t.Fatalf("make -n TRIPLE=%s: %s\n%s", triple, err, out)
+	}
+	return string(out)
+}
+
+func TestRuntimeMakefile(t *testing.T) {
+	wasi := runtimeBuild(t, "wasm32-wasi")
+	for _, want := range []string{" wasi/start.c", " wasi/alloc.c", " common/map.c", "--target=wasm32-wasi -ffreestanding", "-relocation-model=static", "wasm32-wasi/rt.o"} {
+		if !strings.Contains(wasi, want) {
+			t.Errorf("wasm32-wasi runtime build is missing %q:\n%s", want, wasi)
+		}
+	}
+	if strings.Contains(wasi, " c/") {
+		t.Errorf("wasm32-wasi runtime build uses the libc port:\n%s", wasi)
+	}
+
+	native := runtimeBuild(t, "i686-unknown-linux-gnu")
+	for _, want := range []string{" c/print.c", " common/map.c", "--target=i686-unknown-linux-gnu", "-relocation-model=pic"} {
+		if !strings.Contains(native, want) {
+			t.Errorf("i686 runtime build is missing %q:\n%s", want, native)
+		}
+	}
+	if strings.Contains(native, "wasi/") || strings.Contains(native, "-ffreestanding") {
+		t.Errorf("i686 runtime build uses the WASI port:\n%s", native)
+	}
+}
@@ -4,6 +4,7 @@ import "llvm"
 import "go/ast"
 import "go/token"
 import "fmt"
+import "strconv"
 
 type Translator struct {
 	mod     llvm.Module
@@ -12,6 +13,20 @@ type Translator struct {
 	Parent  *Translator
 	Target  Target
 	LLns    *LLVMNamespace
+	Runtime map[string]*FuncValue
+	Ifaces  *IfaceTables
+	// the descriptors of the map types used so far (see mapDescriptor).
+	MapTypes []typeGlobal
+	// set while translating a function literal, whose translator's Parent
+	// translates the enclosing function.
+	Closure *Closure
+	// the wrappers that let declared functions be used as closures.
+	FuncWrappers map[*FuncValue]llvm.Value
+	// the number of function literals in each function so far, for naming them.
+	Literals map[string]int
+	// the instances of generic functions and methods whose bodies are yet to
+	// be translated (see queueInstance).
+	Pending []func() *GoDiag
 }
 
 type Assignable interface {
@@ -21,97 +36,235 @@ type Assignable interface {
 
 func (v *BoundVar) BuildAssign(block *Block, val TypedValue) *GoDiag {
 	assert(!v.Const, "Attempting to assign to a const value.")
+	if variable, ok := v.Val.(*Variable); ok {
+		return variable.BuildAssign(block, val)
+	}
 	v.Val = val
 	return nil
 }
 
-func CreateTranslator() *Translator {
-	return &Translator{llvm.NullModule(), CreateScope(), llvm.CreateBuilder(), nil, CreateNativeTarget(), nil}
+func CreateTranslator(target Target) *Translator {
+	// types created outside of a translator (e.g. untyped constants defaulting
+	// to int) must agree with it on word-sized types.
+	global_type_factory.Target = target
+	return &Translator{llvm.NullModule(), CreateScope(), llvm.CreateBuilder(), nil, target, nil, nil, nil, nil, nil, nil, nil, nil}
 }
 
-func (trans *Translator) translateType(tyExpr ast.Expr) (Type, *GoDiag) {
+// translates the type expression `tyExpr`, looking up type names in `scope`.
+func (trans *Translator) translateType(scope *Scope, tyExpr ast.Expr) (Type, *GoDiag) {
 	switch exprType := tyExpr.(type) {
 	case *ast.Ident:
 		id, _ := tyExpr.(*ast.Ident)
-		ty := trans.Scope.lookupType(id.Name)
+		ty := scope.lookupType(id.Name)
 		if ty == nil {
-			return nil, DiagFromAST(tyExpr, "Unknown type \"%s\".", id.Name)
+			return nil, DiagFromAST(tyExpr, "Unknown type \"%s\".", id.Name).WithHint(scope.suggestType(id.Name))
+		}
+		if _, ok := ty.(*GenericType); ok {
+			return nil, DiagFromAST(tyExpr, "Generic type %s must be instantiated.", id.Name)
 		}
 		return ty, nil
+	case *ast.ParenExpr:
+		paren, _ := tyExpr.(*ast.ParenExpr)
+		return trans.translateType(scope, paren.X)
 	case *ast.StarExpr:
 		star, _ := tyExpr.(*ast.StarExpr)
-		atType, diag := trans.translateType(star.X)
+		atType, diag := trans.translateType(scope, star.X)
 		if diag != nil {
 			return nil, diag
 		}
 		return &PointerType{atType}, nil
+	case *ast.ArrayType:
+		arr, _ := tyExpr.(*ast.ArrayType)
+		elemType, diag := trans.translateType(scope, arr.Elt)
+		if diag != nil {
+			return nil, diag
+		}
+		if arr.Len == nil {
+			return &SliceType{elemType}, nil
+		}
+		if _, ok := arr.Len.(*ast.Ellipsis); ok {
+			return nil, DiagFromAST(arr.Len, "Array length [...] is only allowed in composite literals.")
+		}
+		length, diag := trans.translateArrayLen(scope, arr.Len)
+		if diag != nil {
+			return nil, diag
+		}
+		return &ArrayType{elemType, length}, nil
+	case *ast.StructType:
+		st, _ := tyExpr.(*ast.StructType)
+		return trans.translateStructType(scope, st)
+	case *ast.InterfaceType:
+		iface, _ := tyExpr.(*ast.InterfaceType)
+		return trans.translateInterfaceType(scope, iface)
+	case *ast.FuncType:
+		fnExpr, _ := tyExpr.(*ast.FuncType)
+		fnTy, diag := trans.translateFuncType(scope, fnExpr)
+		if diag != nil {
+			return nil, diag
+		}
+		return fnTy, nil
+	case *ast.MapType:
+		mapExpr, _ := tyExpr.(*ast.MapType)
+		keyType, diag := trans.translateType(scope, mapExpr.Key)
+		if diag != nil {
+			return nil, diag
+		}
+		if diag := checkMapKey(mapExpr.Key, keyType); diag != nil {
+			return nil, diag
+		}
+		elemType, diag := trans.translateType(scope, mapExpr.Value)
+		if diag != nil {
+			return nil, diag
+		}
+		return &MapType{keyType, elemType}, nil
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		return trans.translateInstanceType(scope, tyExpr)
+	case *ast.SelectorExpr:
+		sel, _ := tyExpr.(*ast.SelectorExpr)
+		pkg := packageOf(scope, sel.X)
+		if pkg == nil {
+			return nil, DiagFromAST(tyExpr, "Expected a type, but found an expression.")
+		}
+		ty, ok := pkg.Types[sel.Sel.Name]
+		if !ok {
+			return nil, DiagFromAST(tyExpr, "Unknown type \"%s.%s\".", pkg.Name, sel.Sel.Name).WithHint(pkg.suggestType(sel.Sel.Name))
+		}
+		return ty, nil
 	default:
 		return nil, DiagFromAST(tyExpr, "Unknown internal type expression type: %T.", exprType)
 	}
 	panic("Unreachable code. Please fix!")
 }
 
-func (block *Block) translateCallExpr(call *ast.CallExpr) (TypedValue, *GoDiag) {
+// translates a type expression appearing inside a function.
+func (block *Block) translateType(tyExpr ast.Expr) (Type, *GoDiag) {
+	return block.Trans.translateType(block.Scope, tyExpr)
+}
+
+func (block *Block) translateCallExpr(call *ast.CallExpr) (UntypedValue, *GoDiag) {
 	funExpr := call.Fun
+	ty, diag := block.typeOfExpr(funExpr)
+	if diag != nil {
+		return nil, diag
+	}
+	if ty != nil {
+		return block.translateConversion(call, ty)
+	}
+	if builtin := block.builtinOf(funExpr); builtin != nil {
+		return block.translateBuiltinCall(builtin, call)
+	}
+	if generic, explicit := block.genericCallee(funExpr); generic != nil {
+		return block.translateGenericCall(call, generic, explicit)
+	}
 	funValue, diag := block.translateExprRHS(funExpr)
 	if diag != nil {
 		return nil, diag
 	}
-
-	funcValue, ok := funValue.(*FuncValue)
-	if !ok {
-		return nil, DiagFromAST(funExpr, "Given expression not a function!")
+	if method, ok := funValue.(*BoundMethod); ok {
+		return block.buildCall(call, method.Method.Fn, method.Recv)
+	}
+	if funcValue, ok := funValue.(*FuncValue); ok {
+		return block.buildCall(call, funcValue)
 	}
 
-	funType, ok := funcValue.Type().(*FuncType)
-	if !ok {
-		panic("Function value does not have function type!")
+	// otherwise, it had better be a closure.
+	typed, udiag := funValue.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(funExpr, *udiag)
+	}
+	fnTy := funcTypeOf(typed.Type())
+	if fnTy == nil {
+		return nil, DiagFromAST(funExpr, "Given expression not a function!")
 	}
+	return block.buildClosureCall(call, typed, fnTy)
+}
 
-	if len(funType.Params) != len(call.Args) {
-		return nil, DiagFromAST(call, "Expected %d arguments, found %d!", len(funType.Params), len(call.Args))
+/*
+ * buildCall calls `fn` with the arguments of `call`. Any `prefix` arguments
+ * (e.g. a method's receiver) are passed ahead of them.
+ */
+func (block *Block) buildCall(call *ast.CallExpr, fn *FuncValue, prefix ...llvm.Value) (UntypedValue, *GoDiag) {
+	args, diag := block.translateArgs(call)
+	if diag != nil {
+		return nil, diag
 	}
+	return block.buildCallArgs(call, fn, args, prefix...)
+}
 
-	llvmArgs := make([]llvm.Value, len(call.Args))
+// translates the arguments of `call`, before they're assigned to parameters.
+func (block *Block) translateArgs(call *ast.CallExpr) ([]UntypedValue, *GoDiag) {
+	args := make([]UntypedValue, len(call.Args))
 	for i, argExpr := range call.Args {
 		untyped, diag := block.translateExprRHS(argExpr)
 		if diag != nil {
 			return nil, diag
 		}
-		typed_val, udiag := untyped.RValue(funType.Params[i])
-		if udiag != nil {
-			return nil, BindDiagToAST(argExpr, *udiag)
+		args[i] = untyped
+	}
+	return args, nil
+}
+
+// calls `fn` like buildCall, with the arguments `args` already translated.
+func (block *Block) buildCallArgs(call *ast.CallExpr, fn *FuncValue, args []UntypedValue, prefix ...llvm.Value) (UntypedValue, *GoDiag) {
+	funType := fn.Ty
+	params := funType.Params[len(prefix):]
+	if len(params) != len(args) {
+		return nil, DiagFromAST(call, "Expected %d arguments, found %d!", len(params), len(args))
+	}
+
+	llvmArgs := append([]llvm.Value{}, prefix...)
+	for i, argExpr := range call.Args {
+		typed_val, diag := block.assignTo(argExpr, args[i], params[i])
+		if diag != nil {
+			return nil, diag
 		}
-		llvmArgs[i] = typed_val.LLVM()
+		llvmArgs = append(llvmArgs, typed_val.LLVM())
 	}
 
 	// build call expression
-	block.Builder.BuildCall(funcValue.LLVM(), llvmArgs, "")
-
-	return funcValue, nil
+	result := block.Builder.BuildCall(fn.LLVM(), llvmArgs, "")
+	if funType.Result == nil {
+		return nil, nil
+	}
+	return &Register{funType.Result, result}, nil
 }
 
-func (block *Block) translateStringLit(lit string) TypedValue {
-	// TODO: Proper string escaping.
-	unescaped := lit[1 : len(lit)-1]
-	byteTy := block.Scope.lookupType("byte")
-	strTy := llvm.ArrayType(byteTy.LLVM(), uint(len(unescaped))+1)
-	llstr := llvm.ConstString(unescaped, false)
-	llvmVal := block.Trans.LLns.requestStaticConstAlloc(&PointerType{byteTy}, strTy, llstr)
-	litVal := &ConstString{unescaped, llvmVal}
-	return litVal
+func (block *Block) translateStringLit(lit *ast.BasicLit) (UntypedValue, *GoDiag) {
+	unescaped, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return nil, DiagFromAST(lit, "Unable to parse string literal!")
+	}
+	return &ConstString{unescaped, block.Trans.LLns}, nil
 }
 
 func (block *Block) translateBasicLit(lit *ast.BasicLit) (UntypedValue, *GoDiag) {
 	switch lit.Kind {
 	case token.STRING:
-		return block.translateStringLit(lit.Value), nil
+		return block.translateStringLit(lit)
 	case token.INT:
 		parsed := parseInt(lit.Value)
 		if parsed == nil {
 			return nil, DiagFromAST(lit, "Unable to parse integer!")
 		}
 		return parsed, nil
+	case token.FLOAT:
+		parsed := parseFloat(lit.Value)
+		if parsed == nil {
+			return nil, DiagFromAST(lit, "Unable to parse floating-point number!")
+		}
+		return parsed, nil
+	case token.CHAR:
+		parsed := parseRune(lit.Value)
+		if parsed == nil {
+			return nil, DiagFromAST(lit, "Unable to parse rune literal!")
+		}
+		return parsed, nil
+	case token.IMAG:
+		parsed := parseImag(lit.Value)
+		if parsed == nil {
+			return nil, DiagFromAST(lit, "Unable to parse imaginary number!")
+		}
+		return parsed, nil
 	default:
 		return nil, DiagFromAST(lit, fmt.Sprintf("Unable to translate literal: \"%s\".", lit.Value))
 	}
@@ -124,11 +277,51 @@ func (block *Block) translateExprLHS(expr ast.Expr) (Assignable, *GoDiag) {
 	switch expr.(type) {
 	case *ast.Ident:
 		ident, _ := expr.(*ast.Ident)
-		lVal := block.Scope.lookupVar(ident.Name)
+		lVal := block.lookupVar(ident.Name)
+		if lVal == nil {
+			return nil, DiagFromAST(expr, "Unknown identifier \"%s\".", ident).WithHint(block.Scope.suggestValue(ident.Name))
+		}
+		if lVal.Const {
+			return nil, DiagFromAST(expr, "Cannot assign to constant \"%s\".", ident)
+		}
 		if !lVal.LValue() {
 			return nil, DiagFromAST(expr, "Unable to assign to variable \"%s\".", ident)
 		}
 		return lVal, nil
+	case *ast.IndexExpr:
+		index, _ := expr.(*ast.IndexExpr)
+		elem, diag := block.translateIndexExpr(index)
+		if diag != nil {
+			return nil, diag
+		}
+		switch elemTy := elem.(type) {
+		case *Variable:
+			return elemTy, nil
+		case *MapElem:
+			return elemTy, nil
+		}
+		return nil, DiagFromAST(expr, "Cannot assign to an element of a value that isn't addressable.")
+	case *ast.SelectorExpr:
+		selector, _ := expr.(*ast.SelectorExpr)
+		field, diag := block.translateSelectorExpr(selector)
+		if diag != nil {
+			return nil, diag
+		}
+		variable, ok := field.(*Variable)
+		if !ok {
+			return nil, DiagFromAST(expr, "Cannot assign to a field of a value that isn't addressable.")
+		}
+		return variable, nil
+	case *ast.ParenExpr:
+		paren, _ := expr.(*ast.ParenExpr)
+		return block.translateExprLHS(paren.X)
+	case *ast.StarExpr:
+		star, _ := expr.(*ast.StarExpr)
+		pointee, diag := block.translateDeref(star)
+		if diag != nil {
+			return nil, diag
+		}
+		return pointee.(*Variable), nil
 	default:
 		return nil, DiagFromAST(expr, "Expected an lvalue expression.")
 	}
@@ -149,14 +342,52 @@ func (block *Block) translateExprRHS(expr ast.Expr) (UntypedValue, *GoDiag) {
 	case *ast.Ident:
 		// identifier lookup
 		ident, _ := expr.(*ast.Ident)
-		identVal := block.Scope.lookupVar(ident.Name)
+		identVal := block.lookupVar(ident.Name)
 		if identVal == nil {
-			return nil, DiagFromAST(expr, "Unknown identifier \"%s\".", ident)
+			return nil, DiagFromAST(expr, "Unknown identifier \"%s\".", ident).WithHint(block.Scope.suggestValue(ident.Name))
 		}
-		return identVal, nil
+		return identVal.Val, nil
 	case *ast.BasicLit:
 		basic, _ := expr.(*ast.BasicLit)
 		return block.translateBasicLit(basic)
+	case *ast.ParenExpr:
+		paren, _ := expr.(*ast.ParenExpr)
+		return block.translateExprRHS(paren.X)
+	case *ast.BinaryExpr:
+		binary, _ := expr.(*ast.BinaryExpr)
+		return block.translateBinaryExpr(binary)
+	case *ast.UnaryExpr:
+		unary, _ := expr.(*ast.UnaryExpr)
+		return block.translateUnaryExpr(unary)
+	case *ast.IndexExpr:
+		index, _ := expr.(*ast.IndexExpr)
+		if generic, explicit := block.genericCallee(index); generic != nil {
+			return block.translateInstantiation(index, generic, explicit)
+		}
+		return block.translateIndexExpr(index)
+	case *ast.IndexListExpr:
+		if generic, explicit := block.genericCallee(exprTy); generic != nil {
+			return block.translateInstantiation(exprTy, generic, explicit)
+		}
+		return nil, DiagFromAST(expr, "Only generic functions and types take type arguments.")
+	case *ast.SliceExpr:
+		slice, _ := expr.(*ast.SliceExpr)
+		return block.translateSliceExpr(slice)
+	case *ast.CompositeLit:
+		lit, _ := expr.(*ast.CompositeLit)
+		return block.translateCompositeLit(lit, nil)
+	case *ast.SelectorExpr:
+		selector, _ := expr.(*ast.SelectorExpr)
+		return block.translateSelectorExpr(selector)
+	case *ast.TypeAssertExpr:
+		assert, _ := expr.(*ast.TypeAssertExpr)
+		return block.translateTypeAssert(assert)
+	case *ast.FuncLit:
+		lit, _ := expr.(*ast.FuncLit)
+		return block.translateFuncLit(lit)
+	case *ast.StarExpr:
+		star, _ := expr.(*ast.StarExpr)
+		return block.translateDeref(star)
 	default:
 		return nil, DiagFromAST(expr, "Cannot translate expr of type: %T\n", exprTy)
 		break
@@ -165,15 +396,11 @@ func (block *Block) translateExprRHS(expr ast.Expr) (UntypedValue, *GoDiag) {
 }
 
 func (block *Block) translateExprRHSTyped(expr ast.Expr, expected_type Type) (TypedValue, *GoDiag) {
-	untyped, diag := block.translateExprRHS(expr)
+	untyped, diag := block.translateOperand(expr)
 	if diag != nil {
 		return nil, diag
 	}
-	typed, udiag := untyped.RValue(expected_type)
-	if udiag != nil {
-		return nil, BindDiagToAST(expr, *udiag)
-	}
-	return typed, nil
+	return block.assignTo(expr, untyped, expected_type)
 }
 
 func (block *Block) translateReturn(ret *ast.ReturnStmt) *GoDiag {
@@ -184,6 +411,7 @@ func (block *Block) translateReturn(ret *ast.ReturnStmt) *GoDiag {
 			return DiagFromAST(ret, "Function is expected to return a value!")
 		}
 		block.Builder.BuildRetVoid()
+		block.Terminated = true
 		return nil
 	}
 	if len(ret.Results) > 1 {
@@ -196,15 +424,11 @@ func (block *Block) translateReturn(ret *ast.ReturnStmt) *GoDiag {
 
 	// ok, now return the result.
 	block.Builder.BuildRet(result.LLVM())
+	block.Terminated = true
 	return nil
 }
 
 func (block *Block) translateVarDecl(gen *ast.GenDecl) *GoDiag {
-	cnst := false
-	if gen.Tok == token.CONST {
-		cnst = true
-	}
-
 	for _, spec := range gen.Specs {
 		valueSpec, ok := spec.(*ast.ValueSpec)
 		assert(ok, "Expected *ast.ValueSpec, but got different type!")
@@ -213,63 +437,143 @@ func (block *Block) translateVarDecl(gen *ast.GenDecl) *GoDiag {
 		var ty Type
 		var diag *GoDiag
 		if valueSpec.Type != nil {
-			ty, diag = block.Trans.translateType(valueSpec.Type)
+			ty, diag = block.translateType(valueSpec.Type)
 			if diag != nil {
 				return diag
 			}
 		}
 
-		if cnst {
-			return DiagFromAST(valueSpec, "Const declarations are not yet implemented.")
+		// translate a true variable declaration.
+		if ty == nil && len(valueSpec.Values) == 0 {
+			return DiagFromAST(valueSpec, "Variable declaration needs a type or an initializer.")
+		}
+		// the variables are either all zero, or all initialized.
+		rValues := make([]TypedValue, len(valueSpec.Names))
+		if len(valueSpec.Values) == 0 {
+			for idx := range rValues {
+				rValues[idx] = ty.Zero(block.Trans.LLns)
+			}
 		} else {
-			// translate a true variable declaration.
-			if ty == nil {
-				return DiagFromAST(valueSpec, "Unable to handle non-typed variable declarations at this time.")
+			expected := make([]Type, len(valueSpec.Names))
+			for idx := range expected {
+				expected[idx] = ty
 			}
+			rValues, diag = block.translateRHSList(valueSpec, valueSpec.Values, expected)
+			if diag != nil {
+				return diag
+			}
+		}
 
-			// Make sure that the variables are entirely initialized to zero values or entirely initialized to expressions.
-			if len(valueSpec.Values) != 0 && len(valueSpec.Values) != len(valueSpec.Names) {
-				return DiagFromAST(valueSpec, "Partial initialization of variables in a variable declaration is not allowed.")
+		// for each variable...
+		for idx, name := range valueSpec.Names {
+			diag = block.declareVariable(name, rValues[idx])
+			if diag != nil {
+				return diag
 			}
+		}
+	}
 
-			// for each variable...
-			for idx, name := range valueSpec.Names {
-				// first check to make sure that the name is not already used as a variable.
-				if block.Scope.lookupVar(name.Name) != nil {
-					return DiagFromAST(name, "A variable already exists with this identifier.")
-				}
-
-				if len(valueSpec.Values) == 0 {
-					// if there's no initializer, initialize to zero value.
-					rValue = ty.Zero(block.Trans.LLns)
-				} else {
-					rExpr := valueSpec.Values[idx]
-					rValue, diag = block.translateExprRHS(rExpr)
-					if diag != nil {
-						return diag
-					}
-					if !rValue.Type().Eq(ty) {
-						return DiagFromAST(rExpr, "Expected initializer of type \"%s\", but found type \"%s\".", ty.String(), rValue.Type().String())
-					}
-					return DiagFromAST(rExpr, "Expected initializer of type \"%s\", but found type \"%s\".", ty.String(), rValue.Type().String())
-				}
-
-				// now set the value.
-				block.Scope.addValue(name.Name, rValue)
+	// we've now translated everything; return success
+	return nil
+}
+
+/*
+ * declareVariable binds `name` in the current scope to a new variable holding
+ * `init`. The variable takes the type of its initializer.
+ */
+func (block *Block) declareVariable(name *ast.Ident, init TypedValue) *GoDiag {
+	if name.Name == "_" {
+		return nil
+	}
+	// shadowing outer scopes is fine; redeclaring in the same one isn't.
+	if _, exists := (*block.Scope.Values)[name.Name]; exists {
+		return DiagFromAST(name, "A variable already exists with this identifier.")
+	}
+	var variable *Variable
+	if block.Escaping[name.Name] {
+		variable = block.createHeapVariable(init.Type())
+	} else {
+		variable = block.createVariable(name.Name, init.Type())
+	}
+	buildStoreValue(block.Builder, init.Type(), init.LLVM(), variable.Ptr)
+	block.Scope.addValue(name.Name, variable)
+	return nil
+}
+
+/*
+ * translateRHSList translates the right side of an assignment, with one value
+ * for each destination, which should have the types in `expected` (where they
+ * aren't nil). A single comma-ok expression like `x.(T)` may give two values.
+ */
+func (block *Block) translateRHSList(node ast.Node, rhs []ast.Expr, expected []Type) ([]TypedValue, *GoDiag) {
+	if len(rhs) == 1 && len(expected) == 2 {
+		expr := rhs[0]
+		for {
+			paren, ok := expr.(*ast.ParenExpr)
+			if !ok {
+				break
 			}
+			expr = paren.X
+		}
+		switch commaOk := expr.(type) {
+		case *ast.TypeAssertExpr:
+			val, okVal, diag := block.translateAssertCommaOk(commaOk)
+			if diag != nil {
+				return nil, diag
+			}
+			return block.assignCommaOk(rhs[0], val, okVal, expected)
+		case *ast.IndexExpr:
+			elem, diag := block.translateIndexExpr(commaOk)
+			if diag != nil {
+				return nil, diag
+			}
+			mapElem, ok := elem.(*MapElem)
+			if !ok {
+				return nil, DiagFromAST(node, "Assignment mismatch: 2 variables but 1 value.")
+			}
+			val, okVal := mapElem.buildLookupOk()
+			return block.assignCommaOk(rhs[0], val, okVal, expected)
+		}
+	}
+	if len(rhs) != len(expected) {
+		return nil, DiagFromAST(node, "Assignment mismatch: %d variables but %d values.", len(expected), len(rhs))
+	}
+	rValues := make([]TypedValue, len(rhs))
+	for idx, rExpr := range rhs {
+		rValue, diag := block.translateExprRHSTyped(rExpr, expected[idx])
+		if diag != nil {
+			return nil, diag
+		}
+		rValues[idx] = rValue
+	}
+	return rValues, nil
+}
 
-			// we've now translated everything; return success
-			return nil
+// converts the two results of a comma-ok expression to the `expected` types.
+func (block *Block) assignCommaOk(expr ast.Expr, val TypedValue, ok TypedValue, expected []Type) ([]TypedValue, *GoDiag) {
+	rValues := []TypedValue{val, ok}
+	for idx, rValue := range rValues {
+		if expected[idx] == nil {
+			continue
 		}
+		typed, diag := block.assignTo(expr, rValue, expected[idx])
+		if diag != nil {
+			return nil, diag
+		}
+		rValues[idx] = typed
 	}
-	panic("Unreachable.")
+	return rValues, nil
 }
 
 func (block *Block) translateGenDecl(gen *ast.GenDecl) *GoDiag {
 	switch gen.Tok {
 	
-	case token.VAR, token.CONST:
+	case token.VAR:
 		return block.translateVarDecl(gen)
+	case token.CONST:
+		return block.translateConstDecl(gen)
+	case token.TYPE:
+		return block.translateTypeDecl(gen)
 	default:
 		return DiagFromAST(gen, "General declaration type \"%s\" not implemented yet.", gen.Tok)
 	}
@@ -277,25 +581,149 @@ func (block *Block) translateGenDecl(gen *ast.GenDecl) *GoDiag {
 	return nil
 }
 
-// TODO: in cases such as `a, b = b, a`, the assignment may be incorrect.
-
 func (block *Block) translateAssign(assign *ast.AssignStmt) *GoDiag {
-	// for now, we can't do short assignments, just long assignments.
-	if len(assign.Lhs) != len(assign.Rhs) {
-		return DiagFromAST(assign, "Every variable must have an equivalent rValue")
+	switch assign.Tok {
+	case token.ASSIGN:
+	case token.DEFINE:
+		return block.translateShortVarDecl(assign)
+	default:
+		op, ok := assignOps[assign.Tok]
+		if !ok {
+			return DiagFromAST(assign, "Assignment operator %s is not implemented yet.", assign.Tok)
+		}
+		if len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+			return DiagFromAST(assign, "Assignment operator %s takes a single operand on each side.", assign.Tok)
+		}
+		return block.translateOpAssign(assign.Lhs[0], op, assign.Rhs[0], assign.TokPos)
 	}
+
+	// find every destination first, then evaluate every value, so that
+	// `a, b = b, a` swaps rather than copying.
+	lValues := make([]Assignable, len(assign.Lhs))
 	for idx, lExpr := range assign.Lhs {
 		lValue, diag := block.translateExprLHS(lExpr)
 		if diag != nil {
 			return diag
 		}
-		rExpr := assign.Rhs[idx]
-		rValue, diag := block.translateExprRHS(rExpr, nil)
+		lValues[idx] = lValue
+	}
+	expected := make([]Type, len(lValues))
+	for idx, lValue := range lValues {
+		expected[idx] = lValue.Type()
+	}
+	rValues, diag := block.translateRHSList(assign, assign.Rhs, expected)
+	if diag != nil {
+		return diag
+	}
+	for idx, lValue := range lValues {
+		diag := lValue.BuildAssign(block, rValues[idx])
 		if diag != nil {
 			return diag
 		}
+	}
+	return nil
+}
+
+// maps each assignment operator onto the binary operator it applies.
+var assignOps = map[token.Token]token.Token{
+	token.ADD_ASSIGN:     token.ADD,
+	token.SUB_ASSIGN:     token.SUB,
+	token.MUL_ASSIGN:     token.MUL,
+	token.QUO_ASSIGN:     token.QUO,
+	token.REM_ASSIGN:     token.REM,
+	token.AND_ASSIGN:     token.AND,
+	token.OR_ASSIGN:      token.OR,
+	token.XOR_ASSIGN:     token.XOR,
+	token.AND_NOT_ASSIGN: token.AND_NOT,
+	token.SHL_ASSIGN:     token.SHL,
+	token.SHR_ASSIGN:     token.SHR,
+}
+
+/*
+ * translateOpAssign translates `x op= y`, and `x++`/`x--`, as `x = x op y`,
+ * except that `x` is only evaluated once: `a[f()] += 1` calls f once.
+ */
+func (block *Block) translateOpAssign(lExpr ast.Expr, op token.Token, rExpr ast.Expr, pos token.Pos) *GoDiag {
+	lValue, diag := block.translateExprLHS(lExpr)
+	if diag != nil {
+		return diag
+	}
+	// x is loaded once, before y is evaluated.
+	x := &Register{lValue.Type(), lValue.LLVM()}
+	y, diag := block.translateOperand(rExpr)
+	if diag != nil {
+		return diag
+	}
+	binary := &ast.BinaryExpr{X: lExpr, OpPos: pos, Op: op, Y: rExpr}
+	var result UntypedValue
+	if op == token.SHL || op == token.SHR {
+		result, diag = block.applyShift(binary, x, y)
+	} else {
+		result, diag = block.applyArith(binary, x, y)
+	}
+	if diag != nil {
+		return diag
+	}
+	rValue, diag := block.assignTo(binary, result, lValue.Type())
+	if diag != nil {
+		return diag
+	}
+	return lValue.BuildAssign(block, rValue)
+}
+
+func (block *Block) translateIncDec(incDec *ast.IncDecStmt) *GoDiag {
+	op := token.ADD
+	if incDec.Tok == token.DEC {
+		op = token.SUB
+	}
+	one := &ast.BasicLit{ValuePos: incDec.TokPos, Kind: token.INT, Value: "1"}
+	return block.translateOpAssign(incDec.X, op, one, incDec.TokPos)
+}
+
+/*
+ * `a, b := x, y` declares whichever of its names are new to the current
+ * scope, and assigns to the rest. At least one name has to be new.
+ */
+func (block *Block) translateShortVarDecl(assign *ast.AssignStmt) *GoDiag {
+	names := make([]*ast.Ident, len(assign.Lhs))
+	anyNew := false
+	for idx, lExpr := range assign.Lhs {
+		ident, ok := lExpr.(*ast.Ident)
+		if !ok {
+			return DiagFromAST(lExpr, "Expected an identifier on the left side of :=.")
+		}
+		names[idx] = ident
+		if _, exists := (*block.Scope.Values)[ident.Name]; !exists && ident.Name != "_" {
+			anyNew = true
+		}
+	}
+	if !anyNew {
+		return DiagFromAST(assign, "No new variables on left side of :=.")
+	}
 
-		diag = lValue.BuildAssign(block, rValue)
+	expected := make([]Type, len(names))
+	for idx, name := range names {
+		if existing, exists := (*block.Scope.Values)[name.Name]; exists {
+			if !existing.LValue() {
+				return DiagFromAST(name, "Unable to assign to variable \"%s\".", name.Name)
+			}
+			expected[idx] = existing.Type()
+		}
+	}
+	rValues, diag := block.translateRHSList(assign, assign.Rhs, expected)
+	if diag != nil {
+		return diag
+	}
+	for idx, name := range names {
+		existing, exists := (*block.Scope.Values)[name.Name]
+		if !exists {
+			diag := block.declareVariable(name, rValues[idx])
+			if diag != nil {
+				return diag
+			}
+			continue
+		}
+		diag := existing.BuildAssign(block, rValues[idx])
 		if diag != nil {
 			return diag
 		}
@@ -316,6 +744,10 @@ func (block *Block) translateDecl(declStmt *ast.DeclStmt) *GoDiag {
 }
 
 func (block *Block) translateStatement(statement ast.Stmt) *GoDiag {
+	if block.Terminated {
+		// unreachable code (e.g. after a return); give it a block of its own.
+		block.positionAtEnd(block.appendBasicBlock("dead"))
+	}
 	switch statementType := statement.(type) {
 	case *ast.ExprStmt:
 		expr, _ := statement.(*ast.ExprStmt)
@@ -330,6 +762,32 @@ func (block *Block) translateStatement(statement ast.Stmt) *GoDiag {
 	case *ast.AssignStmt:
 		assign, _ := statement.(*ast.AssignStmt)
 		return block.translateAssign(assign)
+	case *ast.IfStmt:
+		ifStmt, _ := statement.(*ast.IfStmt)
+		return block.translateIf(ifStmt)
+	case *ast.TypeSwitchStmt:
+		switchStmt, _ := statement.(*ast.TypeSwitchStmt)
+		return block.translateTypeSwitch(switchStmt)
+	case *ast.ForStmt:
+		forStmt, _ := statement.(*ast.ForStmt)
+		return block.translateFor(forStmt)
+	case *ast.RangeStmt:
+		rangeStmt, _ := statement.(*ast.RangeStmt)
+		return block.translateRange(rangeStmt)
+	case *ast.BranchStmt:
+		branch, _ := statement.(*ast.BranchStmt)
+		return block.translateBranch(branch)
+	case *ast.IncDecStmt:
+		incDec, _ := statement.(*ast.IncDecStmt)
+		return block.translateIncDec(incDec)
+	case *ast.BlockStmt:
+		blockStmt, _ := statement.(*ast.BlockStmt)
+		child := block.createChild()
+		diag := child.translateStatements(blockStmt.List)
+		block.continueFrom(child)
+		return diag
+	case *ast.EmptyStmt:
+		return nil
 	default:
 		return DiagFromAST(statement, "Unknown statement type: %T", statementType)
 		break
@@ -337,59 +795,220 @@ func (block *Block) translateStatement(statement ast.Stmt) *GoDiag {
 	return nil
 }
 
-func (trans *Translator) CreateBlockForFunction(llvmFunc llvm.Value, fnTy FuncType) *Block {
+func (block *Block) translateStatements(statements []ast.Stmt) *GoDiag {
+	for _, statement := range statements {
+		diag := block.translateStatement(statement)
+		if diag != nil {
+			return diag
+		}
+	}
+	return nil
+}
+
+func (block *Block) translateIf(ifStmt *ast.IfStmt) *GoDiag {
+	// anything declared by the init statement is only visible inside the if.
+	scoped := block.createChild()
+	if ifStmt.Init != nil {
+		diag := scoped.translateStatement(ifStmt.Init)
+		if diag != nil {
+			return diag
+		}
+	}
+	cond, diag := scoped.translateExprRHSTyped(ifStmt.Cond, nil)
+	if diag != nil {
+		return diag
+	}
+	if _, ok := cond.Type().Base().(*BoolType); !ok {
+		return DiagFromAST(ifStmt.Cond, "Non-boolean condition (type %s) in if statement.", cond.Type().String())
+	}
+
+	thenBB := scoped.appendBasicBlock("if.then")
+	elseBB := thenBB
+	if ifStmt.Else != nil {
+		elseBB = scoped.appendBasicBlock("if.else")
+	}
+	mergeBB := scoped.appendBasicBlock("if.end")
+	if ifStmt.Else == nil {
+		elseBB = mergeBB
+	}
+	scoped.buildCondBr(cond.LLVM(), thenBB, elseBB)
+
+	fallsThrough := ifStmt.Else == nil
+	thenBlock := scoped.createChild()
+	thenBlock.positionAtEnd(thenBB)
+	diag = thenBlock.translateStatements(ifStmt.Body.List)
+	if diag != nil {
+		return diag
+	}
+	if !thenBlock.Terminated {
+		thenBlock.buildBr(mergeBB)
+		fallsThrough = true
+	}
+
+	if ifStmt.Else != nil {
+		elseBlock := scoped.createChild()
+		elseBlock.positionAtEnd(elseBB)
+		// either another if statement, or a block.
+		diag = elseBlock.translateStatement(ifStmt.Else)
+		if diag != nil {
+			return diag
+		}
+		if !elseBlock.Terminated {
+			elseBlock.buildBr(mergeBB)
+			fallsThrough = true
+		}
+	}
+
+	block.positionAtEnd(mergeBB)
+	if !fallsThrough {
+		// every branch returned; nothing can reach the end of the if.
+		block.Builder.BuildUnreachable()
+		block.Terminated = true
+	}
+	return nil
+}
+
+func (trans *Translator) CreateBlockForFunction(fn *FuncValue) *Block {
 	scope := trans.Scope.createChild()
-	block := llvm.AppendBasicBlock(llvmFunc, "entry")
+	block := llvm.AppendBasicBlock(fn.LLVMVal, "entry")
 	builder := llvm.CreateBuilder()
 	builder.PositionBuilderAtEnd(block)
-	resultTy := fnTy.Result
-	return &Block{scope, block, builder, resultTy, trans}
+	resultTy := fn.Ty.Result
+	return &Block{scope, block, builder, resultTy, trans, fn.LLVMVal, block, false, nil, fn.Name, nil}
 }
 
-func (trans *Translator) translateFuncDecl(decl *ast.FuncDecl) *GoDiag {
-	fnTypeDecl := decl.Type
-	if len(fnTypeDecl.Results.List) > 1 {
-		return DiagFromAST(decl, "Returning more than one value is not yet permitted.")
+func (trans *Translator) translateFuncType(scope *Scope, fnTypeDecl *ast.FuncType) (*FuncType, *GoDiag) {
+	if fnTypeDecl.Results != nil && len(fnTypeDecl.Results.List) > 1 {
+		return nil, DiagFromAST(fnTypeDecl, "Returning more than one value is not yet permitted.")
 	}
 
 	paramTypes := make([]Type, 0)
 	paramList := fnTypeDecl.Params
 	for _, field := range paramList.List {
-		ty, diag := trans.translateType(field.Type)
+		ty, diag := trans.translateType(scope, field.Type)
 		if diag != nil {
-			return diag
+			return nil, diag
+		}
+		count := len(field.Names)
+		if count == 0 { // unnamed parameter
+			count = 1
 		}
-		for i := 0; i < len(field.Names); i++ { // for every variable in the field
+		for i := 0; i < count; i++ { // for every variable in the field
 			paramTypes = append(paramTypes, ty)
 		}
 	}
 
 	var resultTy Type
-	if len(fnTypeDecl.Results.List) == 0 {
-		resultTy = nil
-	} else {
-		ty, diag := trans.translateType(fnTypeDecl.Results.List[0].Type)
+	if fnTypeDecl.Results != nil && len(fnTypeDecl.Results.List) == 1 {
+		result := fnTypeDecl.Results.List[0]
+		if len(result.Names) > 1 {
+			return nil, DiagFromAST(result, "Returning more than one value is not yet permitted.")
+		}
+		ty, diag := trans.translateType(scope, result.Type)
 		if diag != nil {
-			return diag
+			return nil, diag
 		}
 		resultTy = ty
 	}
 
-	fnTy := FuncType{paramTypes, resultTy}
+	return &FuncType{paramTypes, resultTy}, nil
+}
 
-	llvmFnTy := fnTy.LLVM()
+/*
+ * declareFunc adds the function's signature to the module and the package
+ * scope, before any bodies are translated, so that functions may call each
+ * other regardless of the order they're declared in.
+ */
+func (trans *Translator) declareFunc(decl *ast.FuncDecl) *GoDiag {
+	if decl.Type.TypeParams != nil {
+		generic := &GenericFunc{decl, trans.Scope, make(map[string]*FuncValue)}
+		if !trans.Scope.addValue(decl.Name.Name, generic) {
+			return DiagFromAST(decl.Name, "\"%s\" is already declared.", decl.Name.Name)
+		}
+		return nil
+	}
+	fnTy, diag := trans.translateFuncType(trans.Scope, decl.Type)
+	if diag != nil {
+		return diag
+	}
+	name := decl.Name.Name
+	llvmFn := trans.mod.AddFunction(name, fnTy.LLVMSignature())
+	if !trans.Scope.addValue(name, &FuncValue{name, fnTy, llvmFn}) {
+		return DiagFromAST(decl.Name, "\"%s\" is already declared.", name)
+	}
+	return nil
+}
 
-	llvmFn := trans.mod.AddFunction(decl.Name.Name, llvmFnTy)
+func (trans *Translator) translateFuncDecl(decl *ast.FuncDecl) *GoDiag {
+	if decl.Recv != nil && decl.Name.Name == "_" {
+		return nil
+	}
+	// generics are only translated as they're instantiated.
+	if decl.Type.TypeParams != nil || (decl.Recv != nil && trans.genericReceiver(decl.Recv) != nil) {
+		return nil
+	}
+	return trans.translateFunc(decl, trans.declaredFunc(decl))
+}
 
-	block := trans.CreateBlockForFunction(llvmFn, fnTy)
+// translates the body of `decl` into `fn`.
+func (trans *Translator) translateFunc(decl *ast.FuncDecl, fn *FuncValue) *GoDiag {
+	block := trans.CreateBlockForFunction(fn)
+	block.Escaping = escapingNames(decl.Body)
 
-	for _, statement := range decl.Body.List {
-		diag := block.translateStatement(statement)
-		if diag != nil {
-			return diag
+	// parameters are variables like any other, initialized by the caller. A
+	// method's receiver comes first.
+	idx := 0
+	if decl.Recv != nil {
+		for _, name := range decl.Recv.List[0].Names {
+			recv := &Register{fn.Ty.Params[0], llvm.GetParam(fn.LLVMVal, 0)}
+			diag := block.declareVariable(name, recv)
+			if diag != nil {
+				return diag
+			}
 		}
+		idx++
 	}
+	if diag := block.declareParams(decl.Type.Params, fn.Ty, idx); diag != nil {
+		return diag
+	}
+	return block.translateFuncBody(decl.Body)
+}
 
+/*
+ * declareParams declares the parameters in `params`, which start at parameter
+ * `idx` of the function, whose type is `fnTy`.
+ */
+func (block *Block) declareParams(params *ast.FieldList, fnTy *FuncType, idx int) *GoDiag {
+	for _, field := range params.List {
+		if len(field.Names) == 0 {
+			idx++
+			continue
+		}
+		for _, name := range field.Names {
+			param := &Register{fnTy.Params[idx], llvm.GetParam(block.Fn, uint(idx))}
+			diag := block.declareVariable(name, param)
+			if diag != nil {
+				return diag
+			}
+			idx++
+		}
+	}
+	return nil
+}
+
+// translates the body of the function, once its parameters are declared.
+func (block *Block) translateFuncBody(body *ast.BlockStmt) *GoDiag {
+	diag := block.translateStatements(body.List)
+	if diag != nil {
+		return diag
+	}
+
+	if !block.Terminated {
+		if block.ResultTy != nil {
+			return DiagFromAST(body, "Missing return at end of function.")
+		}
+		block.Builder.BuildRetVoid()
+	}
 	return nil
 }
 
@@ -397,11 +1016,15 @@ func (trans *Translator) translateDecl(decl ast.Decl) *GoDiag {
 	switch declType := decl.(type) {
 	case *ast.FuncDecl:
 		fDecl, _ := decl.(*ast.FuncDecl)
-		if fDecl.Recv != nil {
-			return DiagFromAST(fDecl, "Methods not supported yet.")
-		}
 		return trans.translateFuncDecl(fDecl)
 		break
+	case *ast.GenDecl:
+		gen, _ := decl.(*ast.GenDecl)
+		if gen.Tok == token.VAR {
+			return DiagFromAST(decl, "Package-level %s declarations are not supported yet.", gen.Tok)
+		}
+		// already declared, ahead of the functions.
+		return nil
 	default:
 		return DiagFromAST(decl, "Unsupported Decl type: \"%T\".", declType)
 	}
@@ -410,7 +1033,7 @@ func (trans *Translator) translateDecl(decl ast.Decl) *GoDiag {
 
 func (trans *Translator) addExternFunction(name string, result Type, params ...Type) TypedValue {
 	ty := &FuncType{params, result}
-	llvmVal := trans.mod.AddFunction(name, ty.LLVM())
+	llvmVal := trans.mod.AddFunction(name, ty.LLVMSignature())
 	llvm.SetLinkage(llvmVal, llvm.ExternalLinkage)
 	val := &FuncValue{name, ty, llvmVal}
 	trans.Scope.addValue(name, val)
@@ -420,24 +1043,56 @@ func (trans *Translator) addExternFunction(name string, result Type, params ...T
 func (trans *Translator) CreateGoScope() {
 	scope := CreateScope()
 	// initialize base go language type system
-	scope.addType("uint8", &IntType{BLTN_TY_UINT8, trans.Target})
-	scope.addType("int8", &IntType{BLTN_TY_INT8, trans.Target})
-	scope.addType("uint16", &IntType{BLTN_TY_UINT16, trans.Target})
-	scope.addType("int16", &IntType{BLTN_TY_INT16, trans.Target})
-	scope.addType("uint32", &IntType{BLTN_TY_UINT32, trans.Target})
-	scope.addType("int32", &IntType{BLTN_TY_INT32, trans.Target})
-	scope.addType("uint64", &IntType{BLTN_TY_UINT64, trans.Target})
-	scope.addType("int64", &IntType{BLTN_TY_INT64, trans.Target})
-	scope.addType("int", &IntType{BLTN_TY_INT, trans.Target})
-	scope.addType("uint", &IntType{BLTN_TY_UINT, trans.Target})
+	factory := TypeFactory{trans.Target}
+	scope.addType("uint8", factory.IntType(BLTN_TY_UINT8))
+	scope.addType("int8", factory.IntType(BLTN_TY_INT8))
+	scope.addType("uint16", factory.IntType(BLTN_TY_UINT16))
+	scope.addType("int16", factory.IntType(BLTN_TY_INT16))
+	scope.addType("uint32", factory.IntType(BLTN_TY_UINT32))
+	scope.addType("int32", factory.IntType(BLTN_TY_INT32))
+	scope.addType("uint64", factory.IntType(BLTN_TY_UINT64))
+	scope.addType("int64", factory.IntType(BLTN_TY_INT64))
+	scope.addType("int", factory.IntType(BLTN_TY_INT))
+	scope.addType("uint", factory.IntType(BLTN_TY_UINT))
+	scope.addType("uintptr", factory.IntType(BLTN_TY_UINTPTR))
+
+	scope.addType("float32", factory.FloatType(BLTN_TY_FLOAT32))
+	scope.addType("float64", factory.FloatType(BLTN_TY_FLOAT64))
+	scope.addType("complex64", factory.ComplexType(BLTN_TY_COMPLEX64))
+	scope.addType("complex128", factory.ComplexType(BLTN_TY_COMPLEX128))
+	scope.addType("bool", factory.BoolType())
+	scope.addType("string", factory.StringType())
 
 	// type synonyms
 	scope.addTypeAlias("byte", "uint8")
+	scope.addTypeAlias("rune", "int32")
+	scope.addType("any", &InterfaceType{[]IfaceMethod{}, nil})
+
+	// type comparable interface { comparable }, which only constraints may use.
+	comparableTy := CreateNamedType("comparable")
+	comparableTy.Underlying = &InterfaceType{[]IfaceMethod{}, &TypeSet{nil, true}}
+	scope.addType("comparable", comparableTy)
+
+	// type error interface { Error() string }
+	errorTy := CreateNamedType("error")
+	errorTy.Underlying = &InterfaceType{[]IfaceMethod{{"Error", &FuncType{[]Type{}, factory.StringType()}}}, nil}
+	scope.addType("error", errorTy)
+
+	// predeclared constants
+	scope.addValue("true", &ConstBool{true})
+	scope.addValue("false", &ConstBool{false})
+	scope.addValue("nil", &NilValue{})
+
+	// built-in functions
+	for _, name := range []string{"append", "cap", "complex", "copy", "delete", "imag", "len", "make", "new", "print", "println", "real"} {
+		scope.addValue(name, &BuiltinFunc{name})
+	}
 
 	trans.Scope = scope
 
 	// and add in temporary libc linkage.
 	trans.addExternFunction("puts", nil, &PointerType{trans.Scope.lookupType("uint8")})
+	trans.initRuntime()
 	trans.initPrint()
 }
 
@@ -445,6 +1100,11 @@ func (trans *Translator) translateFile(file *ast.File, fset *token.FileSet) (llv
 	assert(file != nil, "File is nil.")
 	trans.mod = llvm.ModuleCreateWithName(file.Name.Name)
 	trans.LLns = CreateNamespace(trans.mod)
+	trans.Ifaces = CreateIfaceTables()
+	trans.MapTypes = nil
+	trans.FuncWrappers = make(map[*FuncValue]llvm.Value)
+	trans.Literals = make(map[string]int)
+	trans.Pending = nil
 	trans.mod.SetTarget(trans.Target.Triple)
 	trans.mod.SetDataLayout(trans.Target.DataLayout)
 	trans.CreateGoScope()
@@ -452,6 +1112,60 @@ func (trans *Translator) translateFile(file *ast.File, fset *token.FileSet) (llv
 		return trans.mod, nil
 	}
 
+	if diag := trans.declareImports(trans.Scope, file.Imports); diag != nil {
+		diag.fset = fset
+		return trans.mod, diag
+	}
+
+	// declare types first, since function signatures may use them. Types
+	// from separate declarations may still refer to each other.
+	specs := make([]*ast.TypeSpec, 0)
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+			specs = append(specs, typeSpecs(gen)...)
+		}
+	}
+	// constants may be used in array lengths, but may also have those types.
+	// Declare what can be before the types, and the rest after.
+	consts := make([]*constSpec, 0)
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.CONST {
+			declSpecs, diag := constSpecs(gen)
+			if diag != nil {
+				diag.fset = fset
+				return trans.mod, diag
+			}
+			consts = append(consts, declSpecs...)
+		}
+	}
+	consts, _ = trans.declarePackageConsts(consts)
+	if diag := trans.declareTypes(trans.Scope, specs); diag != nil {
+		diag.fset = fset
+		return trans.mod, diag
+	}
+	if _, diag := trans.declarePackageConsts(consts); diag != nil {
+		diag.fset = fset
+		return trans.mod, diag
+	}
+
+	// declare every function up front, so bodies can refer to any of them.
+	for _, decl := range file.Decls {
+		fDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		var diag *GoDiag
+		if fDecl.Recv != nil {
+			diag = trans.declareMethod(fDecl)
+		} else {
+			diag = trans.declareFunc(fDecl)
+		}
+		if diag != nil {
+			diag.fset = fset
+			return trans.mod, diag
+		}
+	}
+
 	for i := 0; i < len(file.Decls); i++ {
 		decl := file.Decls[i]
 		diag := trans.translateDecl(decl)
@@ -460,5 +1174,15 @@ func (trans *Translator) translateFile(file *ast.File, fset *token.FileSet) (llv
 			return trans.mod, diag
 		}
 	}
+
+	// translating an instance may instantiate more of them.
+	for len(trans.Pending) > 0 {
+		next := trans.Pending[0]
+		trans.Pending = trans.Pending[1:]
+		if diag := next(); diag != nil {
+			diag.fset = fset
+			return trans.mod, diag
+		}
+	}
 	return trans.mod, nil
 }
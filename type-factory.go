@@ -8,4 +8,20 @@ type TypeFactory struct {
 
 func (factory TypeFactory) IntType(ty uint) Type {
 	return &IntType{ty, factory.Target}
-}
\ No newline at end of file
+}
+
+func (factory TypeFactory) BoolType() Type {
+	return &BoolType{}
+}
+
+func (factory TypeFactory) FloatType(ty uint) Type {
+	return &FloatType{ty}
+}
+
+func (factory TypeFactory) ComplexType(ty uint) Type {
+	return &ComplexType{ty}
+}
+
+func (factory TypeFactory) StringType() Type {
+	return &StringType{}
+}
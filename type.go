@@ -3,6 +3,7 @@ package main
 import "llvm"
 import "fmt"
 import "math/big"
+import "strings"
 
 type Type interface {
 	String() string
@@ -11,7 +12,7 @@ type Type interface {
 	Base() Type
 	BaseIDString() string
 	Zero(*LLVMNamespace) TypedValue
-	Named() bool // Named types are interfaces, aliases.
+	Named() bool // Named types are predeclared and defined types.
 }
 
 type TypeMap map[string]Type
@@ -33,6 +34,13 @@ const (
 
   BLTN_TY_INT
   BLTN_TY_UINT
+	BLTN_TY_UINTPTR
+
+	BLTN_TY_FLOAT32
+	BLTN_TY_FLOAT64
+
+	BLTN_TY_COMPLEX64
+	BLTN_TY_COMPLEX128
 
 	BLTN_TY_LIT
 )
@@ -64,6 +72,8 @@ func (num *IntType) BitWidth() uint {
 		return num.target.WordSize()
 	case BLTN_TY_UINT:
 		return num.target.WordSize()
+	case BLTN_TY_UINTPTR:
+		return num.target.WordSize()
 	default:
 		panic(fmt.Sprintf("Invalid internal state (unknown integer type %u).", num.Type))
 		break
@@ -71,6 +81,14 @@ func (num *IntType) BitWidth() uint {
 	panic("Unreachable code. Please fix.")
 }
 
+func (num *IntType) Signed() bool {
+	switch num.Type {
+	case BLTN_TY_INT8, BLTN_TY_INT16, BLTN_TY_INT32, BLTN_TY_INT64, BLTN_TY_INT:
+		return true
+	}
+	return false
+}
+
 func (num *IntType) String() string {
 	switch num.Type {
 	case BLTN_TY_UINT8:
@@ -93,6 +111,8 @@ func (num *IntType) String() string {
 		return "int"
 	case BLTN_TY_UINT:
 		return "uint"
+	case BLTN_TY_UINTPTR:
+		return "uintptr"
 	default:
 		panic(fmt.Sprintf("Invalid internal state (unknown integer type %u).", num.Type))
 		break
@@ -117,7 +137,7 @@ func (num *IntType) Base() Type {
 }
 
 func (num *IntType) Zero(ns *LLVMNamespace) TypedValue {
-	return &TypedConstInt{ConstInt{big.NewInt(0), true}, num}
+	return &TypedConstInt{ConstInt{big.NewInt(0), true, false}, num}
 }
 
 func (num *IntType) BaseIDString() string {
@@ -125,46 +145,565 @@ func (num *IntType) BaseIDString() string {
 }
 
 func (num *IntType) Named() bool {
+	return true
+}
+
+type FloatType struct {
+	Type uint
+}
+
+func (num *FloatType) BitWidth() uint {
+	switch num.Type {
+	case BLTN_TY_FLOAT32:
+		return 32
+	case BLTN_TY_FLOAT64:
+		return 64
+	}
+	panic(fmt.Sprintf("Invalid internal state (unknown float type %d).", num.Type))
+}
+
+func (num *FloatType) String() string {
+	switch num.Type {
+	case BLTN_TY_FLOAT32:
+		return "float32"
+	case BLTN_TY_FLOAT64:
+		return "float64"
+	}
+	panic(fmt.Sprintf("Invalid internal state (unknown float type %d).", num.Type))
+}
+
+func (num *FloatType) LLVM() llvm.Type {
+	if num.Type == BLTN_TY_FLOAT32 {
+		return llvm.FloatType()
+	}
+	return llvm.DoubleType()
+}
+
+func (num *FloatType) Eq(ty Type) bool {
+	other, ok := ty.(*FloatType)
+	if ok {
+		return num.Type == other.Type
+	}
 	return false
 }
 
-type AliasType struct {
-	Ident string
-	Alias Type
+func (num *FloatType) Base() Type {
+	return num
 }
 
-func (alias *AliasType) String() string {
-	return alias.Ident
+func (num *FloatType) Zero(ns *LLVMNamespace) TypedValue {
+	return &TypedConstFloat{ConstFloat{new(big.Rat)}, num}
 }
 
-func (alias *AliasType) LLVM() llvm.Type {
-	return alias.Alias.LLVM()
+func (num *FloatType) BaseIDString() string {
+	return num.String()
 }
 
-func (alias *AliasType) Eq(ty Type) bool {
-	other, ok := ty.(*AliasType)
+func (num *FloatType) Named() bool {
+	return true
+}
+
+/*
+ * Complex numbers are a pair of floats, { real, imaginary }, the same layout
+ * as C's _Complex types.
+ */
+type ComplexType struct {
+	Type uint
+}
+
+// the type of each half of the complex number.
+func (num *ComplexType) PartType() *FloatType {
+	switch num.Type {
+	case BLTN_TY_COMPLEX64:
+		return &FloatType{BLTN_TY_FLOAT32}
+	case BLTN_TY_COMPLEX128:
+		return &FloatType{BLTN_TY_FLOAT64}
+	}
+	panic(fmt.Sprintf("Invalid internal state (unknown complex type %d).", num.Type))
+}
+
+func (num *ComplexType) String() string {
+	switch num.Type {
+	case BLTN_TY_COMPLEX64:
+		return "complex64"
+	case BLTN_TY_COMPLEX128:
+		return "complex128"
+	}
+	panic(fmt.Sprintf("Invalid internal state (unknown complex type %d).", num.Type))
+}
+
+func (num *ComplexType) LLVM() llvm.Type {
+	part := num.PartType().LLVM()
+	return llvm.StructType([]llvm.Type{part, part}, false)
+}
+
+func (num *ComplexType) Eq(ty Type) bool {
+	other, ok := ty.(*ComplexType)
 	if ok {
-		return alias.Ident == other.Ident && alias.Alias.Eq(other.Alias)
+		return num.Type == other.Type
 	}
 	return false
 }
 
-func (alias *AliasType) Base() Type {
-	return alias.Alias.Base()
+func (num *ComplexType) Base() Type {
+	return num
 }
 
-func (alias *AliasType) Zero(ns *LLVMNamespace) TypedValue {
-	return alias.Alias.Zero(ns)
+func (num *ComplexType) Zero(ns *LLVMNamespace) TypedValue {
+	return &TypedConstComplex{ConstComplex{new(big.Rat), new(big.Rat)}, num}
 }
 
-func (alias *AliasType) BaseIDString() string {
-	return alias.Alias.Base().BaseIDString()
+func (num *ComplexType) BaseIDString() string {
+	return num.String()
 }
 
-func (alias *AliasType) Named() bool {
+func (num *ComplexType) Named() bool {
 	return true
 }
 
+/*
+ * bool is an i1 while in registers, but takes up a whole byte in memory, the
+ * same as C's _Bool; see MemLLVM.
+ */
+type BoolType struct{}
+
+func (b *BoolType) String() string {
+	return "bool"
+}
+
+func (b *BoolType) LLVM() llvm.Type {
+	return llvm.IntType(1)
+}
+
+func (b *BoolType) Eq(ty Type) bool {
+	_, ok := ty.(*BoolType)
+	return ok
+}
+
+func (b *BoolType) Base() Type {
+	return b
+}
+
+func (b *BoolType) Zero(ns *LLVMNamespace) TypedValue {
+	return &TypedConstBool{ConstBool{false}, b}
+}
+
+func (b *BoolType) BaseIDString() string {
+	return b.String()
+}
+
+func (b *BoolType) Named() bool {
+	return true
+}
+
+/*
+ * Returns the LLVM type used to hold a `ty` in memory (variables, globals and,
+ * eventually, aggregate members). This is only different from ty.LLVM() for
+ * types with sub-byte register representations.
+ */
+func MemLLVM(ty Type) llvm.Type {
+	if _, ok := ty.Base().(*BoolType); ok {
+		return llvm.IntType(8)
+	}
+	return ty.LLVM()
+}
+
+/*
+ * A string is a pointer to its (immutable) bytes and a length in bytes, like
+ * Go's own string header. The bytes aren't NUL-terminated.
+ */
+type StringType struct{}
+
+func (str *StringType) String() string {
+	return "string"
+}
+
+func (str *StringType) LLVM() llvm.Type {
+	ptr := llvm.PointerType(llvm.IntType(8), 0)
+	length := global_type_factory.IntType(BLTN_TY_INT).LLVM()
+	return llvm.StructType([]llvm.Type{ptr, length}, false)
+}
+
+func (str *StringType) Eq(ty Type) bool {
+	_, ok := ty.(*StringType)
+	return ok
+}
+
+func (str *StringType) Base() Type {
+	return str
+}
+
+func (str *StringType) Zero(ns *LLVMNamespace) TypedValue {
+	return &TypedConstString{ConstString{"", ns}, str}
+}
+
+func (str *StringType) BaseIDString() string {
+	return str.String()
+}
+
+func (str *StringType) Named() bool {
+	return true
+}
+
+/*
+ * Arrays are values: they're copied on assignment and when passed to or
+ * returned from functions, which LLVM's first-class aggregates give us.
+ */
+type ArrayType struct {
+	Elem Type
+	Len  int64
+}
+
+func (arr *ArrayType) String() string {
+	return fmt.Sprintf("[%d]%s", arr.Len, arr.Elem.String())
+}
+
+func (arr *ArrayType) LLVM() llvm.Type {
+	return llvm.ArrayType(MemLLVM(arr.Elem), uint(arr.Len))
+}
+
+func (arr *ArrayType) Eq(ty Type) bool {
+	other, ok := ty.(*ArrayType)
+	if ok {
+		return arr.Len == other.Len && arr.Elem.Eq(other.Elem)
+	}
+	return false
+}
+
+func (arr *ArrayType) Base() Type {
+	return arr
+}
+
+// every element of the zero array is zero; LLVM emits it as zeroinitializer.
+func (arr *ArrayType) Zero(ns *LLVMNamespace) TypedValue {
+	return &Register{arr, llvm.ConstNull(arr.LLVM())}
+}
+
+func (arr *ArrayType) BaseIDString() string {
+	return fmt.Sprintf("a.%d.%s", arr.Len, arr.Elem.BaseIDString())
+}
+
+func (arr *ArrayType) Named() bool {
+	return false
+}
+
+/*
+ * A slice is a three-word header: a pointer to the first element, a length,
+ * and a capacity.
+ */
+type SliceType struct {
+	Elem Type
+}
+
+func (slice *SliceType) String() string {
+	return "[]" + slice.Elem.String()
+}
+
+func (slice *SliceType) LLVM() llvm.Type {
+	ptr := llvm.PointerType(MemLLVM(slice.Elem), 0)
+	length := global_type_factory.IntType(BLTN_TY_INT).LLVM()
+	return llvm.StructType([]llvm.Type{ptr, length, length}, false)
+}
+
+func (slice *SliceType) Eq(ty Type) bool {
+	other, ok := ty.(*SliceType)
+	if ok {
+		return slice.Elem.Eq(other.Elem)
+	}
+	return false
+}
+
+func (slice *SliceType) Base() Type {
+	return slice
+}
+
+// the zero slice is nil: a null pointer with no length or capacity.
+func (slice *SliceType) Zero(ns *LLVMNamespace) TypedValue {
+	return &Register{slice, llvm.ConstNull(slice.LLVM())}
+}
+
+func (slice *SliceType) BaseIDString() string {
+	return "s." + slice.Elem.BaseIDString()
+}
+
+func (slice *SliceType) Named() bool {
+	return false
+}
+
+type StructField struct {
+	Name string
+	Ty   Type
+}
+
+/*
+ * Struct fields are laid out in declaration order, with the padding the data
+ * layout calls for, so a struct looks the same in memory as its C equivalent.
+ */
+type StructType struct {
+	Fields []StructField
+}
+
+func (st *StructType) String() string {
+	fields := make([]string, len(st.Fields))
+	for i, field := range st.Fields {
+		fields[i] = NamedString(field.Ty, field.Name)
+	}
+	if len(fields) == 0 {
+		return "struct {}"
+	}
+	return "struct { " + strings.Join(fields, "; ") + " }"
+}
+
+func (st *StructType) LLVM() llvm.Type {
+	return llvm.StructType(st.fieldLLVM(), false)
+}
+
+func (st *StructType) fieldLLVM() []llvm.Type {
+	fieldTypes := make([]llvm.Type, len(st.Fields))
+	for i, field := range st.Fields {
+		fieldTypes[i] = MemLLVM(field.Ty)
+	}
+	return fieldTypes
+}
+
+func (st *StructType) Eq(ty Type) bool {
+	other, ok := ty.(*StructType)
+	if !ok || len(st.Fields) != len(other.Fields) {
+		return false
+	}
+	for i, field := range st.Fields {
+		if field.Name != other.Fields[i].Name || !field.Ty.Eq(other.Fields[i].Ty) {
+			return false
+		}
+	}
+	return true
+}
+
+func (st *StructType) Base() Type {
+	return st
+}
+
+func (st *StructType) Zero(ns *LLVMNamespace) TypedValue {
+	return &Register{st, llvm.ConstNull(st.LLVM())}
+}
+
+func (st *StructType) BaseIDString() string {
+	str := "st"
+	for _, field := range st.Fields {
+		str = str + "." + field.Name + "." + field.Ty.BaseIDString()
+	}
+	return str
+}
+
+func (st *StructType) Named() bool {
+	return false
+}
+
+// returns the index of the field called `name`, or -1 if there isn't one.
+func (st *StructType) FieldIndex(name string) int {
+	if name == "_" {
+		return -1
+	}
+	for i, field := range st.Fields {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// the offset in bytes of field `i` from the start of the struct.
+func (st *StructType) FieldOffset(i int) uint64 {
+	return global_type_factory.Target.FieldOffset(st.LLVM(), i)
+}
+
+/*
+ * A defined type, declared with `type Name T`. It has the same underlying type
+ * as T, but is a different type: it's only identical to itself. (Aliases,
+ * declared with `type Name = T`, aren't types of their own at all; the name
+ * is just bound to T.)
+ */
+type NamedType struct {
+	Name       string
+	Underlying Type // nil until the declaration has been resolved.
+	Methods    []*Method
+	// instances of generic types (see generics.go) know what they're instances of.
+	Generic  *GenericType
+	TypeArgs []Type
+
+	// named struct types get a named LLVM struct, so that they may refer to
+	// themselves through pointers.
+	llvmType llvm.Type
+	hasLLVM  bool
+}
+
+func CreateNamedType(name string) *NamedType {
+	return &NamedType{Name: name}
+}
+
+func (named *NamedType) String() string {
+	return named.Name
+}
+
+func (named *NamedType) LLVM() llvm.Type {
+	st, ok := named.Underlying.Base().(*StructType)
+	if !ok {
+		return named.Underlying.LLVM()
+	}
+	if !named.hasLLVM {
+		named.llvmType = llvm.GlobalContext().StructCreateNamed(named.Name)
+		named.hasLLVM = true
+		// the body is set afterwards, since it may refer back to this type.
+		named.llvmType.StructSetBody(st.fieldLLVM(), false)
+	}
+	return named.llvmType
+}
+
+func (named *NamedType) Eq(ty Type) bool {
+	other, ok := ty.(*NamedType)
+	return ok && other == named
+}
+
+func (named *NamedType) Base() Type {
+	return named.Underlying.Base()
+}
+
+func (named *NamedType) Zero(ns *LLVMNamespace) TypedValue {
+	return &Register{named, llvm.ConstNull(named.LLVM())}
+}
+
+func (named *NamedType) BaseIDString() string {
+	// the underlying type may refer back to this one, so it can't be used here.
+	return "n." + named.Name
+}
+
+func (named *NamedType) Named() bool {
+	return true
+}
+
+type IfaceMethod struct {
+	Name string
+	Sig  *FuncType
+}
+
+/*
+ * An interface value is two words: a pointer to the itable for its dynamic
+ * type, and a pointer to its value (or the value itself, for pointers). The
+ * itable starts with the dynamic type's descriptor, followed by the dynamic
+ * type's implementation of each of the interface's methods, which are kept
+ * sorted by name. A nil interface has a null itable. See iface.go.
+ */
+type InterfaceType struct {
+	Methods []IfaceMethod
+	// only constraints (see generics.go) restrict their types beyond methods.
+	Set *TypeSet
+}
+
+func (iface *InterfaceType) String() string {
+	elems := make([]string, 0)
+	if iface.Set != nil {
+		elems = append(elems, iface.Set.String())
+	}
+	for _, method := range iface.Methods {
+		elems = append(elems, methodKey(method.Name, method.Sig))
+	}
+	if len(elems) == 0 {
+		return "interface {}"
+	}
+	return "interface { " + strings.Join(elems, "; ") + " }"
+}
+
+func (iface *InterfaceType) LLVM() llvm.Type {
+	word := llvm.PointerType(llvm.IntType(8), 0)
+	return llvm.StructType([]llvm.Type{word, word}, false)
+}
+
+func (iface *InterfaceType) Eq(ty Type) bool {
+	other, ok := ty.(*InterfaceType)
+	if !ok || len(iface.Methods) != len(other.Methods) || !iface.Set.Eq(other.Set) {
+		return false
+	}
+	for i, method := range iface.Methods {
+		if method.Name != other.Methods[i].Name || !method.Sig.Eq(other.Methods[i].Sig) {
+			return false
+		}
+	}
+	return true
+}
+
+func (iface *InterfaceType) Base() Type {
+	return iface
+}
+
+// the zero interface is nil.
+func (iface *InterfaceType) Zero(ns *LLVMNamespace) TypedValue {
+	return &Register{iface, llvm.ConstNull(iface.LLVM())}
+}
+
+func (iface *InterfaceType) BaseIDString() string {
+	str := "i"
+	for _, method := range iface.Methods {
+		str = str + "." + method.Name
+	}
+	return str
+}
+
+func (iface *InterfaceType) Named() bool {
+	return false
+}
+
+// returns the index of the method called `name`, or -1 if there isn't one.
+func (iface *InterfaceType) MethodIndex(name string) int {
+	for i, method := range iface.Methods {
+		if method.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+ * A map is a pointer to the runtime's hash table (see rt/common/map.c), which
+ * is null for a nil map.
+ */
+type MapType struct {
+	Key  Type
+	Elem Type
+}
+
+func (m *MapType) String() string {
+	return "map[" + m.Key.String() + "]" + m.Elem.String()
+}
+
+func (m *MapType) LLVM() llvm.Type {
+	return llvm.PointerType(llvm.IntType(8), 0)
+}
+
+func (m *MapType) Eq(ty Type) bool {
+	other, ok := ty.(*MapType)
+	if ok {
+		return m.Key.Eq(other.Key) && m.Elem.Eq(other.Elem)
+	}
+	return false
+}
+
+func (m *MapType) Base() Type {
+	return m
+}
+
+// the zero map is nil.
+func (m *MapType) Zero(ns *LLVMNamespace) TypedValue {
+	return &Register{m, llvm.ConstNull(m.LLVM())}
+}
+
+func (m *MapType) BaseIDString() string {
+	return "m." + m.Key.BaseIDString() + "." + m.Elem.BaseIDString()
+}
+
+func (m *MapType) Named() bool {
+	return false
+}
+
 type PointerType struct {
 	At Type
 }
@@ -174,7 +713,7 @@ func (ptr *PointerType) String() string {
 }
 
 func (ptr *PointerType) LLVM() llvm.Type {
-	return llvm.PointerType(ptr.At.LLVM(), 0)
+	return llvm.PointerType(MemLLVM(ptr.At), 0)
 }
 
 func (ptr *PointerType) Eq(ty Type) bool {
@@ -198,7 +737,7 @@ func (ptr *PointerType) Zero(ns *LLVMNamespace) TypedValue {
 }
 
 func (ptr *PointerType) Named() bool {
-	return ptr.At.Named()
+	return false
 }
 
 type FuncType struct {
@@ -225,7 +764,17 @@ func (fn *FuncType) String() string {
 	return fmt.Sprintf("func (%s)%s", paramStr, resultStr)
 }
 
+/*
+ * A function value is a closure: a pointer to its code, and one to the context
+ * holding whatever variables it captured (see closure.go).
+ */
 func (fn *FuncType) LLVM() llvm.Type {
+	word := llvm.PointerType(llvm.IntType(8), 0)
+	return llvm.StructType([]llvm.Type{word, word}, false)
+}
+
+// the LLVM type of a function with this signature.
+func (fn *FuncType) LLVMSignature() llvm.Type {
 	paramTypes := make([]llvm.Type, 0)
 	for _, param := range fn.Params {
 		paramTypes = append(paramTypes, param.LLVM())
@@ -252,10 +801,10 @@ func (fn *FuncType) Eq(ty Type) bool {
 				return false
 			}
 		}
-		if !fn.Result.Eq(other.Result) {
-			return false
+		if fn.Result == nil || other.Result == nil {
+			return fn.Result == nil && other.Result == nil
 		}
-		return true
+		return fn.Result.Eq(other.Result)
 	}
 	return false
 }
@@ -265,6 +814,9 @@ func (fn *FuncType) Base() Type {
 	for i, v := range fn.Params {
 		baseParams[i] = v.Base()
 	}
+	if fn.Result == nil {
+		return &FuncType{baseParams, nil}
+	}
 	return &FuncType{baseParams, fn.Result.Base()}
 }
 
@@ -283,7 +835,7 @@ func (fn *FuncType) BaseIDString() string {
 }
 
 func (fn *FuncType) Zero(ns *LLVMNamespace) TypedValue {
-	return CreateNilPointer(fn)
+	return &Register{fn, llvm.ConstNull(fn.LLVM())}
 }
 
 func CreateFunctionType(result Type, params ...Type) *FuncType {
@@ -295,26 +847,32 @@ func (fn *FuncType) Named() bool {
 }
 
 func GetStringType() Type {
-	char_ty := global_type_factory.IntType(BLTN_TY_UINT8)
-	return &PointerType{char_ty}
+	return global_type_factory.StringType()
 }
 
-func assignable(typeA Type, typeB Type) bool {
-	// this is stupid.
-	switch tyA := typeA.(type) {
-	default:
-		switch tyB := typeB.(type) {
-		default:
-			if typeA.Eq(typeB) {
-				return true
-			}
+/*
+ * assignableAsIs reports whether a value of type `from` can be assigned to
+ * type `to` without changing its representation: the types are identical, or
+ * they have identical underlying types and at least one of them isn't named.
+ */
+func assignableAsIs(from Type, to Type) bool {
+	if from.Eq(to) {
+		return true
+	}
+	return underlying(from).Eq(underlying(to)) && !(from.Named() && to.Named())
+}
 
-			if typeA.Base().Eq(typeB.Base()) && (!(tyA.Named() && tyB.Named())) {
-				return true
-			}
-		}
+// also admits interfaces that `from` implements.
+func assignable(from Type, to Type) bool {
+	if assignableAsIs(from, to) {
+		return true
+	}
+	iface, ok := underlying(to).(*InterfaceType)
+	if !ok || iface.Set != nil {
+		return false
 	}
-	panic("unreachable!")
+	missing, _ := missingMethods(from, iface)
+	return len(missing) == 0
 }
 
 func TypeMismatchDiag(expected Type, actual Type) *UDiag {
@@ -0,0 +1,340 @@
+package main
+
+import "go/ast"
+import "llvm"
+import "math/big"
+import "strconv"
+
+/*
+ * An imported package. The only one there is for now is `unsafe`, whose
+ * members are all built in: calls to its functions are translated specially,
+ * like calls to `len`.
+ */
+type Package struct {
+	Name  string
+	Types map[string]Type
+	Funcs map[string]*BuiltinFunc
+}
+
+func createUnsafePackage() *Package {
+	pkg := &Package{"unsafe", map[string]Type{"Pointer": &UnsafePointerType{}}, make(map[string]*BuiltinFunc)}
+	for _, name := range []string{"Sizeof", "Alignof", "Offsetof", "Add", "Slice", "String"} {
+		pkg.Funcs[name] = &BuiltinFunc{"unsafe." + name}
+	}
+	return pkg
+}
+
+func (pkg *Package) RValue(expected_type Type) (TypedValue, *UDiag) {
+	udiag := UDiag("Use of package " + pkg.Name + " without a selector.")
+	return nil, &udiag
+}
+
+func (pkg *Package) String() string {
+	return "<package " + pkg.Name + ">"
+}
+
+func (pkg *Package) LValue() bool {
+	return false
+}
+
+// binds the packages that `imports` import in `scope`.
+func (trans *Translator) declareImports(scope *Scope, imports []*ast.ImportSpec) *GoDiag {
+	for _, spec := range imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || path != "unsafe" {
+			return DiagFromAST(spec.Path, "Cannot import %s: only the unsafe package is supported.", spec.Path.Value)
+		}
+		pkg := createUnsafePackage()
+		name := pkg.Name
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == "_" {
+			continue
+		}
+		if name == "." {
+			return DiagFromAST(spec.Name, "Dot imports are not supported.")
+		}
+		if !scope.addValue(name, pkg) {
+			return DiagFromAST(spec, "\"%s\" is already declared.", name)
+		}
+	}
+	return nil
+}
+
+// the package that `expr` names, or nil if it doesn't name one.
+func packageOf(scope *Scope, expr ast.Expr) *Package {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	bound := scope.lookupVar(ident.Name)
+	if bound == nil {
+		return nil
+	}
+	pkg, _ := bound.Val.(*Package)
+	return pkg
+}
+
+// translates `pkg.Name` used as a value. Only functions can be, and only to call them.
+func (pkg *Package) selectMember(expr *ast.SelectorExpr) (UntypedValue, *GoDiag) {
+	if fn, ok := pkg.Funcs[expr.Sel.Name]; ok {
+		return fn, nil
+	}
+	if _, ok := pkg.Types[expr.Sel.Name]; ok {
+		return nil, DiagFromAST(expr, "%s.%s is a type, not a value.", pkg.Name, expr.Sel.Name)
+	}
+	return nil, DiagFromAST(expr.Sel, "Package %s has no member %s.", pkg.Name, expr.Sel.Name).WithHint(pkg.suggestMember(expr.Sel.Name))
+}
+
+/*
+ * unsafe.Pointer, a pointer to anything at all. It can't be dereferenced, but
+ * any other pointer converts to it and back, as does a uintptr.
+ */
+type UnsafePointerType struct{}
+
+func (ptr *UnsafePointerType) String() string {
+	return "unsafe.Pointer"
+}
+
+func (ptr *UnsafePointerType) LLVM() llvm.Type {
+	return bytePtrType()
+}
+
+func (ptr *UnsafePointerType) Eq(ty Type) bool {
+	_, ok := ty.(*UnsafePointerType)
+	return ok
+}
+
+func (ptr *UnsafePointerType) Base() Type {
+	return ptr
+}
+
+func (ptr *UnsafePointerType) BaseIDString() string {
+	return "unsafe.Pointer"
+}
+
+func (ptr *UnsafePointerType) Zero(ns *LLVMNamespace) TypedValue {
+	return &Register{ptr, llvm.ConstPointerNull(bytePtrType())}
+}
+
+func (ptr *UnsafePointerType) Named() bool {
+	return true
+}
+
+// reports whether `ty` is uintptr, or a type defined as one.
+func isUintptr(ty Type) bool {
+	intTy, ok := ty.Base().(*IntType)
+	return ok && intTy.Type == BLTN_TY_UINTPTR
+}
+
+// converts between unsafe.Pointer and other pointers or uintptr, or returns nil.
+func (block *Block) buildUnsafeConversion(val TypedValue, ty Type) TypedValue {
+	from := val.Type().Base()
+	to := ty.Base()
+	if _, ok := to.(*UnsafePointerType); ok {
+		switch from.(type) {
+		case *PointerType, *UnsafePointerType:
+			return &Register{ty, block.Builder.BuildBitCast(val.LLVM(), bytePtrType(), "")}
+		}
+		if isUintptr(from) {
+			return &Register{ty, block.Builder.BuildIntToPtr(val.LLVM(), bytePtrType(), "")}
+		}
+		return nil
+	}
+	if _, ok := from.(*UnsafePointerType); !ok {
+		return nil
+	}
+	if _, ok := to.(*PointerType); ok {
+		return &Register{ty, block.Builder.BuildBitCast(val.LLVM(), ty.LLVM(), "")}
+	}
+	if isUintptr(to) {
+		return &Register{ty, block.Builder.BuildPtrToInt(val.LLVM(), ty.LLVM(), "")}
+	}
+	return nil
+}
+
+/*
+ * typeOfOperand returns the type `expr` would have, without evaluating it:
+ * its code goes into a block of its own that's never run.
+ */
+func (block *Block) typeOfOperand(expr ast.Expr) (Type, *GoDiag) {
+	scratch := *block
+	scratch.Builder = llvm.CreateBuilder()
+	defer scratch.Builder.Dispose()
+	scratch.positionAtEnd(block.appendBasicBlock("unevaluated"))
+	val, diag := scratch.translateOperand(expr)
+	if diag != nil {
+		return nil, diag
+	}
+	if !scratch.Terminated {
+		scratch.Builder.BuildUnreachable()
+	}
+	typed, udiag := val.RValue(nil)
+	if udiag != nil {
+		return nil, BindDiagToAST(expr, *udiag)
+	}
+	return typed.Type(), nil
+}
+
+// returns `n` as a constant uintptr, as unsafe.Sizeof and the like return.
+func constUintptrValue(n uint64) *TypedConstInt {
+	return &TypedConstInt{ConstInt{new(big.Int).SetUint64(n), false, false}, global_type_factory.IntType(BLTN_TY_UINTPTR)}
+}
+
+// translates `unsafe.Sizeof(x)` and `unsafe.Alignof(x)`, which are constants.
+func (block *Block) translateSizeofBuiltin(call *ast.CallExpr, align bool) (UntypedValue, *GoDiag) {
+	name := "unsafe.Sizeof"
+	if align {
+		name = "unsafe.Alignof"
+	}
+	if diag := checkArgCount(call, name, 1); diag != nil {
+		return nil, diag
+	}
+	ty, diag := block.typeOfOperand(call.Args[0])
+	if diag != nil {
+		return nil, diag
+	}
+	target := block.Trans.Target
+	if align {
+		return constUintptrValue(uint64(target.Data.ABITypeAlignment(MemLLVM(ty)))), nil
+	}
+	return constUintptrValue(target.AllocSize(MemLLVM(ty))), nil
+}
+
+// translates `unsafe.Offsetof(x.f)`, the constant offset of the field f within x.
+func (block *Block) translateOffsetofBuiltin(call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	if diag := checkArgCount(call, "unsafe.Offsetof", 1); diag != nil {
+		return nil, diag
+	}
+	arg := call.Args[0]
+	for {
+		paren, ok := arg.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		arg = paren.X
+	}
+	sel, ok := arg.(*ast.SelectorExpr)
+	if !ok {
+		return nil, DiagFromAST(arg, "The argument of unsafe.Offsetof must be a field selector.")
+	}
+	ty, diag := block.typeOfOperand(sel.X)
+	if diag != nil {
+		return nil, diag
+	}
+	// `p.f` selects a field of `*p`.
+	if ptrTy := pointerTypeOf(ty); ptrTy != nil {
+		ty = ptrTy.At
+	}
+	st, ok := ty.Base().(*StructType)
+	if !ok {
+		return nil, DiagFromAST(sel, "The argument of unsafe.Offsetof must be a field selector.")
+	}
+	idx, diag := fieldIndex(sel, ty, st)
+	if diag != nil {
+		return nil, diag
+	}
+	llvmTy := llvm.StructType(st.fieldLLVM(), false)
+	return constUintptrValue(block.Trans.Target.FieldOffset(llvmTy, idx)), nil
+}
+
+/*
+ * translateUnsafeOperand translates `expr`, which must be of type `ty`, or a
+ * pointer if `ty` is nil.
+ */
+func (block *Block) translateUnsafeOperand(expr ast.Expr, ty Type, name string) (TypedValue, *GoDiag) {
+	val, diag := block.translateOperand(expr)
+	if diag != nil {
+		return nil, diag
+	}
+	typed, diag := block.assignTo(expr, val, ty)
+	if diag != nil {
+		return nil, diag
+	}
+	if ty == nil && pointerTypeOf(typed.Type()) == nil {
+		return nil, DiagFromAST(expr, "The first argument of %s must be a pointer, but found type %s.", name, typed.Type().String())
+	}
+	return typed, nil
+}
+
+/*
+ * translateOffset translates an integer `expr`, which may be negative, and
+ * returns it as an int.
+ */
+func (block *Block) translateOffset(expr ast.Expr) (TypedValue, *GoDiag) {
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	val, diag := block.translateOperand(expr)
+	if diag != nil {
+		return nil, diag
+	}
+	var typed TypedValue
+	var udiag *UDiag
+	if isUntyped(val) {
+		typed, udiag = val.RValue(intTy)
+	} else {
+		typed, udiag = val.RValue(nil)
+	}
+	if udiag != nil {
+		return nil, BindDiagToAST(expr, *udiag)
+	}
+	offTy, ok := typed.Type().Base().(*IntType)
+	if !ok {
+		return nil, DiagFromAST(expr, "Offset must be an integer, but found type %s.", typed.Type().String())
+	}
+	return &Register{intTy, block.buildIntResize(typed.LLVM(), offTy, intTy.(*IntType))}, nil
+}
+
+// translates `unsafe.Add(ptr, len)`, which is `ptr` moved on by `len` bytes.
+func (block *Block) translateUnsafeAddBuiltin(call *ast.CallExpr) (UntypedValue, *GoDiag) {
+	if diag := checkArgCount(call, "unsafe.Add", 2); diag != nil {
+		return nil, diag
+	}
+	ptr, diag := block.translateUnsafeOperand(call.Args[0], &UnsafePointerType{}, "unsafe.Add")
+	if diag != nil {
+		return nil, diag
+	}
+	offset, diag := block.translateOffset(call.Args[1])
+	if diag != nil {
+		return nil, diag
+	}
+	moved := block.Builder.BuildGEP(ptr.LLVM(), []llvm.Value{offset.LLVM()}, "")
+	return &Register{ptr.Type(), moved}, nil
+}
+
+/*
+ * translateUnsafeSliceBuiltin translates `unsafe.Slice(ptr, len)`, a slice of
+ * the `len` elements starting at `ptr`, or `unsafe.String(ptr, len)`, a string
+ * of the bytes there. Either panics if `len` is negative, or if `ptr` is nil
+ * but `len` isn't zero.
+ */
+func (block *Block) translateUnsafeSliceBuiltin(call *ast.CallExpr, str bool) (UntypedValue, *GoDiag) {
+	name := "unsafe.Slice"
+	var ptrTy Type
+	if str {
+		name = "unsafe.String"
+		ptrTy = &PointerType{global_type_factory.IntType(BLTN_TY_UINT8)}
+	}
+	if diag := checkArgCount(call, name, 2); diag != nil {
+		return nil, diag
+	}
+	ptr, diag := block.translateUnsafeOperand(call.Args[0], ptrTy, name)
+	if diag != nil {
+		return nil, diag
+	}
+	length, diag := block.translateOffset(call.Args[1])
+	if diag != nil {
+		return nil, diag
+	}
+	elem := pointerTypeOf(ptr.Type()).At
+	size := block.Trans.Target.AllocSize(MemLLVM(elem))
+	intTy := global_type_factory.IntType(BLTN_TY_INT)
+	block.buildRuntimeCall("gogo_unsafe_slice_check", block.Trans.LLns.internCString(name),
+		block.buildBytePtr(ptr.LLVM()), length.LLVM(), llvm.ConstInt(intTy.LLVM(), size, false))
+	if str {
+		ty := global_type_factory.StringType()
+		return &Register{ty, block.buildString(ty, ptr.LLVM(), length.LLVM())}, nil
+	}
+	ty := &SliceType{elem}
+	return &Register{ty, block.buildSlice(ty, ptr.LLVM(), length.LLVM(), length.LLVM())}, nil
+}
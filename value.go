@@ -1,8 +1,10 @@
 package main
 
 import "llvm"
+import "math"
 import "math/big"
 import "fmt"
+import "strconv"
 
 type UntypedValue interface {
 
@@ -61,7 +63,7 @@ func (v *BoundVar) LValue() bool {
 	if v.Const {
 		return false
 	}
-	return true
+	return v.Val.LValue()
 }
 
 func (v *BoundVar) RValue(expected_type Type) (TypedValue, *UDiag) {
@@ -74,6 +76,10 @@ func (v *BoundVar) RValue(expected_type Type) (TypedValue, *UDiag) {
 
 type ValueMap map[string]*BoundVar
 
+/*
+   A function with a known symbol, which calls go to directly. Used as a value
+   rather than called, it becomes a closure (see funcClosure).
+ */
 type FuncValue struct {
 	Name    string
 	Ty      *FuncType
@@ -103,36 +109,72 @@ func (fn *FuncValue) LValue() bool {
 	return false
 }
 
+/*
+   An untyped string constant. Its bytes are only placed in the module once
+   the constant is actually used as a value; see LLVMNamespace.internString.
+ */
 type ConstString struct {
-	Str     string
-	LLVMVal llvm.Value
+	Str string
+	Ns  *LLVMNamespace
 }
 
 func (lit *ConstString) RValue(expected_type Type) (TypedValue, *UDiag) {
-	str_ty := GetStringType()
-	if expected_type == nil || expected_type.Eq(str_ty) {
-		return lit, nil
+	if expected_type == nil {
+		return &TypedConstString{*lit, GetStringType()}, nil
+	}
+	if _, ok := expected_type.Base().(*StringType); ok {
+		return &TypedConstString{*lit, expected_type}, nil
+	}
+	// for calling C functions like puts, which want a NUL-terminated *uint8.
+	if ptrTy, ok := expected_type.(*PointerType); ok && ptrTy.At.Eq(global_type_factory.IntType(BLTN_TY_UINT8)) {
+		return &Pointer{expected_type, lit.Ns.internCString(lit.Str)}, nil
 	}
-	return nil, TypeMismatchDiag(expected_type, str_ty)
+	return nil, TypeMismatchDiag(expected_type, GetStringType())
 }
 
-func (lit *ConstString) Type() Type {
-	return GetStringType()
+func (lit *ConstString) String() string {
+	return strconv.Quote(lit.Str)
 }
 
-func (lit *ConstString) String() string {
-	return "\"" + lit.Str + "\""
+func (lit *ConstString) LValue() bool {
+	return false
 }
 
-func (lit *ConstString) LLVM() llvm.Value {
-	indices := []llvm.Value{llvm.ConstInt(llvm.IntType(64), 0, false), llvm.ConstInt(llvm.IntType(64), 0, false)}
-	return llvm.ConstGEP(lit.LLVMVal, indices)
+type TypedConstString struct {
+	Inner ConstString
+	Ty    Type
 }
 
-func (lit *ConstString) LValue() bool {
+func (lit *TypedConstString) Type() Type {
+	return lit.Ty
+}
+
+func (lit *TypedConstString) LLVM() llvm.Value {
+	length := llvm.ConstInt(global_type_factory.IntType(BLTN_TY_INT).LLVM(), uint64(len(lit.Inner.Str)), false)
+	var ptr llvm.Value
+	if lit.Inner.Str == "" {
+		ptr = llvm.ConstPointerNull(llvm.PointerType(llvm.IntType(8), 0))
+	} else {
+		ptr = lit.Inner.Ns.internCString(lit.Inner.Str)
+	}
+	return llvm.ConstStruct([]llvm.Value{ptr, length}, false)
+}
+
+func (lit *TypedConstString) LValue() bool {
 	return false
 }
 
+func (lit *TypedConstString) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil || expected_type.Eq(lit.Ty) {
+		return lit, nil
+	}
+	return nil, TypeMismatchDiag(expected_type, lit.Ty)
+}
+
+func (lit *TypedConstString) String() string {
+	return lit.Inner.String()
+}
+
 type TypedConstInt struct {
 	Inner ConstInt
 	Ty Type
@@ -142,8 +184,16 @@ func (lit *TypedConstInt) Type() Type {
 	return lit.Ty
 }
 
+/*
+ * The value fits its type, but not necessarily an int64 (e.g. a large uint64),
+ * so it's handed to LLVM as its 64-bit two's complement.
+ */
 func (lit *TypedConstInt) LLVM() llvm.Value {
-	return llvm.ConstInt(lit.Ty.LLVM(), uint64(lit.Inner.Int.Int64()), lit.Inner.Signed)
+	bits := lit.Inner.Int.Uint64()
+	if lit.Inner.Int.Sign() < 0 {
+		bits = uint64(lit.Inner.Int.Int64())
+	}
+	return llvm.ConstInt(lit.Ty.LLVM(), bits, lit.Inner.Signed)
 }
 
 func (lit *TypedConstInt) LValue() bool {
@@ -164,22 +214,44 @@ func (lit *TypedConstInt) String() string {
 type ConstInt struct {
 	Int *big.Int
 	Signed bool
+	// rune constants, like 'a', are integers that default to rune, not int.
+	Rune bool
 }
 
 func (lit *ConstInt) RValue(expected_type Type) (TypedValue, *UDiag) {
-	var int_ty *IntType
+	if expected_type == nil && lit.Rune {
+		return lit.RValue(global_type_factory.IntType(BLTN_TY_INT32))
+	}
 	if expected_type == nil {  // default to int
-		int_ty, _ = global_type_factory.IntType(BLTN_TY_INT).(*IntType)
-	} else {
-		var ok bool
-		int_ty, ok = expected_type.(*IntType)
-		if !ok {
-			udiag := UDiag("Expected type " + expected_type.String() + " but got integer constant")
+		return lit.RValue(global_type_factory.IntType(BLTN_TY_INT))
+	}
+	switch intTy := expected_type.Base().(type) {
+	case *IntType:
+		if !intFits(lit.Int, intTy) {
+			udiag := UDiag("Constant " + lit.String() + " overflows " + expected_type.String())
 			return nil, &udiag
 		}
+		return &TypedConstInt{*lit, expected_type}, nil
+	case *FloatType:
+		float := &ConstFloat{new(big.Rat).SetInt(lit.Int)}
+		return float.RValue(expected_type)
+	case *ComplexType:
+		cmplx := &ConstComplex{new(big.Rat).SetInt(lit.Int), new(big.Rat)}
+		return cmplx.RValue(expected_type)
 	}
+	udiag := UDiag("Expected type " + expected_type.String() + " but got integer constant")
+	return nil, &udiag
+}
 
-	return &TypedConstInt{*lit, int_ty}, nil
+// reports whether the integer `n` can be represented by `ty`.
+func intFits(n *big.Int, ty *IntType) bool {
+	bits := ty.BitWidth()
+	if !ty.Signed() {
+		return n.Sign() >= 0 && n.BitLen() <= int(bits)
+	}
+	// -2^(bits-1) <= n < 2^(bits-1)
+	limit := new(big.Int).Lsh(big.NewInt(1), bits-1)
+	return n.Cmp(limit) < 0 && n.Cmp(new(big.Int).Neg(limit)) >= 0
 }
 
 func (lit *ConstInt) String() string {
@@ -222,3 +294,402 @@ func (ptr *Pointer) RValue(expected_type Type) (TypedValue, *UDiag) {
 	return nil, TypeMismatchDiag(expected_type, ptr.Ty)
 }
 
+
+/*
+   isUntyped reports whether `val` is an untyped constant, i.e. a value that
+   takes its type from the context it's used in.
+ */
+func isUntyped(val UntypedValue) bool {
+	_, typed := val.(TypedValue)
+	return !typed
+}
+
+// A value computed at runtime and held in an LLVM register.
+type Register struct {
+	Ty  Type
+	Val llvm.Value
+}
+
+func (reg *Register) Type() Type {
+	return reg.Ty
+}
+
+func (reg *Register) String() string {
+	return "<" + reg.Ty.String() + " value>"
+}
+
+func (reg *Register) LLVM() llvm.Value {
+	return reg.Val
+}
+
+func (reg *Register) LValue() bool {
+	return false
+}
+
+func (reg *Register) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil || expected_type.Eq(reg.Ty) {
+		return reg, nil
+	}
+	return nil, TypeMismatchDiag(expected_type, reg.Ty)
+}
+
+/*
+   A variable lives in memory (an alloca, for locals) so that it may be
+   assigned to on any path through a function. Its LLVM value is loaded at the
+   builder's current position, i.e. it is the value the variable has "now".
+ */
+type Variable struct {
+	Ty      Type
+	Ptr     llvm.Value
+	Builder llvm.Builder
+}
+
+func (v *Variable) Type() Type {
+	return v.Ty
+}
+
+func (v *Variable) String() string {
+	return "<" + v.Ty.String() + " variable>"
+}
+
+func (v *Variable) LLVM() llvm.Value {
+	return buildLoadValue(v.Builder, v.Ty, v.Ptr)
+}
+
+func (v *Variable) LValue() bool {
+	return true
+}
+
+func (v *Variable) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil || expected_type.Eq(v.Ty) {
+		return &Register{v.Ty, v.LLVM()}, nil
+	}
+	return nil, TypeMismatchDiag(expected_type, v.Ty)
+}
+
+func (v *Variable) BuildAssign(block *Block, val TypedValue) *GoDiag {
+	buildStoreValue(block.Builder, v.Ty, val.LLVM(), v.Ptr)
+	return nil
+}
+
+// loads a `ty` from memory, converting it to its register representation.
+func buildLoadValue(builder llvm.Builder, ty Type, ptr llvm.Value) llvm.Value {
+	return buildFromMem(builder, ty, builder.BuildLoad(ptr, ""))
+}
+
+// stores the register value `val` of type `ty` into memory at `ptr`.
+func buildStoreValue(builder llvm.Builder, ty Type, val llvm.Value, ptr llvm.Value) {
+	builder.BuildStore(buildToMem(builder, ty, val), ptr)
+}
+
+/*
+ * Converts between the register and memory representations of a `ty` (see
+ * MemLLVM), e.g. when putting it into or taking it out of an aggregate.
+ */
+func buildToMem(builder llvm.Builder, ty Type, val llvm.Value) llvm.Value {
+	if _, ok := ty.Base().(*BoolType); ok {
+		return builder.BuildZExt(val, MemLLVM(ty), "")
+	}
+	return val
+}
+
+func buildFromMem(builder llvm.Builder, ty Type, val llvm.Value) llvm.Value {
+	if _, ok := ty.Base().(*BoolType); ok {
+		return builder.BuildTrunc(val, ty.LLVM(), "")
+	}
+	return val
+}
+
+type ConstBool struct {
+	Bool bool
+}
+
+func (lit *ConstBool) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil { // default to bool
+		return &TypedConstBool{*lit, global_type_factory.BoolType()}, nil
+	}
+	if _, ok := expected_type.Base().(*BoolType); !ok {
+		udiag := UDiag("Expected type " + expected_type.String() + " but got boolean constant")
+		return nil, &udiag
+	}
+	return &TypedConstBool{*lit, expected_type}, nil
+}
+
+func (lit *ConstBool) String() string {
+	if lit.Bool {
+		return "true"
+	}
+	return "false"
+}
+
+func (lit *ConstBool) LValue() bool {
+	return false
+}
+
+type TypedConstBool struct {
+	Inner ConstBool
+	Ty    Type
+}
+
+func (lit *TypedConstBool) Type() Type {
+	return lit.Ty
+}
+
+func (lit *TypedConstBool) LLVM() llvm.Value {
+	if lit.Inner.Bool {
+		return llvm.ConstInt(lit.Ty.LLVM(), 1, false)
+	}
+	return llvm.ConstInt(lit.Ty.LLVM(), 0, false)
+}
+
+func (lit *TypedConstBool) LValue() bool {
+	return false
+}
+
+func (lit *TypedConstBool) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil || expected_type.Eq(lit.Ty) {
+		return lit, nil
+	}
+	return nil, TypeMismatchDiag(expected_type, lit.Ty)
+}
+
+func (lit *TypedConstBool) String() string {
+	return lit.Inner.String()
+}
+
+// An untyped floating-point constant, kept exact until it's given a type.
+type ConstFloat struct {
+	Rat *big.Rat
+}
+
+func (lit *ConstFloat) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil { // default to float64
+		return lit.RValue(global_type_factory.FloatType(BLTN_TY_FLOAT64))
+	}
+	switch floatTy := expected_type.Base().(type) {
+	case *FloatType:
+		if floatOverflows(lit.Rat, floatTy) {
+			udiag := UDiag("Constant " + lit.String() + " overflows " + expected_type.String())
+			return nil, &udiag
+		}
+		return &TypedConstFloat{*lit, expected_type}, nil
+	case *IntType:
+		// fine, so long as nothing is lost.
+		if !lit.Rat.IsInt() {
+			udiag := UDiag("Constant " + lit.String() + " truncated to integer")
+			return nil, &udiag
+		}
+		integer := &ConstInt{new(big.Int).Set(lit.Rat.Num()), true, false}
+		return integer.RValue(expected_type)
+	case *ComplexType:
+		cmplx := &ConstComplex{lit.Rat, new(big.Rat)}
+		return cmplx.RValue(expected_type)
+	}
+	udiag := UDiag("Expected type " + expected_type.String() + " but got floating-point constant")
+	return nil, &udiag
+}
+
+// reports whether `r` is too large in magnitude to be a `ty`, even rounded.
+func floatOverflows(r *big.Rat, ty *FloatType) bool {
+	if ty.Type == BLTN_TY_FLOAT32 {
+		f, _ := r.Float32()
+		return math.IsInf(float64(f), 0)
+	}
+	f, _ := r.Float64()
+	return math.IsInf(f, 0)
+}
+
+func (lit *ConstFloat) String() string {
+	if lit.Rat.IsInt() {
+		return lit.Rat.Num().String()
+	}
+	return lit.Rat.FloatString(6)
+}
+
+func (lit *ConstFloat) LValue() bool {
+	return false
+}
+
+type TypedConstFloat struct {
+	Inner ConstFloat
+	Ty    Type
+}
+
+func (lit *TypedConstFloat) Type() Type {
+	return lit.Ty
+}
+
+/*
+ * Rounds straight from the exact value to the type's precision; going via a
+ * float64 first would round float32 constants twice.
+ */
+func (lit *TypedConstFloat) LLVM() llvm.Value {
+	floatTy, _ := lit.Ty.Base().(*FloatType)
+	if floatTy.Type == BLTN_TY_FLOAT32 {
+		f, _ := lit.Inner.Rat.Float32()
+		return llvm.ConstFloat(lit.Ty.LLVM(), float64(f))
+	}
+	f, _ := lit.Inner.Rat.Float64()
+	return llvm.ConstFloat(lit.Ty.LLVM(), f)
+}
+
+func (lit *TypedConstFloat) LValue() bool {
+	return false
+}
+
+func (lit *TypedConstFloat) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil || expected_type.Eq(lit.Ty) {
+		return lit, nil
+	}
+	return nil, TypeMismatchDiag(expected_type, lit.Ty)
+}
+
+func (lit *TypedConstFloat) String() string {
+	return lit.Inner.String()
+}
+
+// An untyped complex constant; both parts are kept exact.
+type ConstComplex struct {
+	Re *big.Rat
+	Im *big.Rat
+}
+
+func (lit *ConstComplex) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil { // default to complex128
+		return lit.RValue(global_type_factory.ComplexType(BLTN_TY_COMPLEX128))
+	}
+	if complexTy, ok := expected_type.Base().(*ComplexType); ok {
+		if floatOverflows(lit.Re, complexTy.PartType()) || floatOverflows(lit.Im, complexTy.PartType()) {
+			udiag := UDiag("Constant " + lit.String() + " overflows " + expected_type.String())
+			return nil, &udiag
+		}
+		return &TypedConstComplex{*lit, expected_type}, nil
+	}
+	// a complex constant with no imaginary part may become a real number.
+	if lit.Im.Sign() == 0 {
+		switch expected_type.Base().(type) {
+		case *FloatType, *IntType:
+			real := &ConstFloat{lit.Re}
+			return real.RValue(expected_type)
+		}
+	}
+	udiag := UDiag("Expected type " + expected_type.String() + " but got complex constant")
+	return nil, &udiag
+}
+
+func (lit *ConstComplex) String() string {
+	re := &ConstFloat{lit.Re}
+	im := &ConstFloat{lit.Im}
+	if lit.Im.Sign() < 0 {
+		return "(" + re.String() + im.String() + "i)"
+	}
+	return "(" + re.String() + "+" + im.String() + "i)"
+}
+
+func (lit *ConstComplex) LValue() bool {
+	return false
+}
+
+type TypedConstComplex struct {
+	Inner ConstComplex
+	Ty    Type
+}
+
+func (lit *TypedConstComplex) Type() Type {
+	return lit.Ty
+}
+
+func (lit *TypedConstComplex) LLVM() llvm.Value {
+	complexTy, _ := lit.Ty.Base().(*ComplexType)
+	partTy := complexTy.PartType()
+	re := &TypedConstFloat{ConstFloat{lit.Inner.Re}, partTy}
+	im := &TypedConstFloat{ConstFloat{lit.Inner.Im}, partTy}
+	return llvm.ConstStruct([]llvm.Value{re.LLVM(), im.LLVM()}, false)
+}
+
+func (lit *TypedConstComplex) LValue() bool {
+	return false
+}
+
+func (lit *TypedConstComplex) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil || expected_type.Eq(lit.Ty) {
+		return lit, nil
+	}
+	return nil, TypeMismatchDiag(expected_type, lit.Ty)
+}
+
+func (lit *TypedConstComplex) String() string {
+	return lit.Inner.String()
+}
+
+/*
+   A predeclared function that isn't an ordinary function value, like `len` or
+   `complex`: each one is translated specially wherever it's called.
+ */
+type BuiltinFunc struct {
+	Name string
+}
+
+func (fn *BuiltinFunc) RValue(expected_type Type) (TypedValue, *UDiag) {
+	udiag := UDiag("Built-in function " + fn.Name + " must be called.")
+	return nil, &udiag
+}
+
+func (fn *BuiltinFunc) String() string {
+	return "<builtin " + fn.Name + ">"
+}
+
+func (fn *BuiltinFunc) LValue() bool {
+	return false
+}
+
+/*
+   A method selected from a value, `x.m`, along with the receiver it's bound
+   to. All that can be done with one for now is to call it.
+ */
+type BoundMethod struct {
+	Method *Method
+	Recv   llvm.Value
+}
+
+func (bound *BoundMethod) RValue(expected_type Type) (TypedValue, *UDiag) {
+	udiag := UDiag("Method values are not supported yet; method " + bound.Method.Name + " must be called.")
+	return nil, &udiag
+}
+
+func (bound *BoundMethod) String() string {
+	return "<method " + bound.Method.Name + ">"
+}
+
+func (bound *BoundMethod) LValue() bool {
+	return false
+}
+
+/*
+   The predeclared `nil`. It has no type of its own, and becomes the zero value
+   of whatever pointer, slice or function type it's used as.
+ */
+type NilValue struct{}
+
+func (lit *NilValue) RValue(expected_type Type) (TypedValue, *UDiag) {
+	if expected_type == nil {
+		udiag := UDiag("Use of untyped nil.")
+		return nil, &udiag
+	}
+	switch expected_type.Base().(type) {
+	case *PointerType:
+		return CreateNilPointer(expected_type), nil
+	case *SliceType, *InterfaceType, *MapType, *FuncType, *UnsafePointerType:
+		return &Register{expected_type, llvm.ConstNull(expected_type.LLVM())}, nil
+	}
+	udiag := UDiag("Cannot use nil as type " + expected_type.String() + ".")
+	return nil, &udiag
+}
+
+func (lit *NilValue) String() string {
+	return "nil"
+}
+
+func (lit *NilValue) LValue() bool {
+	return false
+}